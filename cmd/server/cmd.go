@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
 	"strings"
@@ -16,10 +15,14 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
-	"github.com/fedoseev-vitaliy/payments/internal/providers/apay"
-	"github.com/fedoseev-vitaliy/payments/internal/providers/gpay"
+	"github.com/fedoseev-vitaliy/payments/internal/catalog"
+	"github.com/fedoseev-vitaliy/payments/internal/faults"
+	"github.com/fedoseev-vitaliy/payments/internal/idempotency"
+	"github.com/fedoseev-vitaliy/payments/internal/ledger"
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/notify"
 	"github.com/fedoseev-vitaliy/payments/internal/server"
-	"github.com/fedoseev-vitaliy/payments/internal/utils"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
 )
 
 var cfg Config
@@ -33,33 +36,141 @@ var Cmd = &cobra.Command{
 	Short: "Simple payments API",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		bindEnv(cmd)
+		if err := cfg.Load(cmd.Flags()); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := cfg.Validate(); err != nil {
+			return errors.WithStack(err)
+		}
+
 		addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 		l := logrus.New()
 		l.SetFormatter(&logrus.JSONFormatter{})
 
 		l.Infof("Starting server: %s", addr)
-		apMock := utils.NewTestTLSServer(&apay.MockAPay{})
-		aURL, err := url.Parse(apMock.URL)
+		if cfg.MockProviders {
+			l.Info("starting providers mocks")
+			for _, m := range startMocks(&cfg) {
+				defer m.Close()
+			}
+		}
+
+		inj, err := faults.New(cfg.Faults, l)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if cfg.Faults.Enabled {
+			l.Warn("faults injection is enabled")
+		}
+
+		m := metrics.New()
+		reg, breakers, err := newRegistry(&cfg, l, m, inj)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		tenants, tenantBreakers, err := newTenants(&cfg, reg, l, m, inj)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		proxies, err := cfg.trustedProxies()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		products, err := newCatalog(&cfg)
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		gpMock := utils.NewTestTLSServer(&gpay.MockGPay{})
-		gURL, err := url.Parse(gpMock.URL)
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		go func() {
+			for range hup {
+				if err := products.Reload(); err != nil {
+					l.WithError(err).Error("failed to reload products catalog")
+					continue
+				}
+				l.Infof("products catalog reloaded: %d products", products.Len())
+			}
+		}()
+
+		repo, closeRepo, err := newSessionsRepository(&cfg)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		defer func() {
+			if err := closeRepo(); err != nil {
+				l.WithError(err).Error("failed to close sessions store")
+			}
+		}()
+
+		subscriptions := func(string) []*notify.Subscription { return nil }
+		if tenants != nil {
+			subscriptions = tenants.Subscriptions
+		}
+		dispatcher := notify.NewDispatcher(l, m, cfg.MerchantWebhooks, subscriptions)
+		defer func() {
+			// the last attempt of pending deliveries after in-flight requests are completed
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.MerchantWebhooks.Timeout)
+			defer cancel()
+			dispatcher.Close(ctx)
+		}()
 
-		srv := server.NewServer(l, addr, aURL, gURL)
+		store, closeLedger, err := newLedgerStore(&cfg)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer func() {
+			if err := closeLedger(); err != nil {
+				l.WithError(err).Error("failed to close ledger store")
+			}
+		}()
+		book := ledger.New(store)
+
+		sessions := session.NewService(repo, cfg.SessionTTL)
+		sessions.OnTransition(dispatcher.Notify)
+		recorder := ledger.NewRecorder(book, cfg.fees())
+		defer func() {
+			if err := recorder.Close(context.Background()); err != nil {
+				l.WithError(err).Error("failed to close ledger recorder")
+			}
+		}()
+		sessions.OnTransition(recorder.Record)
+
+		srv := server.NewServer(l, addr, reg, server.Options{
+			PartialResponses: cfg.PartialResponses,
+			Breakers:         append(breakers, tenantBreakers...),
+			Metrics:          m,
+			Validation:       server.ValidationMode(cfg.APIValidation),
+			StoreURLs:        &cfg.StoreURLs,
+			Catalog:          products,
+			Faults:           inj,
+			AdminToken:       cfg.AdminToken,
+			Tenants:          tenants,
+			AuthRequired:     cfg.AuthRequired,
+			AuthMaxSkew:      cfg.AuthMaxSkew,
+			ClientRateLimit:  cfg.RateLimit,
+			TrustedProxies:   proxies,
+			Sessions:         sessions,
+			Webhooks:         newWebhooks(&cfg),
+			WebhookMaxSkew:   cfg.WebhookMaxSkew,
+			Deliveries:       dispatcher,
+			Idempotency:      idempotency.NewMemoryStore(cfg.IdempotencyTTL),
+			Ledger:           book,
+		})
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 
+		done := make(chan struct{})
 		go func() {
+			defer close(done)
 			<-quit
 
-			defer func() {
-				apMock.Close()
-				gpMock.Close()
-			}()
+			l.Infof("draining server for %s...", cfg.ShutdownDelay)
+			srv.Drain()
+			time.Sleep(cfg.ShutdownDelay)
 
 			l.Info("gracefully shutdown server...")
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -76,15 +187,56 @@ var Cmd = &cobra.Command{
 			return errors.WithStack(err)
 		}
 
+		// wait in-flight requests before mocks are closed
+		<-done
 		return nil
 	},
 }
 
+// newCatalog load products catalog file. Mock products are used if file isn't set
+func newCatalog(c *Config) (*catalog.Catalog, error) {
+	if c.CatalogFile == "" {
+		return catalog.New(mockProducts)
+	}
+
+	products, err := catalog.Load(c.CatalogFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load products catalog")
+	}
+	return products, nil
+}
+
+// newSessionsRepository construct configured payment sessions store and its close func
+func newSessionsRepository(c *Config) (session.Repository, func() error, error) {
+	if c.SessionsStore != sessionsStoreFile {
+		return session.NewMemoryRepository(), func() error { return nil }, nil
+	}
+
+	r, err := session.OpenFileRepository(c.SessionsFile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open sessions file")
+	}
+	return r, r.Close, nil
+}
+
+// newLedgerStore construct configured ledger transactions store and its close func
+func newLedgerStore(c *Config) (ledger.Store, func() error, error) {
+	if c.LedgerStore != ledgerStoreFile {
+		return ledger.NewMemoryStore(), func() error { return nil }, nil
+	}
+
+	s, err := ledger.OpenFileStore(c.LedgerFile)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to open ledger file")
+	}
+	return s, s.Close, nil
+}
+
 // bindEnv get config values from environment variables
 // if no env params than cobra with try to take it from arguments otherwise defaults will be used
 func bindEnv(cmd *cobra.Command) {
 	cmd.Flags().VisitAll(func(f *pflag.Flag) {
-		envVar := strings.ToUpper(f.Name)
+		envVar := strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
 
 		if val := os.Getenv(envVar); val != "" {
 			if err := cmd.Flags().Set(f.Name, val); err != nil {
@@ -1,12 +1,120 @@
 package server
 
 import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+
+	"github.com/fedoseev-vitaliy/payments/internal/fallback"
+	"github.com/fedoseev-vitaliy/payments/internal/faults"
+	"github.com/fedoseev-vitaliy/payments/internal/idempotency"
+	"github.com/fedoseev-vitaliy/payments/internal/ledger"
+	"github.com/fedoseev-vitaliy/payments/internal/notify"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/apay"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/breaker"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/cache"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/gpay"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/limiter"
+	"github.com/fedoseev-vitaliy/payments/internal/ratelimit"
+	"github.com/fedoseev-vitaliy/payments/internal/server"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
 )
 
+// payment sessions stores
+const (
+	sessionsStoreMemory = "memory"
+	sessionsStoreFile   = "file"
+)
+
+// ledger transactions stores
+const (
+	ledgerStoreMemory = "memory"
+	ledgerStoreFile   = "file"
+)
+
+// providerNames supported payment providers in registration order
+var providerNames = []string{apay.Name, gpay.Name}
+
 type Config struct {
 	Host string
 	Port int
+
+	PartialResponses bool
+	MockProviders    bool
+	ConfigFile       string
+	CatalogFile      string
+	ShutdownDelay    time.Duration
+	APIValidation    string
+	AdminToken       string
+	AuthRequired     bool
+	AuthMaxSkew      time.Duration
+	RateLimit        ratelimit.Config
+	TrustedProxies   []string
+	SessionsStore    string
+	SessionsFile     string
+	SessionTTL       time.Duration
+	LedgerStore      string
+	LedgerFile       string
+	WebhookMaxSkew   time.Duration
+	IdempotencyTTL   time.Duration
+
+	Faults    faults.Config
+	StoreURLs fallback.Config
+	// MerchantWebhooks merchants webhooks deliveries config
+	MerchantWebhooks notify.Config
+	Providers        map[string]*ProviderConfig
+
+	// Tenants merchants served by the service. Every request is served by the only default tenant if empty
+	Tenants []*TenantConfig
+	// DefaultTenant id of tenant serving requests matching no tenant. Such requests are rejected if empty
+	DefaultTenant string
+}
+
+// TenantConfig tenant configuration
+type TenantConfig struct {
+	tenant.Tenant
+
+	// ProviderSettings tenant providers settings overriding global provider config, e.g. credentials.
+	// Provider without settings shares global provider client. Every configured provider is used if empty
+	ProviderSettings map[string]json.RawMessage `json:"providers"`
+}
+
+// ProviderConfig payment provider client configuration
+type ProviderConfig struct {
+	URL     string            `json:"url"`
+	Timeout utils.Duration    `json:"timeout"`
+	TLS     utils.TLSConfig   `json:"tls"`
+	Retry   utils.RetryPolicy `json:"retry"`
+	Breaker breaker.Config    `json:"breaker"`
+	Cache   cache.Config      `json:"cache"`
+	// RateLimit outbound calls rate limit to stay under provider quota
+	RateLimit limiter.Config `json:"rate_limit"`
+	// WebhookSecret secret provider signs webhooks with. Provider webhooks are rejected if empty
+	WebhookSecret string `json:"webhook_secret"`
+	// Fee provider fee of captured payments posted to ledger
+	Fee ledger.Fee `json:"fee"`
+
+	// mockCert in-process mock certificate to trust
+	mockCert *x509.Certificate
+}
+
+// fileConfig config file structure
+type fileConfig struct {
+	Faults        json.RawMessage            `json:"faults"`
+	StoreURLs     json.RawMessage            `json:"store_urls"`
+	Providers     map[string]json.RawMessage `json:"providers"`
+	Tenants       []*TenantConfig            `json:"tenants"`
+	DefaultTenant string                     `json:"default_tenant"`
 }
 
 // Flags define default flag set
@@ -15,6 +123,358 @@ func (c *Config) Flags() *pflag.FlagSet {
 
 	f.StringVar(&c.Host, "host", "0.0.0.0", "ip host")
 	f.IntVar(&c.Port, "port", 80, "port")
+	f.BoolVar(&c.PartialResponses, "partial-responses", false, "return urls of succeeded providers even if other providers failed")
+	f.BoolVar(&c.MockProviders, "mock-providers", false, "start in-process providers mocks and use them instead of providers urls")
+	f.StringVar(&c.CatalogFile, "catalog", "", "path to json or yaml (.yaml, .yml) products catalog file. Catalog is reloaded on SIGHUP")
+	f.DurationVar(&c.ShutdownDelay, "shutdown-delay", 5*time.Second, "how long server reports not ready before graceful shutdown to let load balancers drain it")
+	f.StringVar(&c.APIValidation, "api-validation", string(server.ValidationOff), "validate requests and responses against OpenAPI spec: off, log or strict. Responses are buffered unless it's off")
+	f.StringVar(&c.AdminToken, "admin-token", "", "bearer token of admin endpoints. Admin endpoints are disabled if empty")
+	f.BoolVar(&c.AuthRequired, "auth-required", false, "reject payments requests without tenant api key or HMAC signature")
+	f.DurationVar(&c.AuthMaxSkew, "auth-max-skew", server.DefaultAuthMaxSkew, "max difference between HMAC signed request timestamp and server time")
+	f.Float64Var(&c.RateLimit.RPS, "rate-limit-rps", 0, "payments requests per second per api key or client ip. Unlimited if 0")
+	f.IntVar(&c.RateLimit.Burst, "rate-limit-burst", 0, "payments requests burst per api key or client ip. Rps rounded up is used if 0")
+	f.StringSliceVar(&c.TrustedProxies, "trusted-proxies", nil, "ips or cidrs of proxies whose X-Forwarded-For header is trusted to find client ip")
+	f.StringVar(&c.SessionsStore, "sessions-store", sessionsStoreMemory, "payment sessions store: memory or file. Memory sessions are lost on restart")
+	f.StringVar(&c.SessionsFile, "sessions-file", "sessions.jsonl", "path to payment sessions file of file store")
+	f.DurationVar(&c.SessionTTL, "session-ttl", session.DefaultTTL, "time to complete payment session before it expires")
+	f.StringVar(&c.LedgerStore, "ledger-store", ledgerStoreMemory, "ledger transactions store: memory or file. Memory transactions are lost on restart")
+	f.StringVar(&c.LedgerFile, "ledger-file", "ledger.jsonl", "path to ledger transactions file of file store")
+	f.DurationVar(&c.WebhookMaxSkew, "webhook-max-skew", server.DefaultWebhookMaxSkew, "max difference between provider webhook signature timestamp and server time")
+	f.DurationVar(&c.IdempotencyTTL, "idempotency-ttl", idempotency.DefaultTTL, "time responses of requests with Idempotency-Key header are replayed for")
+	c.MerchantWebhooks = notify.DefaultConfig()
+	f.IntVar(&c.MerchantWebhooks.Retry.MaxAttempts, "merchant-webhooks-max-attempts", c.MerchantWebhooks.Retry.MaxAttempts, "merchant webhook delivery attempts before delivery is dead")
+	f.DurationVar((*time.Duration)(&c.MerchantWebhooks.Retry.BaseBackoff), "merchant-webhooks-base-backoff", time.Duration(c.MerchantWebhooks.Retry.BaseBackoff), "wait before the first merchant webhook delivery retry, doubled for every next retry")
+	f.DurationVar((*time.Duration)(&c.MerchantWebhooks.Retry.MaxBackoff), "merchant-webhooks-max-backoff", time.Duration(c.MerchantWebhooks.Retry.MaxBackoff), "max wait between merchant webhook delivery retries")
+	f.DurationVar(&c.MerchantWebhooks.Timeout, "merchant-webhooks-timeout", c.MerchantWebhooks.Timeout, "merchant webhook response timeout")
+	f.IntVar(&c.MerchantWebhooks.Workers, "merchant-webhooks-workers", c.MerchantWebhooks.Workers, "max number of concurrent merchant webhooks deliveries")
+	f.IntVar(&c.MerchantWebhooks.MaxDeliveries, "merchant-webhooks-log-size", c.MerchantWebhooks.MaxDeliveries, "max number of merchant webhooks deliveries kept in log")
+	f.BoolVar(&c.Faults.Enabled, "faults-enabled", false, "inject faults configured in config file or by admin endpoint. Never use it in production")
+	f.StringVar(&c.ConfigFile, "config", "", "path to json config file. Flags and env variables take precedence over it")
+
+	c.StoreURLs = fallback.DefaultConfig()
+	c.Providers = make(map[string]*ProviderConfig, len(providerNames))
+	for _, name := range providerNames {
+		pc := &ProviderConfig{}
+		c.Providers[name] = pc
+
+		f.StringVar(&pc.URL, name+"-url", "", name+" provider base url")
+		f.DurationVar((*time.Duration)(&pc.Timeout), name+"-timeout", 5*time.Second, name+" provider request timeout")
+		f.StringVar(&pc.TLS.CAFile, name+"-tls-ca-file", "", name+" provider PEM encoded CA bundle file. System roots are used if empty")
+		f.BoolVar(&pc.TLS.SystemRoots, name+"-tls-system-roots", false, name+" provider trust system roots in addition to CA bundle file")
+		f.StringVar(&pc.TLS.CertFile, name+"-tls-cert-file", "", name+" provider PEM encoded client certificate file for mutual tls")
+		f.StringVar(&pc.TLS.KeyFile, name+"-tls-key-file", "", name+" provider PEM encoded client key file for mutual tls")
+		f.StringVar(&pc.TLS.MinVersion, name+"-tls-min-version", "1.2", name+" provider minimal tls version")
+		f.StringVar(&pc.TLS.ServerName, name+"-tls-server-name", "", name+" provider expected server certificate name")
+		f.BoolVar(&pc.TLS.InsecureSkipVerify, name+"-tls-insecure", false, name+" provider skip server certificate verification. Never use it in production")
+		f.IntVar(&pc.Retry.MaxAttempts, name+"-retry-max-attempts", 1, name+" provider max request attempts. Retries are disabled if less than 2")
+		f.DurationVar((*time.Duration)(&pc.Retry.BaseBackoff), name+"-retry-base-backoff", 100*time.Millisecond, name+" provider wait before first retry")
+		f.DurationVar((*time.Duration)(&pc.Retry.MaxBackoff), name+"-retry-max-backoff", time.Second, name+" provider max wait between retries")
+		f.Float64Var(&pc.Retry.Jitter, name+"-retry-jitter", 0.2, name+" provider fraction of backoff randomized")
+		f.IntSliceVar(&pc.Retry.RetryableStatusCodes, name+"-retry-status-codes", append([]int(nil), utils.DefaultRetryableStatusCodes...), name+" provider retryable response status codes")
+		f.Float64Var(&pc.Breaker.FailureRate, name+"-breaker-failure-rate", 0.5, name+" provider failed calls rate to open circuit breaker. Breaker is disabled if 0")
+		f.IntVar(&pc.Breaker.WindowSize, name+"-breaker-window-size", 20, name+" provider number of last calls to calculate failure rate")
+		f.IntVar(&pc.Breaker.MinRequests, name+"-breaker-min-requests", 10, name+" provider min number of calls before failure rate is checked")
+		f.DurationVar((*time.Duration)(&pc.Breaker.OpenTimeout), name+"-breaker-open-timeout", 30*time.Second, name+" provider how long circuit breaker stays open before probe calls")
+		f.IntVar(&pc.Breaker.HalfOpenRequests, name+"-breaker-half-open-requests", 1, name+" provider number of successful probe calls to close circuit breaker")
+		f.DurationVar((*time.Duration)(&pc.Cache.TTL), name+"-cache-ttl", time.Minute, name+" provider how long pay urls are cached. Cache is disabled if 0")
+		f.DurationVar((*time.Duration)(&pc.Cache.NegativeTTL), name+"-cache-negative-ttl", 10*time.Second, name+" provider how long not ok responses are cached. Not cached if 0")
+		f.IntVar(&pc.Cache.MaxEntries, name+"-cache-max-entries", 10000, name+" provider max number of cached products. Unlimited if 0")
+		f.Float64Var(&pc.RateLimit.RPS, name+"-rate-limit-rps", 0, name+" provider calls per second. Unlimited if 0")
+		f.IntVar(&pc.RateLimit.Burst, name+"-rate-limit-burst", 0, name+" provider calls burst. Rps rounded up is used if 0")
+		f.DurationVar((*time.Duration)(&pc.RateLimit.MaxWait), name+"-rate-limit-max-wait", 100*time.Millisecond, name+" provider how long call may wait for rate limit")
+		f.StringVar(&pc.WebhookSecret, name+"-webhook-secret", "", name+" provider webhooks signing secret. Webhooks are rejected if empty")
+		f.Int64Var(&pc.Fee.RateBPS, name+"-fee-rate-bps", 0, name+" provider fee of captured payments in basis points, e.g. 290 is 2.9%")
+		f.Int64Var(&pc.Fee.Fixed, name+"-fee-fixed", 0, name+" provider fixed fee of captured payments in payment currency minor units")
+	}
 
 	return f
 }
+
+// Load read config file if any. Values set by flags or env variables are kept
+func (c *Config) Load(fs *pflag.FlagSet) error {
+	if c.ConfigFile == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(c.ConfigFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fc := &fileConfig{}
+	if err := json.Unmarshal(b, fc); err != nil {
+		return errors.Wrapf(err, "failed to parse config file %s", c.ConfigFile)
+	}
+
+	// remember explicitly set flags to restore them over config file values.
+	// Slice flags are replaced, their Set appends to changed value and String isn't parsable
+	var restore []func() error
+	fs.Visit(func(f *pflag.Flag) {
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			vals := sv.GetSlice()
+			restore = append(restore, func() error { return sv.Replace(vals) })
+			return
+		}
+		name, val := f.Name, f.Value.String()
+		restore = append(restore, func() error { return fs.Set(name, val) })
+	})
+
+	if len(fc.Faults) != 0 {
+		if err := json.Unmarshal(fc.Faults, &c.Faults); err != nil {
+			return errors.Wrap(err, "failed to parse faults config")
+		}
+	}
+
+	// configured apps replace default one
+	if len(fc.StoreURLs) != 0 {
+		sc := fallback.Config{}
+		if err := json.Unmarshal(fc.StoreURLs, &sc); err != nil {
+			return errors.Wrap(err, "failed to parse store urls config")
+		}
+		c.StoreURLs = sc
+	}
+
+	c.Tenants = fc.Tenants
+	c.DefaultTenant = fc.DefaultTenant
+
+	for name, raw := range fc.Providers {
+		pc, ok := c.Providers[name]
+		if !ok {
+			return errors.Errorf("unknown provider %s in config file", name)
+		}
+
+		if err := json.Unmarshal(raw, pc); err != nil {
+			return errors.Wrapf(err, "failed to parse %s provider config", name)
+		}
+	}
+
+	for _, r := range restore {
+		if err := r(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Validate check config values
+func (c *Config) Validate() error {
+	if !server.ValidationMode(c.APIValidation).Valid() {
+		return errors.Errorf("unknown api validation mode %q", c.APIValidation)
+	}
+
+	if err := c.StoreURLs.Validate(); err != nil {
+		return errors.Wrap(err, "invalid store urls config")
+	}
+
+	if err := c.Faults.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, r := range c.Faults.Rules {
+		if _, ok := c.Providers[r.Provider]; r.Provider != "" && !ok {
+			return errors.Errorf("unknown provider %s in faults rules", r.Provider)
+		}
+	}
+
+	configured := 0
+	for _, name := range providerNames {
+		pc := c.Providers[name]
+		if err := pc.validate(name); err != nil {
+			return errors.WithStack(err)
+		}
+		if pc.URL != "" {
+			configured++
+		}
+	}
+
+	if configured == 0 && !c.MockProviders {
+		return errors.New("no payment providers configured. Set providers urls or use --mock-providers")
+	}
+	if c.CatalogFile == "" && !c.MockProviders {
+		return errors.New("no products catalog configured. Set catalog file or use --mock-providers")
+	}
+
+	if err := c.RateLimit.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := c.trustedProxies(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if c.AuthMaxSkew <= 0 {
+		return errors.New("auth max skew should be positive")
+	}
+
+	switch c.SessionsStore {
+	case sessionsStoreMemory:
+	case sessionsStoreFile:
+		if c.SessionsFile == "" {
+			return errors.New("sessions file is required by file sessions store")
+		}
+	default:
+		return errors.Errorf("unknown sessions store %q", c.SessionsStore)
+	}
+	switch c.LedgerStore {
+	case ledgerStoreMemory:
+	case ledgerStoreFile:
+		if c.LedgerFile == "" {
+			return errors.New("ledger file is required by file ledger store")
+		}
+	default:
+		return errors.Errorf("unknown ledger store %q", c.LedgerStore)
+	}
+	if c.SessionTTL <= 0 {
+		return errors.New("session ttl should be positive")
+	}
+	if c.WebhookMaxSkew <= 0 {
+		return errors.New("webhook max skew should be positive")
+	}
+	if c.IdempotencyTTL <= 0 {
+		return errors.New("idempotency ttl should be positive")
+	}
+	if err := c.MerchantWebhooks.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	credentials := false
+	for _, tc := range c.Tenants {
+		credentials = credentials || len(tc.APIKeys) != 0 || len(tc.HMACKeys) != 0
+		if err := tc.Validate(); err != nil {
+			return errors.WithStack(err)
+		}
+		for name := range tc.ProviderSettings {
+			if _, ok := c.Providers[name]; !ok {
+				return errors.Errorf("tenant %s unknown provider %s", tc.ID, name)
+			}
+		}
+
+		for _, name := range tc.providerNames() {
+			pc, err := c.tenantProvider(tc, name)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if err := pc.validate(tc.ID + "/" + name); err != nil {
+				return errors.WithStack(err)
+			}
+			if pc.URL == "" && !c.MockProviders {
+				return errors.Errorf("tenant %s provider %s url isn't configured", tc.ID, name)
+			}
+			// webhooks are received by provider route, not by tenant
+			if pc.WebhookSecret != c.Providers[name].WebhookSecret {
+				return errors.Errorf("tenant %s provider %s webhook secret can't be overridden", tc.ID, name)
+			}
+			// payments are posted to ledger with provider fee
+			if pc.Fee != c.Providers[name].Fee {
+				return errors.Errorf("tenant %s provider %s fee can't be overridden", tc.ID, name)
+			}
+		}
+	}
+
+	if c.AuthRequired && !credentials {
+		return errors.New("auth is required but no tenant has api keys or hmac keys")
+	}
+
+	return nil
+}
+
+// validate check provider config values
+func (pc *ProviderConfig) validate(name string) error {
+	if pc.Timeout <= 0 {
+		return errors.Errorf("%s provider timeout should be positive", name)
+	}
+
+	if pc.Retry.Jitter < 0 || pc.Retry.Jitter > 1 {
+		return errors.Errorf("%s provider retry jitter should be from 0 to 1", name)
+	}
+
+	if pc.Breaker.FailureRate < 0 || pc.Breaker.FailureRate > 1 {
+		return errors.Errorf("%s provider breaker failure rate should be from 0 to 1", name)
+	}
+
+	if pc.Cache.TTL < 0 || pc.Cache.NegativeTTL < 0 || pc.Cache.MaxEntries < 0 {
+		return errors.Errorf("%s provider cache ttl and max entries should not be negative", name)
+	}
+
+	if err := pc.RateLimit.Validate(); err != nil || pc.RateLimit.MaxWait < 0 {
+		return errors.Errorf("%s provider rate limit and max wait should not be negative", name)
+	}
+
+	if err := pc.Fee.Validate(); err != nil {
+		return errors.Wrapf(err, "%s provider", name)
+	}
+
+	if pc.URL == "" {
+		return nil
+	}
+
+	u, err := url.Parse(pc.URL)
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s provider url", name)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Errorf("%s provider url should be http or https", name)
+	}
+
+	return nil
+}
+
+// trustedProxies parse trusted proxies ips and cidrs
+func (c *Config) trustedProxies() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(c.TrustedProxies))
+	for _, p := range c.TrustedProxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy %s", p)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// fees return providers fees by provider name
+func (c *Config) fees() map[string]ledger.Fee {
+	fees := make(map[string]ledger.Fee, len(c.Providers))
+	for name, pc := range c.Providers {
+		fees[name] = pc.Fee
+	}
+	return fees
+}
+
+// providerNames return names of providers listed in tenant config in registration order.
+// Empty if tenant uses every configured provider
+func (tc *TenantConfig) providerNames() []string {
+	names := make([]string, 0, len(tc.ProviderSettings))
+	for _, name := range providerNames {
+		if _, ok := tc.ProviderSettings[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// tenantProvider return global provider config overridden by tenant provider settings
+func (c *Config) tenantProvider(tc *TenantConfig, name string) (*ProviderConfig, error) {
+	pc := *c.Providers[name]
+	// unmarshal reuses slices backing arrays, keep global config intact
+	pc.Retry.RetryableStatusCodes = append([]int(nil), pc.Retry.RetryableStatusCodes...)
+	if overrides(tc.ProviderSettings[name]) {
+		if err := json.Unmarshal(tc.ProviderSettings[name], &pc); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse tenant %s provider %s config", tc.ID, name)
+		}
+	}
+	return &pc, nil
+}
+
+// overrides check that provider settings override any global provider config value
+func overrides(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) != 0 && !bytes.Equal(raw, []byte("null")) && !bytes.Equal(raw, []byte("{}"))
+}
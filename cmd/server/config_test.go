@@ -0,0 +1,92 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// writeConfigFile write config file to new temp dir and return its path
+func writeConfigFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfig_LoadSliceFlags(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfigFile(t, `{"providers": {"apay": {"timeout": "3s", "retry": {"max_attempts": 3, "retryable_status_codes": [502]}}}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    []int
+		timeout time.Duration
+	}{
+		{name: "config file", args: []string{"--config", path}, want: []int{502}, timeout: 3 * time.Second},
+		{
+			name:    "flag",
+			args:    []string{"--config", path, "--apay-retry-status-codes", "503", "--apay-timeout", "5s"},
+			want:    []int{503},
+			timeout: 5 * time.Second,
+		},
+		{name: "repeated flag", args: []string{"--config", path, "--apay-retry-status-codes", "503", "--apay-retry-status-codes", "504"}, want: []int{503, 504}, timeout: 3 * time.Second},
+		{name: "env", args: []string{"--config", path}, env: map[string]string{"apay-retry-status-codes": "503,504"}, want: []int{503, 504}, timeout: 3 * time.Second},
+	}
+	for _, tt := range tests {
+		var c Config
+		fs := c.Flags()
+		require.NoError(t, fs.Parse(tt.args), tt.name)
+		// env variables are set like bindEnv does
+		for name, val := range tt.env {
+			require.NoError(t, fs.Set(name, val), tt.name)
+		}
+
+		require.NoError(t, c.Load(fs), tt.name)
+		require.Equal(t, tt.want, c.Providers["apay"].Retry.RetryableStatusCodes, tt.name)
+		require.Equal(t, utils.Duration(tt.timeout), c.Providers["apay"].Timeout, tt.name)
+		require.Equal(t, 3, c.Providers["apay"].Retry.MaxAttempts, tt.name)
+	}
+}
+
+func TestConfig_LoadTrustedProxies(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfigFile(t, `{"providers": {}}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		{name: "flag", args: []string{"--config", path, "--trusted-proxies", "10.0.0.1"}, want: []string{"10.0.0.1"}},
+		{name: "list", args: []string{"--config", path, "--trusted-proxies", "10.0.0.1,192.168.0.0/16"}, want: []string{"10.0.0.1", "192.168.0.0/16"}},
+		{name: "env", args: []string{"--config", path}, env: map[string]string{"trusted-proxies": "10.0.0.1,10.0.0.2"}, want: []string{"10.0.0.1", "10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		var c Config
+		fs := c.Flags()
+		require.NoError(t, fs.Parse(tt.args), tt.name)
+		for name, val := range tt.env {
+			require.NoError(t, fs.Set(name, val), tt.name)
+		}
+
+		require.NoError(t, c.Load(fs), tt.name)
+		require.Equal(t, tt.want, c.TrustedProxies, tt.name)
+		nets, err := c.trustedProxies()
+		require.NoError(t, err, tt.name)
+		require.Len(t, nets, len(tt.want), tt.name)
+	}
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/catalog"
+	"github.com/fedoseev-vitaliy/payments/internal/faults"
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/apay"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/breaker"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/cache"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/gpay"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/limiter"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// providerFactory construct payment provider client
+type providerFactory func(cli *utils.Client, u *url.URL) providers.Provider
+
+// providerFactories payment providers constructors by provider name
+var providerFactories = map[string]providerFactory{
+	apay.Name: func(cli *utils.Client, u *url.URL) providers.Provider { return apay.New(cli, u) },
+	gpay.Name: func(cli *utils.Client, u *url.URL) providers.Provider { return gpay.New(cli, u) },
+}
+
+// providerPlatforms platforms payment providers are eligible for by provider name
+var providerPlatforms = map[string][]providers.Platform{
+	apay.Name: apay.Platforms,
+	gpay.Name: gpay.Platforms,
+}
+
+// providerWebhooks payment providers webhooks verifiers constructors by provider name
+var providerWebhooks = map[string]func(secret string) providers.WebhookVerifier{
+	apay.Name: func(secret string) providers.WebhookVerifier { return apay.NewWebhookVerifier(secret) },
+	gpay.Name: func(secret string) providers.WebhookVerifier { return gpay.NewWebhookVerifier(secret) },
+}
+
+// providerMocks in-process payment providers mocks by provider name
+var providerMocks = map[string]http.Handler{
+	apay.Name: &apay.MockAPay{},
+	gpay.Name: &gpay.MockGPay{},
+}
+
+// mockProducts products catalog used with providers mocks if catalog file isn't set
+var mockProducts = []*catalog.Product{
+	{ID: "1", Title: "Premium subscription", Price: 999, Currency: "USD", Available: true},
+	{ID: "2", Title: "Coins pack", Price: 499, Currency: "USD", Available: true},
+	{ID: "3", Title: "Lifetime license", Price: 4999, Currency: "EUR", Available: true},
+}
+
+// startMocks start in-process providers mocks and point providers config to them.
+// Mocks certificates are trusted by providers clients
+func startMocks(cfg *Config) []*httptest.Server {
+	mocks := make([]*httptest.Server, 0, len(providerNames))
+	for _, name := range providerNames {
+		srv := utils.NewTestTLSServer(providerMocks[name])
+		mocks = append(mocks, srv)
+
+		pc := cfg.Providers[name]
+		pc.URL = srv.URL
+		pc.TLS = utils.TLSConfig{}
+		pc.mockCert = srv.Certificate()
+	}
+	return mocks
+}
+
+// newRegistry construct providers registry from configured providers.
+// Every provider is instrumented with metrics, wrapped with circuit breaker, outbound rate limiter and pay urls cache.
+// Provider faults are injected into providers requests
+func newRegistry(cfg *Config, l *logrus.Logger, m *metrics.Metrics, inj *faults.Injector) (*providers.Registry, []*breaker.Breaker, error) {
+	reg := providers.NewRegistry()
+	breakers := make([]*breaker.Breaker, 0, len(providerNames))
+	for _, name := range providerNames {
+		pc := cfg.Providers[name]
+		if pc.URL == "" {
+			continue
+		}
+
+		p, b, err := newProvider(name, name, pc, l, m, inj)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		if err := reg.Register(name, p, providerPlatforms[name]...); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		breakers = append(breakers, b)
+	}
+
+	return reg, breakers, nil
+}
+
+// newProvider construct provider client wrapped with circuit breaker and outbound rate limiter, instrumented with metrics
+// and wrapped with pay urls cache. Calls rejected by breaker or limiter are collected by metrics, cache hits aren't.
+// Instance names provider client in metrics and breakers status, name is provider name
+func newProvider(instance, name string, pc *ProviderConfig, l *logrus.Logger, m *metrics.Metrics, inj *faults.Injector) (providers.Provider, *breaker.Breaker, error) {
+	u, err := url.Parse(pc.URL)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	tc, err := pc.tlsConfig()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid %s provider tls config", instance)
+	}
+
+	cli := utils.NewClient(time.Duration(pc.Timeout),
+		utils.WithTLSConfig(tc),
+		utils.WithRetryPolicy(pc.Retry),
+		utils.WithRoundTripper(func(rt http.RoundTripper) http.RoundTripper { return inj.RoundTripper(name, rt) }),
+	)
+	b := breaker.New(instance, providers.Recover(providerFactories[name](cli, u)), pc.Breaker, l)
+	p := m.InstrumentProvider(instance, limiter.New(instance, b, pc.RateLimit, m))
+	return cache.New(instance, p, pc.Cache, m), b, nil
+}
+
+// newTenants construct resolver of configured tenants. Tenant provider without settings shares registry provider,
+// provider with settings is a separate client named "<tenant>/<provider>" in metrics and breakers status.
+// Resolver is nil if tenants aren't configured
+func newTenants(cfg *Config, reg *providers.Registry, l *logrus.Logger, m *metrics.Metrics, inj *faults.Injector) (*tenant.Resolver, []*breaker.Breaker, error) {
+	if len(cfg.Tenants) == 0 {
+		return nil, nil, nil
+	}
+
+	var breakers []*breaker.Breaker
+	tenants := make([]*tenant.Tenant, 0, len(cfg.Tenants))
+	for _, tc := range cfg.Tenants {
+		t := tc.Tenant
+		t.Providers = providers.NewRegistry()
+		if _, ok := t.Features[tenant.FeaturePartialResponses]; !ok {
+			features := map[string]bool{tenant.FeaturePartialResponses: cfg.PartialResponses}
+			for name, on := range t.Features {
+				features[name] = on
+			}
+			t.Features = features
+		}
+
+		names := tc.providerNames()
+		if len(names) == 0 {
+			names = reg.Names()
+		}
+		for _, name := range names {
+			var p providers.Provider
+			if overrides(tc.ProviderSettings[name]) {
+				pc, err := cfg.tenantProvider(tc, name)
+				if err != nil {
+					return nil, nil, errors.WithStack(err)
+				}
+
+				var b *breaker.Breaker
+				p, b, err = newProvider(t.ID+"/"+name, name, pc, l, m, inj)
+				if err != nil {
+					return nil, nil, errors.WithStack(err)
+				}
+				breakers = append(breakers, b)
+			} else {
+				var ok bool
+				if p, ok = reg.Get(name); !ok {
+					return nil, nil, errors.Errorf("tenant %s provider %s isn't configured", t.ID, name)
+				}
+			}
+
+			if err := t.Providers.Register(name, p, providerPlatforms[name]...); err != nil {
+				return nil, nil, errors.WithStack(err)
+			}
+		}
+		tenants = append(tenants, &t)
+	}
+
+	r, err := tenant.NewResolver(tenants, cfg.DefaultTenant)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return r, breakers, nil
+}
+
+// newWebhooks construct webhooks verifiers of providers with webhook secret
+func newWebhooks(cfg *Config) map[string]providers.WebhookVerifier {
+	verifiers := make(map[string]providers.WebhookVerifier, len(providerNames))
+	for _, name := range providerNames {
+		if secret := cfg.Providers[name].WebhookSecret; secret != "" {
+			verifiers[name] = providerWebhooks[name](secret)
+		}
+	}
+	return verifiers
+}
+
+// tlsConfig construct provider client tls config
+func (pc *ProviderConfig) tlsConfig() (*tls.Config, error) {
+	tc, err := pc.TLS.Build()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if pc.mockCert != nil {
+		tc.RootCAs = x509.NewCertPool()
+		tc.RootCAs.AddCert(pc.mockCert)
+	}
+
+	return tc, nil
+}
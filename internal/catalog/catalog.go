@@ -0,0 +1,190 @@
+package catalog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+var (
+	// ErrNotFound returned for product missing from catalog
+	ErrNotFound = errors.New("product not found")
+	// ErrUnavailable returned for product which isn't available for sale
+	ErrUnavailable = errors.New("product is unavailable")
+)
+
+// Product product sold by the service
+type Product struct {
+	ID    string `json:"id" yaml:"id"`
+	Title string `json:"title" yaml:"title"`
+	// Price in currency minor units, e.g. cents
+	Price int64 `json:"price" yaml:"price"`
+	// Currency ISO 4217 currency code
+	Currency string `json:"currency" yaml:"currency"`
+	// Available product is available for sale. True if missing
+	Available bool `json:"available" yaml:"available"`
+}
+
+// UnmarshalJSON decode product, product is available unless available is false
+func (p *Product) UnmarshalJSON(b []byte) error {
+	type product Product
+	pp := product{Available: true}
+	if err := json.Unmarshal(b, &pp); err != nil {
+		return err
+	}
+	*p = Product(pp)
+	return nil
+}
+
+// UnmarshalYAML decode product, product is available unless available is false
+func (p *Product) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type product Product
+	pp := product{Available: true}
+	if err := unmarshal(&pp); err != nil {
+		return err
+	}
+	*p = Product(pp)
+	return nil
+}
+
+// Validate check product values
+func (p *Product) Validate() error {
+	if p.ID == "" {
+		return errors.New("product id is required")
+	}
+	if p.Title == "" {
+		return errors.Errorf("product %s title is required", p.ID)
+	}
+	if p.Price <= 0 {
+		return errors.Errorf("product %s price should be positive", p.ID)
+	}
+	if _, err := money.ParseCurrency(p.Currency); err != nil {
+		return errors.Wrapf(err, "product %s currency", p.ID)
+	}
+	return nil
+}
+
+// Money return product price
+func (p *Product) Money() money.Money {
+	return money.New(p.Price, money.Currency(p.Currency))
+}
+
+// PaymentRequest return request of product payment
+func (p *Product) PaymentRequest() *providers.PaymentRequest {
+	return &providers.PaymentRequest{
+		ProductID:   p.ID,
+		Price:       p.Money(),
+		Description: p.Title,
+	}
+}
+
+// file catalog file format
+type file struct {
+	Products []*Product `json:"products" yaml:"products"`
+}
+
+// Catalog products by id. File catalog may be reloaded while it's used
+type Catalog struct {
+	path string
+
+	mu       sync.RWMutex
+	products map[string]*Product
+}
+
+// New construct catalog of products
+func New(products []*Product) (*Catalog, error) {
+	c := &Catalog{}
+	if err := c.set(products); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c, nil
+}
+
+// Load construct catalog of products listed in file at path, see Reload
+func Load(path string) (*Catalog, error) {
+	c := &Catalog{path: path}
+	if err := c.Reload(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c, nil
+}
+
+// Reload read catalog file again. Files with .yaml or .yml extension are YAML, others are JSON.
+// Catalog is kept unchanged if file is invalid. Catalog constructed by New has no file and is never changed
+func (c *Catalog) Reload() error {
+	if c.path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	unmarshal := json.Unmarshal
+	switch strings.ToLower(filepath.Ext(c.path)) {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	}
+
+	f := &file{}
+	if err := unmarshal(b, f); err != nil {
+		return errors.Wrapf(err, "failed to parse catalog file %s", c.path)
+	}
+	return errors.Wrapf(c.set(f.Products), "invalid catalog file %s", c.path)
+}
+
+// Product return available product by id
+func (c *Catalog) Product(id string) (*Product, error) {
+	c.mu.RLock()
+	p, ok := c.products[id]
+	c.mu.RUnlock()
+
+	switch {
+	case !ok:
+		return nil, errors.Wrapf(ErrNotFound, "product %s", id)
+	case !p.Available:
+		return nil, errors.Wrapf(ErrUnavailable, "product %s", id)
+	}
+	cp := *p
+	return &cp, nil
+}
+
+// Len return number of products
+func (c *Catalog) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.products)
+}
+
+// set validate products and replace catalog with them
+func (c *Catalog) set(products []*Product) error {
+	byID := make(map[string]*Product, len(products))
+	for i, p := range products {
+		if p == nil {
+			return errors.Errorf("product %d is null", i+1)
+		}
+		if err := p.Validate(); err != nil {
+			return errors.WithStack(err)
+		}
+		if _, ok := byID[p.ID]; ok {
+			return errors.Errorf("duplicate product %s", p.ID)
+		}
+		cp := *p
+		byID[p.ID] = &cp
+	}
+
+	c.mu.Lock()
+	c.products = byID
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,138 @@
+package catalog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+func TestCatalog_Load(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "catalog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "catalog.json")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"products": [
+		{"id": "1", "title": "Coins", "price": 999, "currency": "USD"},
+		{"id": "2", "title": "Retired pack", "price": 99, "currency": "USD", "available": false}
+	]}`), 0o600))
+
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, c.Len())
+
+	p, err := c.Product("1")
+	require.NoError(t, err)
+	require.Equal(t, &Product{ID: "1", Title: "Coins", Price: 999, Currency: "USD", Available: true}, p, "product is available by default")
+	require.Equal(t, &providers.PaymentRequest{ProductID: "1", Price: money.New(999, money.USD), Description: "Coins"}, p.PaymentRequest())
+
+	_, err = c.Product("2")
+	require.Equal(t, ErrUnavailable, errors.Cause(err))
+	_, err = c.Product("3")
+	require.Equal(t, ErrNotFound, errors.Cause(err))
+
+	// reload
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"products": [{"id": "3", "title": "Gems", "price": 1999, "currency": "EUR"}]}`), 0o600))
+	require.NoError(t, c.Reload())
+	require.Equal(t, 1, c.Len())
+	_, err = c.Product("1")
+	require.Equal(t, ErrNotFound, errors.Cause(err))
+	_, err = c.Product("3")
+	require.NoError(t, err)
+
+	// invalid file is ignored
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"products": [{"id": "4", "title": "Gems", "price": 0, "currency": "EUR"}]}`), 0o600))
+	require.Error(t, c.Reload())
+	_, err = c.Product("3")
+	require.NoError(t, err, "catalog is kept")
+
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+}
+
+func TestCatalog_LoadYAML(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "catalog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"catalog.yaml", "catalog.YML"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(`products:
+  - id: "1"
+    title: Coins
+    price: 999
+    currency: USD
+  - id: "2"
+    title: Retired pack
+    price: 99
+    currency: USD
+    available: false
+`), 0o600))
+
+		c, err := Load(path)
+		require.NoError(t, err, name)
+		p, err := c.Product("1")
+		require.NoError(t, err, name)
+		require.Equal(t, &Product{ID: "1", Title: "Coins", Price: 999, Currency: "USD", Available: true}, p, name)
+		_, err = c.Product("2")
+		require.Equal(t, ErrUnavailable, errors.Cause(err), name)
+	}
+
+	// json file isn't parsed as yaml
+	path := filepath.Join(dir, "catalog.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte("products: []"), 0o600))
+	_, err = Load(path)
+	require.Error(t, err)
+
+	path = filepath.Join(dir, "null.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("products: [~]"), 0o600))
+	_, err = Load(path)
+	require.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		products []*Product
+		wantErr  bool
+	}{
+		{name: "empty"},
+		{name: "valid", products: []*Product{{ID: "1", Title: "Coins", Price: 1, Currency: "USD"}}},
+		{name: "missing id", products: []*Product{{Title: "Coins", Price: 1, Currency: "USD"}}, wantErr: true},
+		{name: "missing title", products: []*Product{{ID: "1", Price: 1, Currency: "USD"}}, wantErr: true},
+		{name: "zero price", products: []*Product{{ID: "1", Title: "Coins", Currency: "USD"}}, wantErr: true},
+		{name: "null product", products: []*Product{nil}, wantErr: true},
+		{name: "invalid currency", products: []*Product{{ID: "1", Title: "Coins", Price: 1, Currency: "usd"}}, wantErr: true},
+		{
+			name: "duplicate id",
+			products: []*Product{
+				{ID: "1", Title: "Coins", Price: 1, Currency: "USD"},
+				{ID: "1", Title: "Gems", Price: 1, Currency: "USD"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		c, err := New(tt.products)
+		if tt.wantErr {
+			require.Error(t, err, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		require.Equal(t, len(tt.products), c.Len(), tt.name)
+		require.NoError(t, c.Reload(), "catalog without file isn't reloaded")
+	}
+}
@@ -1,16 +1,32 @@
 package controller
 
 import (
+	"context"
+
 	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
 )
 
 // Controller payment providers controller
 type Controller struct {
-	apay providers.Provider
-	gpay providers.Provider
+	providers *providers.Registry
+}
+
+// New construct payment provider controller.
+// Registry providers are used for requests without tenant or tenant without own providers
+func New(r *providers.Registry) *Controller {
+	return &Controller{providers: r}
+}
+
+// registry return providers of request tenant
+func (c *Controller) registry(ctx context.Context) *providers.Registry {
+	if t, ok := tenant.FromContext(ctx); ok && t.Providers != nil {
+		return t.Providers
+	}
+	return c.providers
 }
 
-// New construct payment provider controller
-func New(ap providers.Provider, gp providers.Provider) *Controller {
-	return &Controller{gpay: gp, apay: ap}
+// Provider return request tenant provider by name
+func (c *Controller) Provider(ctx context.Context, name string) (providers.Provider, bool) {
+	return c.registry(ctx).Get(name)
 }
@@ -2,47 +2,138 @@ package controller
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
 )
 
-// PaymentsURLs model to store providers payment urls
-type PaymentsURLs struct {
-	GPayURL string
-	APayURL string
-}
+// ErrNoProviders returned when there are no registered payment providers eligible for client platform
+var ErrNoProviders = errors.New("no payment providers registered")
+
+// PaymentsURLs model to store providers payment urls by provider name
+type PaymentsURLs map[string]string
+
+// GetPaymentsURL call request tenant providers eligible for platform to get payments urls of product payment
+func (c *Controller) GetPaymentsURL(ctx context.Context, req *providers.PaymentRequest, platform providers.Platform) (PaymentsURLs, error) {
+	reg := c.registry(ctx)
+	names := reg.Eligible(platform)
+	if len(names) == 0 {
+		return nil, errors.Wrapf(ErrNoProviders, "platform %q", platform)
+	}
 
-// GetPaymentsURL call providers func to get payments urls
-func (c *Controller) GetPaymentsURL(ctx context.Context, productID string) (*PaymentsURLs, error) {
 	g, gctx := errgroup.WithContext(ctx)
 
-	var gu string
-	g.Go(func() error {
-		u, err := c.gpay.GetPayURL(gctx, productID)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-		gu = u
-		return nil
-	})
+	var mu sync.Mutex
+	urls := make(PaymentsURLs, len(names))
+	for _, name := range names {
+		name := name
+		p, _ := reg.Get(name)
+		g.Go(func() error {
+			u, err := callProvider(gctx, name, p, req)
+			if err != nil {
+				return errors.WithStack(err)
+			}
 
-	var au string
-	g.Go(func() error {
-		u, err := c.apay.GetPayURL(gctx, productID)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-		au = u
-		return nil
-	})
+			mu.Lock()
+			urls[name] = u
+			mu.Unlock()
+			return nil
+		})
+	}
 
 	if err := g.Wait(); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	return &PaymentsURLs{
-		APayURL: au,
-		GPayURL: gu,
-	}, nil
+	return urls, nil
+}
+
+// ProviderResult payment url or error returned by provider
+type ProviderResult struct {
+	URL string
+	Err error
+}
+
+// PaymentsResults model to store every provider result by provider name
+type PaymentsResults map[string]ProviderResult
+
+// URLs return payment urls of providers which succeeded
+func (pr PaymentsResults) URLs() PaymentsURLs {
+	urls := make(PaymentsURLs, len(pr))
+	for name, res := range pr {
+		if res.Err == nil {
+			urls[name] = res.URL
+		}
+	}
+	return urls
+}
+
+// Errors return errors of providers which failed
+func (pr PaymentsResults) Errors() map[string]error {
+	errs := make(map[string]error)
+	for name, res := range pr {
+		if res.Err != nil {
+			errs[name] = res.Err
+		}
+	}
+	return errs
+}
+
+// CollectPaymentsURLs call request tenant providers eligible for platform and collect every provider result.
+// Unlike GetPaymentsURL provider failure doesn't cancel other providers calls
+func (c *Controller) CollectPaymentsURLs(ctx context.Context, req *providers.PaymentRequest, platform providers.Platform) (PaymentsResults, error) {
+	reg := c.registry(ctx)
+	names := reg.Eligible(platform)
+	if len(names) == 0 {
+		return nil, errors.Wrapf(ErrNoProviders, "platform %q", platform)
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	results := make(PaymentsResults, len(names))
+	for _, name := range names {
+		name := name
+		p, _ := reg.Get(name)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := callProvider(ctx, name, p, req)
+
+			mu.Lock()
+			results[name] = ProviderResult{URL: u, Err: errors.WithStack(err)}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// callProvider call provider and log call outcome with request scoped logger
+func callProvider(ctx context.Context, name string, p providers.Provider, req *providers.PaymentRequest) (string, error) {
+	start := time.Now()
+	u, err := p.GetPayURL(ctx, req)
+
+	entry := utils.Logger(ctx).WithFields(logrus.Fields{
+		"provider":    name,
+		"product_id":  req.ProductID,
+		"price":       req.Price.String(),
+		"result":      providers.ErrorClass(err),
+		"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+	})
+	if err != nil {
+		entry.WithError(err).Warn("provider call failed")
+	} else {
+		entry.Info("provider call succeeded")
+	}
+
+	return u, err
 }
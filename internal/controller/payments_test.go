@@ -10,28 +10,37 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
 )
 
 //go:generate mockery -case=snake -dir=./../providers -outpkg=mocks -output=../mocks -name=.*Provider -recursive
 
+func newRegistry(t *testing.T, ap, gp providers.Provider) *providers.Registry {
+	r := providers.NewRegistry()
+	require.NoError(t, r.Register("apay", ap, providers.PlatformIOS, providers.PlatformWeb))
+	require.NoError(t, r.Register("gpay", gp, providers.PlatformAndroid, providers.PlatformWeb))
+	return r
+}
+
 func TestController_GetPaymentsURL(t *testing.T) {
 	t.Parallel()
 
 	aMock := &mocks.Provider{}
 	gMock := &mocks.Provider{}
 
-	c := New(aMock, gMock)
+	c := New(newRegistry(t, aMock, gMock))
 	productID := "testProduct"
+	req := &providers.PaymentRequest{ProductID: productID, Price: money.New(999, money.USD), Description: "Test product"}
 	gURL := fmt.Sprintf("http://google.pay.com/payfor?product=%s", productID)
 	aURL := fmt.Sprintf("http://apple.pay.com/payfor?product=%s", productID)
 
-	aMock.On("GetPayURL", mock.Anything, productID).Return(aURL, nil).Once()
-	gMock.On("GetPayURL", mock.Anything, productID).Return(gURL, nil).Once()
+	aMock.On("GetPayURL", mock.Anything, req).Return(aURL, nil).Once()
+	gMock.On("GetPayURL", mock.Anything, req).Return(gURL, nil).Once()
 
-	urls, err := c.GetPaymentsURL(context.Background(), productID)
+	urls, err := c.GetPaymentsURL(context.Background(), req, providers.PlatformAny)
 	require.NoError(t, err)
-	require.Equal(t, urls.GPayURL, gURL)
-	require.Equal(t, urls.APayURL, aURL)
+	require.Equal(t, PaymentsURLs{"apay": aURL, "gpay": gURL}, urls)
 
 	mock.AssertExpectationsForObjects(t, aMock, gMock)
 }
@@ -42,28 +51,152 @@ func TestController_GetPaymentsURLNegative(t *testing.T) {
 	aMock := &mocks.Provider{}
 	gMock := &mocks.Provider{}
 
-	c := New(aMock, gMock)
+	c := New(newRegistry(t, aMock, gMock))
 	productID := "testProduct"
+	req := &providers.PaymentRequest{ProductID: productID, Price: money.New(999, money.USD), Description: "Test product"}
 	gURL := fmt.Sprintf("http://google.pay.com/payfor?product=%s", productID)
 	aURL := fmt.Sprintf("http://apple.pay.com/payfor?product=%s", productID)
 
 	t.Run("aPay failed", func(t *testing.T) {
-		aMock.On("GetPayURL", mock.Anything, productID).Return("", errors.New("opps apple failed")).Once()
-		gMock.On("GetPayURL", mock.Anything, productID).Return(gURL, nil).Once()
+		aMock.On("GetPayURL", mock.Anything, req).Return("", errors.New("opps apple failed")).Once()
+		gMock.On("GetPayURL", mock.Anything, req).Return(gURL, nil).Once()
 
-		urls, err := c.GetPaymentsURL(context.Background(), productID)
+		urls, err := c.GetPaymentsURL(context.Background(), req, providers.PlatformAny)
 		require.Error(t, err)
 		require.Nil(t, urls)
 	})
 
 	t.Run("gPay failed", func(t *testing.T) {
-		gMock.On("GetPayURL", mock.Anything, productID).Return("", errors.New("opps google failed")).Once()
-		aMock.On("GetPayURL", mock.Anything, productID).Return(aURL, nil).Once()
+		gMock.On("GetPayURL", mock.Anything, req).Return("", errors.New("opps google failed")).Once()
+		aMock.On("GetPayURL", mock.Anything, req).Return(aURL, nil).Once()
+
+		urls, err := c.GetPaymentsURL(context.Background(), req, providers.PlatformAny)
+		require.Error(t, err)
+		require.Nil(t, urls)
+	})
+
+	mock.AssertExpectationsForObjects(t, aMock, gMock)
+}
+
+func TestController_GetPaymentsURLPlatform(t *testing.T) {
+	t.Parallel()
+
+	productID := "testProduct"
+	req := &providers.PaymentRequest{ProductID: productID, Price: money.New(999, money.USD), Description: "Test product"}
+	aURL := fmt.Sprintf("http://apple.pay.com/payfor?product=%s", productID)
+	gURL := fmt.Sprintf("http://google.pay.com/payfor?product=%s", productID)
+
+	tests := []struct {
+		platform providers.Platform
+		want     PaymentsURLs
+	}{
+		{platform: providers.PlatformIOS, want: PaymentsURLs{"apay": aURL}},
+		{platform: providers.PlatformAndroid, want: PaymentsURLs{"gpay": gURL}},
+		{platform: providers.PlatformWeb, want: PaymentsURLs{"apay": aURL, "gpay": gURL}},
+		{platform: providers.PlatformAny, want: PaymentsURLs{"apay": aURL, "gpay": gURL}},
+	}
+	for _, tt := range tests {
+		aMock := &mocks.Provider{}
+		gMock := &mocks.Provider{}
+		if _, ok := tt.want["apay"]; ok {
+			aMock.On("GetPayURL", mock.Anything, req).Return(aURL, nil).Twice()
+		}
+		if _, ok := tt.want["gpay"]; ok {
+			gMock.On("GetPayURL", mock.Anything, req).Return(gURL, nil).Twice()
+		}
+		c := New(newRegistry(t, aMock, gMock))
+
+		urls, err := c.GetPaymentsURL(context.Background(), req, tt.platform)
+		require.NoError(t, err, tt.platform)
+		require.Equal(t, tt.want, urls, tt.platform)
+
+		res, err := c.CollectPaymentsURLs(context.Background(), req, tt.platform)
+		require.NoError(t, err, tt.platform)
+		require.Equal(t, tt.want, res.URLs(), tt.platform)
+
+		// not eligible providers aren't called
+		mock.AssertExpectationsForObjects(t, aMock, gMock)
+	}
+
+	t.Run("no eligible providers", func(t *testing.T) {
+		r := providers.NewRegistry()
+		require.NoError(t, r.Register("gpay", &mocks.Provider{}, providers.PlatformAndroid))
+
+		_, err := New(r).GetPaymentsURL(context.Background(), req, providers.PlatformIOS)
+		require.Equal(t, ErrNoProviders, errors.Cause(err))
+	})
+}
+
+func TestController_GetPaymentsURLRegistry(t *testing.T) {
+	t.Parallel()
 
-		urls, err := c.GetPaymentsURL(context.Background(), productID)
+	t.Run("no providers", func(t *testing.T) {
+		urls, err := New(providers.NewRegistry()).GetPaymentsURL(context.Background(), &providers.PaymentRequest{ProductID: "testProduct"}, providers.PlatformAny)
 		require.Error(t, err)
+		require.Equal(t, ErrNoProviders, errors.Cause(err))
 		require.Nil(t, urls)
 	})
 
+	t.Run("any number of providers", func(t *testing.T) {
+		productID := "testProduct"
+		req := &providers.PaymentRequest{ProductID: productID, Price: money.New(999, money.USD), Description: "Test product"}
+		r := providers.NewRegistry()
+		want := PaymentsURLs{}
+		var ms []interface{}
+		for _, name := range []string{"apay", "gpay", "paypal"} {
+			m := &mocks.Provider{}
+			u := fmt.Sprintf("http://%s.com/payfor?product=%s", name, productID)
+			m.On("GetPayURL", mock.Anything, req).Return(u, nil).Once()
+			require.NoError(t, r.Register(name, m))
+			want[name] = u
+			ms = append(ms, m)
+		}
+
+		urls, err := New(r).GetPaymentsURL(context.Background(), req, providers.PlatformAny)
+		require.NoError(t, err)
+		require.Equal(t, want, urls)
+
+		mock.AssertExpectationsForObjects(t, ms...)
+	})
+
+	t.Run("duplicate provider", func(t *testing.T) {
+		r := providers.NewRegistry()
+		require.NoError(t, r.Register("apay", &mocks.Provider{}))
+		require.Error(t, r.Register("apay", &mocks.Provider{}))
+		require.Error(t, r.Register("", &mocks.Provider{}))
+		require.Error(t, r.Register("gpay", nil))
+		require.Equal(t, []string{"apay"}, r.Names())
+	})
+}
+
+func TestController_CollectPaymentsURLs(t *testing.T) {
+	t.Parallel()
+
+	aMock := &mocks.Provider{}
+	gMock := &mocks.Provider{}
+
+	c := New(newRegistry(t, aMock, gMock))
+	productID := "testProduct"
+	req := &providers.PaymentRequest{ProductID: productID, Price: money.New(999, money.USD), Description: "Test product"}
+	aURL := fmt.Sprintf("http://apple.pay.com/payfor?product=%s", productID)
+	gErr := errors.New("opps google failed")
+
+	aMock.On("GetPayURL", mock.Anything, req).Return(aURL, nil).Once()
+	gMock.On("GetPayURL", mock.Anything, req).Return("", gErr).Once()
+
+	res, err := c.CollectPaymentsURLs(context.Background(), req, providers.PlatformAny)
+	require.NoError(t, err)
+	require.Equal(t, PaymentsURLs{"apay": aURL}, res.URLs())
+
+	errs := res.Errors()
+	require.Len(t, errs, 1)
+	require.Equal(t, gErr, errors.Cause(errs["gpay"]))
+
 	mock.AssertExpectationsForObjects(t, aMock, gMock)
+
+	t.Run("no providers", func(t *testing.T) {
+		res, err := New(providers.NewRegistry()).CollectPaymentsURLs(context.Background(), req, providers.PlatformAny)
+		require.Error(t, err)
+		require.Nil(t, res)
+	})
 }
@@ -0,0 +1,180 @@
+package fallback
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaults used if apps aren't configured
+const (
+	DefaultApp       = "default"
+	DefaultAppleURL  = "http://apple.store.com/myApp"
+	DefaultGoogleURL = "http://google.store.com/myApp"
+)
+
+// ErrUnknownApp returned for app which isn't configured
+var ErrUnknownApp = errors.New("unknown app")
+
+// localeRe BCP 47 like language tag, e.g. de or pt-BR
+var localeRe = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// URLs app store urls returned when payment providers failed
+type URLs struct {
+	AppleURL  string `json:"apple_url,omitempty"`
+	GoogleURL string `json:"google_url,omitempty"`
+}
+
+// App app store urls with optional locale variants.
+// Empty locale variant url falls back to app url
+type App struct {
+	URLs
+	Locales map[string]URLs `json:"locales,omitempty"`
+}
+
+// Config store urls of apps served by the service
+type Config struct {
+	// DefaultApp app used if request doesn't specify one
+	DefaultApp string          `json:"default_app"`
+	Apps       map[string]*App `json:"apps"`
+}
+
+// DefaultConfig return config with the only default app
+func DefaultConfig() Config {
+	return Config{
+		DefaultApp: DefaultApp,
+		Apps: map[string]*App{
+			DefaultApp: {URLs: URLs{AppleURL: DefaultAppleURL, GoogleURL: DefaultGoogleURL}},
+		},
+	}
+}
+
+// Validate check that default app exists, every app has valid store urls and locales are language tags
+func (c *Config) Validate() error {
+	if _, ok := c.Apps[c.DefaultApp]; !ok {
+		return errors.Errorf("default app %q isn't configured", c.DefaultApp)
+	}
+
+	for name, app := range c.Apps {
+		if app == nil || (app.AppleURL == "" && app.GoogleURL == "") {
+			return errors.Errorf("app %s should have at least one store url", name)
+		}
+		if err := app.URLs.validate(); err != nil {
+			return errors.Wrapf(err, "app %s", name)
+		}
+
+		for locale, urls := range app.Locales {
+			if !localeRe.MatchString(locale) {
+				return errors.Errorf("app %s locale %q isn't a language tag", name, locale)
+			}
+			if err := urls.validate(); err != nil {
+				return errors.Wrapf(err, "app %s locale %s", name, locale)
+			}
+		}
+	}
+	return nil
+}
+
+// validate check that urls are absolute http urls
+func (u URLs) validate() error {
+	for _, s := range []string{u.AppleURL, u.GoogleURL} {
+		if s == "" {
+			continue
+		}
+
+		pu, err := url.Parse(s)
+		if err != nil {
+			return errors.Wrapf(err, "invalid store url %q", s)
+		}
+		if (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+			return errors.Errorf("store url %q should be absolute http or https url", s)
+		}
+	}
+	return nil
+}
+
+// Lookup return store urls of app for the first locale having variant.
+// Default app is used if app is empty. Locales are in client preference order,
+// language without region is tried if there is no variant for region, e.g. pt for pt-BR
+func (c *Config) Lookup(app string, locales []string) (URLs, error) {
+	if app == "" {
+		app = c.DefaultApp
+	}
+
+	a, ok := c.Apps[app]
+	if !ok {
+		return URLs{}, errors.Wrapf(ErrUnknownApp, "%q", app)
+	}
+
+	for _, l := range locales {
+		v, ok := a.locale(l)
+		if !ok {
+			continue
+		}
+
+		urls := a.URLs
+		if v.AppleURL != "" {
+			urls.AppleURL = v.AppleURL
+		}
+		if v.GoogleURL != "" {
+			urls.GoogleURL = v.GoogleURL
+		}
+		return urls, nil
+	}
+
+	return a.URLs, nil
+}
+
+// locale find locale variant case insensitively falling back to base language
+func (a *App) locale(l string) (URLs, bool) {
+	for _, tag := range []string{l, strings.SplitN(l, "-", 2)[0]} {
+		for name, urls := range a.Locales {
+			if strings.EqualFold(name, tag) {
+				return urls, true
+			}
+		}
+	}
+	return URLs{}, false
+}
+
+// ParseAcceptLanguage return Accept-Language header languages ordered by quality.
+// Wildcard and invalid tags are skipped
+func ParseAcceptLanguage(h string) []string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+
+	var langs []lang
+	for _, part := range strings.Split(h, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if !localeRe.MatchString(tag) {
+			continue
+		}
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, lang{tag: tag, q: q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	tags := make([]string, 0, len(langs))
+	for _, l := range langs {
+		tags = append(tags, l.tag)
+	}
+	return tags
+}
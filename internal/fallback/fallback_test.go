@@ -0,0 +1,113 @@
+package fallback
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig() Config {
+	return Config{
+		DefaultApp: "shop",
+		Apps: map[string]*App{
+			"shop": {
+				URLs: URLs{AppleURL: "https://apps.apple.com/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop"},
+				Locales: map[string]URLs{
+					"de":    {AppleURL: "https://apps.apple.com/de/app/id1"},
+					"pt-BR": {AppleURL: "https://apps.apple.com/br/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop&hl=pt_BR"},
+				},
+			},
+			"games": {
+				URLs: URLs{GoogleURL: "https://play.google.com/store/apps/details?id=games"},
+			},
+		},
+	}
+}
+
+func TestConfig_Lookup(t *testing.T) {
+	t.Parallel()
+
+	c := newTestConfig()
+	tests := []struct {
+		name    string
+		app     string
+		locales []string
+		want    URLs
+		err     error
+	}{
+		{
+			name: "default app",
+			want: URLs{AppleURL: "https://apps.apple.com/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop"},
+		},
+		{
+			name: "app",
+			app:  "games",
+			want: URLs{GoogleURL: "https://play.google.com/store/apps/details?id=games"},
+		},
+		{
+			name:    "locale variant falls back to app url",
+			locales: []string{"de-AT"},
+			want:    URLs{AppleURL: "https://apps.apple.com/de/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop"},
+		},
+		{
+			name:    "first locale having variant",
+			locales: []string{"fr", "pt-br", "de"},
+			want:    URLs{AppleURL: "https://apps.apple.com/br/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop&hl=pt_BR"},
+		},
+		{
+			name: "unknown app",
+			app:  "unknown",
+			err:  ErrUnknownApp,
+		},
+	}
+	for _, tt := range tests {
+		urls, err := c.Lookup(tt.app, tt.locales)
+		require.Equal(t, tt.err, errors.Cause(err), tt.name)
+		require.Equal(t, tt.want, urls, tt.name)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	def := DefaultConfig()
+	require.NoError(t, def.Validate())
+
+	c := newTestConfig()
+	require.NoError(t, c.Validate())
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{name: "unknown default app", modify: func(c *Config) { c.DefaultApp = "unknown" }},
+		{name: "no urls", modify: func(c *Config) { c.Apps["games"] = &App{} }},
+		{name: "relative url", modify: func(c *Config) { c.Apps["games"].GoogleURL = "/store/games" }},
+		{name: "not http url", modify: func(c *Config) { c.Apps["games"].GoogleURL = "ftp://store.com/games" }},
+		{name: "invalid locale", modify: func(c *Config) { c.Apps["games"].Locales = map[string]URLs{"german!": {}} }},
+		{name: "invalid locale url", modify: func(c *Config) { c.Apps["games"].Locales = map[string]URLs{"de": {AppleURL: "store"}} }},
+	}
+	for _, tt := range tests {
+		c := newTestConfig()
+		tt.modify(&c)
+		require.Error(t, c.Validate(), tt.name)
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{header: "", want: []string{}},
+		{header: "de", want: []string{"de"}},
+		{header: "fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", want: []string{"fr-CH", "fr", "en", "de"}},
+		{header: "en;q=0.1, pt-BR, es;q=0", want: []string{"pt-BR", "en"}},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, ParseAcceptLanguage(tt.header), tt.header)
+	}
+}
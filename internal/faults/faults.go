@@ -0,0 +1,239 @@
+package faults
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// faults kinds
+const (
+	// KindLatency delay request before it's handled
+	KindLatency = "latency"
+	// KindPanic panic while request is handled
+	KindPanic = "panic"
+	// KindStatus respond with Status code
+	KindStatus = "status"
+	// KindMalformed respond with OK status and malformed json body
+	KindMalformed = "malformed"
+)
+
+// malformedBody truncated json body
+const malformedBody = `{"type":"payment_urls","urls":{"apay":"http://`
+
+// Rule fault to inject into route or provider requests.
+// Either Route or Provider should be set
+type Rule struct {
+	// Route server route path, e.g. /api/v1/payments/urls
+	Route string `json:"route,omitempty"`
+	// Provider provider name, e.g. apay
+	Provider string `json:"provider,omitempty"`
+	// Kind one of latency, panic, status or malformed
+	Kind string `json:"kind"`
+	// Probability chance of fault per request from 0 to 1
+	Probability float64 `json:"probability"`
+	// Latency delay of latency fault
+	Latency utils.Duration `json:"latency,omitempty"`
+	// Status response status code of status fault
+	Status int `json:"status,omitempty"`
+}
+
+// Config faults injection configuration. Faults are injected only if enabled
+type Config struct {
+	Enabled bool   `json:"enabled"`
+	Rules   []Rule `json:"rules"`
+}
+
+// Validate check rules values
+func (c *Config) Validate() error {
+	for i, r := range c.Rules {
+		if (r.Route == "") == (r.Provider == "") {
+			return errors.Errorf("fault rule %d should have either route or provider", i)
+		}
+
+		if r.Probability <= 0 || r.Probability > 1 {
+			return errors.Errorf("fault rule %d probability should be from 0 to 1", i)
+		}
+
+		switch r.Kind {
+		case KindLatency:
+			if r.Latency <= 0 {
+				return errors.Errorf("fault rule %d latency should be positive", i)
+			}
+		case KindStatus:
+			if r.Status < 100 || r.Status > 599 {
+				return errors.Errorf("fault rule %d status should be valid http status code", i)
+			}
+		case KindPanic, KindMalformed:
+		default:
+			return errors.Errorf("fault rule %d has unknown kind %q", i, r.Kind)
+		}
+	}
+	return nil
+}
+
+// Injector injects configured faults into server routes and providers requests.
+// Config could be changed at runtime
+type Injector struct {
+	l *logrus.Logger
+
+	mu   sync.RWMutex
+	cfg  Config
+	rand func() float64
+}
+
+// New construct faults injector
+func New(cfg Config, l *logrus.Logger) (*Injector, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &Injector{
+		l:    l,
+		cfg:  cfg,
+		rand: rand.Float64, //nolint:gosec
+	}, nil
+}
+
+// Config return current configuration
+func (i *Injector) Config() Config {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	cfg := i.cfg
+	cfg.Rules = append([]Rule{}, i.cfg.Rules...)
+	return cfg
+}
+
+// SetConfig replace configuration
+func (i *Injector) SetConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	i.mu.Lock()
+	i.cfg = cfg
+	i.mu.Unlock()
+
+	i.l.WithField("enabled", cfg.Enabled).WithField("rules", len(cfg.Rules)).Warn("faults injection config changed")
+	return nil
+}
+
+// pick return faults to inject into request in rules order. Every rule is rolled separately
+func (i *Injector) pick(match func(r Rule) bool) []Rule {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	if !i.cfg.Enabled {
+		return nil
+	}
+
+	var picked []Rule
+	for _, r := range i.cfg.Rules {
+		if match(r) && i.rand() < r.Probability {
+			picked = append(picked, r)
+		}
+	}
+	return picked
+}
+
+// Middleware inject route faults into server requests
+func (i *Injector) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		picked := i.pick(func(rule Rule) bool { return rule.Route == r.URL.Path })
+		for _, f := range picked {
+			utils.Logger(r.Context()).WithField("route", f.Route).WithField("fault", f.Kind).Warn("fault injected")
+
+			switch f.Kind {
+			case KindLatency:
+				if err := sleep(r.Context(), time.Duration(f.Latency)); err != nil {
+					return
+				}
+			case KindPanic:
+				panic(fmt.Sprintf("injected fault in route %s", f.Route))
+			case KindStatus:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(f.Status)
+				_, _ = w.Write([]byte(`{"error":"injected fault"}`))
+				return
+			case KindMalformed:
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(malformedBody))
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RoundTripper inject provider faults into provider client requests
+func (i *Injector) RoundTripper(provider string, rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		picked := i.pick(func(rule Rule) bool { return rule.Provider == provider })
+		for _, f := range picked {
+			utils.Logger(req.Context()).WithField("provider", provider).WithField("fault", f.Kind).Warn("fault injected")
+
+			switch f.Kind {
+			case KindLatency:
+				if err := sleep(req.Context(), time.Duration(f.Latency)); err != nil {
+					return nil, err
+				}
+			case KindPanic:
+				panic(fmt.Sprintf("injected fault in provider %s", provider))
+			case KindStatus:
+				return response(req, f.Status, `{"error":"injected fault"}`), nil
+			case KindMalformed:
+				return response(req, http.StatusOK, malformedBody), nil
+			}
+		}
+
+		return rt.RoundTrip(req)
+	})
+}
+
+// roundTripperFunc function implementing http.RoundTripper
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip call function
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// response construct fake provider response
+func response(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// sleep wait for d or until context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,174 @@
+package faults
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+const route = "/api/v1/payments/urls"
+
+func newTestInjector(t *testing.T, cfg Config, roll float64) *Injector {
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+
+	i, err := New(cfg, l)
+	require.NoError(t, err)
+	i.rand = func() float64 { return roll }
+	return i
+}
+
+func TestInjector_Middleware(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		roll   float64
+		status int
+		body   string
+		panics bool
+	}{
+		{
+			name:   "disabled",
+			cfg:    Config{Rules: []Rule{{Route: route, Kind: KindStatus, Status: 503, Probability: 1}}},
+			status: http.StatusOK,
+			body:   "ok",
+		},
+		{
+			name:   "status",
+			cfg:    Config{Enabled: true, Rules: []Rule{{Route: route, Kind: KindStatus, Status: 503, Probability: 1}}},
+			status: http.StatusServiceUnavailable,
+			body:   `{"error":"injected fault"}`,
+		},
+		{
+			name:   "malformed",
+			cfg:    Config{Enabled: true, Rules: []Rule{{Route: route, Kind: KindMalformed, Probability: 1}}},
+			status: http.StatusOK,
+			body:   malformedBody,
+		},
+		{
+			name:   "panic",
+			cfg:    Config{Enabled: true, Rules: []Rule{{Route: route, Kind: KindPanic, Probability: 1}}},
+			panics: true,
+		},
+		{
+			name:   "latency",
+			cfg:    Config{Enabled: true, Rules: []Rule{{Route: route, Kind: KindLatency, Latency: utils.Duration(time.Millisecond), Probability: 1}}},
+			status: http.StatusOK,
+			body:   "ok",
+		},
+		{
+			name:   "not rolled",
+			cfg:    Config{Enabled: true, Rules: []Rule{{Route: route, Kind: KindPanic, Probability: 0.5}}},
+			roll:   0.5,
+			status: http.StatusOK,
+			body:   "ok",
+		},
+		{
+			name:   "other route",
+			cfg:    Config{Enabled: true, Rules: []Rule{{Route: "/healthz", Kind: KindPanic, Probability: 1}}},
+			status: http.StatusOK,
+			body:   "ok",
+		},
+		{
+			name:   "provider rule",
+			cfg:    Config{Enabled: true, Rules: []Rule{{Provider: "apay", Kind: KindPanic, Probability: 1}}},
+			status: http.StatusOK,
+			body:   "ok",
+		},
+	}
+	for _, tt := range tests {
+		h := newTestInjector(t, tt.cfg, tt.roll).Middleware(ok)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, route+"?productID=1", nil)
+
+		if tt.panics {
+			require.Panics(t, func() { h.ServeHTTP(rec, req) }, tt.name)
+			continue
+		}
+
+		h.ServeHTTP(rec, req)
+		require.Equal(t, tt.status, rec.Code, tt.name)
+		require.Equal(t, tt.body, rec.Body.String(), tt.name)
+	}
+}
+
+func TestInjector_RoundTripper(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"url":"http://pay.com"}`))
+	}))
+	defer srv.Close()
+
+	i := newTestInjector(t, Config{}, 0)
+	cli := &http.Client{Transport: i.RoundTripper("apay", http.DefaultTransport)}
+	get := func() (int, string) {
+		resp, err := cli.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	status, body := get()
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, `{"url":"http://pay.com"}`, body)
+
+	require.NoError(t, i.SetConfig(Config{Enabled: true, Rules: []Rule{
+		{Provider: "gpay", Kind: KindMalformed, Probability: 1},
+		{Provider: "apay", Kind: KindStatus, Status: http.StatusBadGateway, Probability: 1},
+	}}))
+	status, body = get()
+	require.Equal(t, http.StatusBadGateway, status)
+	require.Equal(t, `{"error":"injected fault"}`, body)
+
+	require.NoError(t, i.SetConfig(Config{Enabled: true, Rules: []Rule{{Provider: "apay", Kind: KindMalformed, Probability: 1}}}))
+	status, body = get()
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, malformedBody, body)
+
+	require.NoError(t, i.SetConfig(Config{Enabled: true, Rules: []Rule{{Provider: "apay", Kind: KindPanic, Probability: 1}}}))
+	require.Panics(t, func() { _, _ = cli.Get(srv.URL) }) //nolint:bodyclose
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		rule Rule
+		ok   bool
+	}{
+		{name: "valid", rule: Rule{Route: route, Kind: KindPanic, Probability: 0.1}, ok: true},
+		{name: "no target", rule: Rule{Kind: KindPanic, Probability: 1}},
+		{name: "both targets", rule: Rule{Route: route, Provider: "apay", Kind: KindPanic, Probability: 1}},
+		{name: "zero probability", rule: Rule{Route: route, Kind: KindPanic}},
+		{name: "no latency", rule: Rule{Route: route, Kind: KindLatency, Probability: 1}},
+		{name: "bad status", rule: Rule{Route: route, Kind: KindStatus, Status: 42, Probability: 1}},
+		{name: "unknown kind", rule: Rule{Route: route, Kind: "boom", Probability: 1}},
+	}
+	for _, tt := range tests {
+		cfg := Config{Rules: []Rule{tt.rule}}
+		err := cfg.Validate()
+		if tt.ok {
+			require.NoError(t, err, tt.name)
+		} else {
+			require.Error(t, err, tt.name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTTL time responses are kept for to be replayed
+const DefaultTTL = 24 * time.Hour
+
+// Response stored response of request
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Record request stored under idempotency key
+type Record struct {
+	// Fingerprint hash of request the key was used with first
+	Fingerprint string
+	// Response of request. It's nil while request is in flight
+	Response *Response
+}
+
+// Store idempotency keys storage
+type Store interface {
+	// Reserve store in-flight record of request with fingerprint under key unless key is taken.
+	// Return false and record stored under key if it's taken
+	Reserve(ctx context.Context, key, fingerprint string) (*Record, bool, error)
+	// Complete store response of in-flight request under key
+	Complete(ctx context.Context, key string, res *Response) error
+	// Release remove key of in-flight request, so it may be reserved again
+	Release(ctx context.Context, key string) error
+}
+
+// entry stored record with its expiry time
+type entry struct {
+	record  Record
+	expires time.Time
+}
+
+// MemoryStore in-memory idempotency keys storage. Keys expire after ttl since reservation
+type MemoryStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	records   map[string]*entry
+	nextPurge time.Time
+}
+
+// NewMemoryStore construct empty in-memory store of keys expiring after ttl. DefaultTTL is used if ttl is 0
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &MemoryStore{
+		ttl:     ttl,
+		now:     time.Now,
+		records: make(map[string]*entry),
+	}
+}
+
+// Reserve store in-flight record under key unless key is taken by unexpired record
+func (s *MemoryStore) Reserve(_ context.Context, key, fingerprint string) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.After(s.nextPurge) {
+		for k, e := range s.records {
+			if now.After(e.expires) {
+				delete(s.records, k)
+			}
+		}
+		s.nextPurge = now.Add(time.Minute)
+	}
+
+	if e, ok := s.records[key]; ok && !now.After(e.expires) {
+		rec := e.record
+		return &rec, false, nil
+	}
+	s.records[key] = &entry{
+		record:  Record{Fingerprint: fingerprint},
+		expires: now.Add(s.ttl),
+	}
+	return nil, true, nil
+}
+
+// Complete store response under key. Nothing is stored if key has expired
+func (s *MemoryStore) Complete(_ context.Context, key string, res *Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.records[key]; ok {
+		e.record.Response = res
+	}
+	return nil
+}
+
+// Release remove key
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,50 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewMemoryStore(time.Hour)
+	now := time.Unix(1600000000, 0)
+	s.now = func() time.Time { return now }
+
+	rec, ok, err := s.Reserve(ctx, "a", "f1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Nil(t, rec)
+
+	rec, ok, err = s.Reserve(ctx, "a", "f2")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, &Record{Fingerprint: "f1"}, rec, "in-flight record")
+
+	res := &Response{Status: http.StatusCreated, Header: http.Header{"Location": {"/x"}}, Body: []byte("{}")}
+	require.NoError(t, s.Complete(ctx, "a", res))
+	rec, ok, err = s.Reserve(ctx, "a", "f1")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, &Record{Fingerprint: "f1", Response: res}, rec)
+
+	_, ok, err = s.Reserve(ctx, "b", "f1")
+	require.NoError(t, err)
+	require.True(t, ok, "keys are independent")
+	require.NoError(t, s.Release(ctx, "b"))
+	_, ok, err = s.Reserve(ctx, "b", "f2")
+	require.NoError(t, err)
+	require.True(t, ok, "released key is reserved again")
+
+	now = now.Add(time.Hour + time.Second)
+	_, ok, err = s.Reserve(ctx, "a", "f2")
+	require.NoError(t, err)
+	require.True(t, ok, "expired key is reserved again")
+	require.Len(t, s.records, 1, "expired keys are purged")
+}
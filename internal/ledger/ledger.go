@@ -0,0 +1,160 @@
+package ledger
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+)
+
+// Ledger double-entry book of money movements. Only balanced transactions are posted
+type Ledger struct {
+	store Store
+	now   func() time.Time
+}
+
+// New construct ledger of store transactions
+func New(store Store) *Ledger {
+	return &Ledger{store: store, now: time.Now}
+}
+
+// Post validate transaction and store it. Transaction is posted at now unless its PostedAt is set.
+// ErrExists is returned if transaction with the same id is posted already
+func (l *Ledger) Post(ctx context.Context, t *Transaction) error {
+	if err := t.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	t = t.Clone()
+	if t.PostedAt.IsZero() {
+		t.PostedAt = l.now()
+	}
+	t.PostedAt = t.PostedAt.UTC()
+	return errors.WithStack(l.store.Append(ctx, t))
+}
+
+// Balance account turnovers in currency
+type Balance struct {
+	Account  Account        `json:"account"`
+	Currency money.Currency `json:"currency"`
+	// Debit sum of debit entries in currency minor units
+	Debit int64 `json:"debit"`
+	// Credit sum of credit entries in currency minor units
+	Credit int64 `json:"credit"`
+}
+
+// Net return account balance, debit balance is positive and credit one is negative
+func (b Balance) Net() money.Money {
+	return money.New(b.Debit-b.Credit, b.Currency)
+}
+
+// add add entry amount to turnover of its direction
+func (b *Balance) add(e Entry) error {
+	sum := &b.Debit
+	if e.Direction == Credit {
+		sum = &b.Credit
+	}
+
+	total, err := money.New(*sum, b.Currency).Add(e.Amount)
+	if err != nil {
+		return errors.Wrapf(err, "account %s", b.Account)
+	}
+	*sum = total.Amount()
+	return nil
+}
+
+// TrialBalance balances of every account as of point in time
+type TrialBalance struct {
+	AsOf time.Time `json:"as_of"`
+	// Accounts balances sorted by account and currency
+	Accounts []Balance `json:"accounts"`
+	// Totals turnovers of all accounts by currency, Account is empty
+	Totals []Balance `json:"totals"`
+	// Balanced total debits equal total credits in every currency
+	Balanced bool `json:"balanced"`
+}
+
+// Balances return balances of account by currency as of point in time. Zero asOf is now
+func (l *Ledger) Balances(ctx context.Context, account Account, asOf time.Time) ([]Balance, error) {
+	tb, err := l.TrialBalance(ctx, asOf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var balances []Balance
+	for _, b := range tb.Accounts {
+		if b.Account == account {
+			balances = append(balances, b)
+		}
+	}
+	return balances, nil
+}
+
+// TrialBalance sum entries of transactions posted not after asOf by accounts. Zero asOf is now
+func (l *Ledger) TrialBalance(ctx context.Context, asOf time.Time) (*TrialBalance, error) {
+	if asOf.IsZero() {
+		asOf = l.now()
+	}
+	asOf = asOf.UTC()
+
+	txs, err := l.store.Transactions(ctx, asOf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	type key struct {
+		account  Account
+		currency money.Currency
+	}
+	accounts := make(map[key]*Balance)
+	totals := make(map[money.Currency]*Balance)
+	for _, t := range txs {
+		for _, e := range t.Entries {
+			c := e.Amount.Currency()
+			k := key{account: e.Account, currency: c}
+			b, ok := accounts[k]
+			if !ok {
+				b = &Balance{Account: e.Account, Currency: c}
+				accounts[k] = b
+			}
+			if err := b.add(e); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			total, ok := totals[c]
+			if !ok {
+				total = &Balance{Currency: c}
+				totals[c] = total
+			}
+			if err := total.add(e); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+	}
+
+	tb := &TrialBalance{
+		AsOf:     asOf,
+		Accounts: make([]Balance, 0, len(accounts)),
+		Totals:   make([]Balance, 0, len(totals)),
+		Balanced: true,
+	}
+	for _, b := range accounts {
+		tb.Accounts = append(tb.Accounts, *b)
+	}
+	sort.Slice(tb.Accounts, func(i, j int) bool {
+		if tb.Accounts[i].Account == tb.Accounts[j].Account {
+			return tb.Accounts[i].Currency < tb.Accounts[j].Currency
+		}
+		return tb.Accounts[i].Account < tb.Accounts[j].Account
+	})
+	for _, b := range totals {
+		tb.Totals = append(tb.Totals, *b)
+		tb.Balanced = tb.Balanced && b.Debit == b.Credit
+	}
+	sort.Slice(tb.Totals, func(i, j int) bool { return tb.Totals[i].Currency < tb.Totals[j].Currency })
+
+	return tb, nil
+}
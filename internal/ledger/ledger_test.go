@@ -0,0 +1,170 @@
+package ledger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+)
+
+func TestTransaction_Validate(t *testing.T) {
+	t.Parallel()
+
+	usd := money.New(999, money.USD)
+	tests := []struct {
+		name    string
+		entries []Entry
+		err     error
+	}{
+		{name: "balanced", entries: Transfer("a", "b", usd)},
+		{
+			name: "balanced in every currency",
+			entries: append(Transfer("a", "b", usd),
+				Entry{Account: "a", Direction: Debit, Amount: money.New(500, money.EUR)},
+				Entry{Account: "c", Direction: Credit, Amount: money.New(300, money.EUR)},
+				Entry{Account: "d", Direction: Credit, Amount: money.New(200, money.EUR)},
+			),
+		},
+		{
+			name: "unbalanced",
+			entries: []Entry{
+				{Account: "a", Direction: Debit, Amount: usd},
+				{Account: "b", Direction: Credit, Amount: money.New(998, money.USD)},
+			},
+			err: ErrUnbalanced,
+		},
+		{
+			name: "unbalanced currencies",
+			entries: []Entry{
+				{Account: "a", Direction: Debit, Amount: usd},
+				{Account: "b", Direction: Credit, Amount: money.New(999, money.EUR)},
+			},
+			err: ErrUnbalanced,
+		},
+		{name: "single entry", entries: Transfer("a", "b", usd)[:1], err: ErrInvalidTransaction},
+		{name: "zero amount", entries: Transfer("a", "b", money.New(0, money.USD)), err: ErrInvalidTransaction},
+		{name: "negative amount", entries: Transfer("a", "b", money.New(-1, money.USD)), err: ErrInvalidTransaction},
+		{name: "no account", entries: Transfer("a", "", usd), err: ErrInvalidTransaction},
+		{name: "unknown currency", entries: Transfer("a", "b", money.New(1, "XXX")), err: money.ErrUnknownCurrency},
+		{
+			name: "unknown direction",
+			entries: []Entry{
+				{Account: "a", Direction: Debit, Amount: usd},
+				{Account: "b", Direction: "out", Amount: usd},
+			},
+			err: ErrInvalidTransaction,
+		},
+	}
+	for _, tt := range tests {
+		tx := &Transaction{ID: "tx_1", Kind: KindCapture, Entries: tt.entries}
+		require.Equal(t, tt.err, errors.Cause(tx.Validate()), tt.name)
+	}
+
+	require.Equal(t, ErrInvalidTransaction, errors.Cause((&Transaction{Kind: KindCapture, Entries: Transfer("a", "b", usd)}).Validate()))
+	require.Equal(t, ErrInvalidTransaction, errors.Cause((&Transaction{ID: "tx_1", Entries: Transfer("a", "b", usd)}).Validate()))
+}
+
+func TestLedger_TrialBalance(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(NewMemoryStore())
+	l.now = func() time.Time { return at.Add(time.Hour) }
+
+	require.NoError(t, l.Post(ctx, &Transaction{
+		ID:       "tx_1",
+		Kind:     KindCapture,
+		Entries:  Transfer(ProviderClearing("apay"), MerchantReceivable("shop"), money.New(1000, money.USD)),
+		PostedAt: at,
+	}))
+	require.NoError(t, l.Post(ctx, &Transaction{
+		ID:       "tx_2",
+		Kind:     KindCapture,
+		Entries:  Transfer(ProviderClearing("apay"), MerchantReceivable("shop"), money.New(500, money.EUR)),
+		PostedAt: at.Add(time.Minute),
+	}))
+	// posted at now
+	require.NoError(t, l.Post(ctx, &Transaction{
+		ID:      "tx_3",
+		Kind:    KindRefund,
+		Entries: Transfer(MerchantReceivable("shop"), ProviderClearing("apay"), money.New(300, money.USD)),
+	}))
+
+	err := l.Post(ctx, &Transaction{ID: "tx_1", Kind: KindCapture, Entries: Transfer("a", "b", money.New(1, money.USD))})
+	require.Equal(t, ErrExists, errors.Cause(err))
+	err = l.Post(ctx, &Transaction{ID: "tx_4", Kind: KindFee, Entries: []Entry{
+		{Account: Fees("apay"), Direction: Debit, Amount: money.New(30, money.USD)},
+		{Account: ProviderClearing("apay"), Direction: Credit, Amount: money.New(29, money.USD)},
+	}})
+	require.Equal(t, ErrUnbalanced, errors.Cause(err))
+
+	tb, err := l.TrialBalance(ctx, at)
+	require.NoError(t, err)
+	require.Equal(t, &TrialBalance{
+		AsOf: at,
+		Accounts: []Balance{
+			{Account: "merchant:shop:receivable", Currency: money.USD, Credit: 1000},
+			{Account: "provider:apay:clearing", Currency: money.USD, Debit: 1000},
+		},
+		Totals:   []Balance{{Currency: money.USD, Debit: 1000, Credit: 1000}},
+		Balanced: true,
+	}, tb)
+
+	tb, err = l.TrialBalance(ctx, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, &TrialBalance{
+		AsOf: at.Add(time.Hour),
+		Accounts: []Balance{
+			{Account: "merchant:shop:receivable", Currency: money.EUR, Credit: 500},
+			{Account: "merchant:shop:receivable", Currency: money.USD, Debit: 300, Credit: 1000},
+			{Account: "provider:apay:clearing", Currency: money.EUR, Debit: 500},
+			{Account: "provider:apay:clearing", Currency: money.USD, Debit: 1000, Credit: 300},
+		},
+		Totals: []Balance{
+			{Currency: money.EUR, Debit: 500, Credit: 500},
+			{Currency: money.USD, Debit: 1300, Credit: 1300},
+		},
+		Balanced: true,
+	}, tb)
+
+	balances, err := l.Balances(ctx, MerchantReceivable("shop"), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, balances, 2)
+	require.Equal(t, money.New(-500, money.EUR), balances[0].Net())
+	require.Equal(t, money.New(-700, money.USD), balances[1].Net())
+
+	balances, err = l.Balances(ctx, MerchantReceivable("other"), time.Time{})
+	require.NoError(t, err)
+	require.Empty(t, balances)
+}
+
+func TestFee_Of(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		fee    Fee
+		amount money.Money
+		want   money.Money
+	}{
+		{fee: Fee{}, amount: money.New(999, money.USD), want: money.New(0, money.USD)},
+		{fee: Fee{RateBPS: 290, Fixed: 30}, amount: money.New(1000, money.USD), want: money.New(59, money.USD)},
+		// 2.9% of 9.99 is 0.28971
+		{fee: Fee{RateBPS: 290}, amount: money.New(999, money.USD), want: money.New(29, money.USD)},
+		{fee: Fee{RateBPS: 150, Fixed: 10}, amount: money.New(1000, money.JPY), want: money.New(25, money.JPY)},
+	}
+	for _, tt := range tests {
+		got, err := tt.fee.Of(tt.amount)
+		require.NoError(t, err, "%+v of %s", tt.fee, tt.amount)
+		require.Equal(t, tt.want, got, "%+v of %s", tt.fee, tt.amount)
+	}
+
+	require.NoError(t, Fee{RateBPS: 10000}.Validate())
+	require.Error(t, Fee{RateBPS: 10001}.Validate())
+	require.Error(t, Fee{RateBPS: -1}.Validate())
+	require.Error(t, Fee{Fixed: -1}.Validate())
+}
@@ -0,0 +1,203 @@
+package ledger
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// maxFeeRateBPS fee rate of the whole amount
+const maxFeeRateBPS = 10000
+
+// retryInterval wait before transactions failed to post are posted again
+const retryInterval = 5 * time.Second
+
+// Fee provider fee of captured payments
+type Fee struct {
+	// RateBPS fee rate in basis points of captured amount, e.g. 290 is 2.9%
+	RateBPS int64 `json:"rate_bps"`
+	// Fixed fixed fee in payment currency minor units
+	Fixed int64 `json:"fixed"`
+}
+
+// Validate check fee values
+func (f Fee) Validate() error {
+	if f.RateBPS < 0 || f.RateBPS > maxFeeRateBPS {
+		return errors.Errorf("fee rate should be from 0 to %d bps", maxFeeRateBPS)
+	}
+	if f.Fixed < 0 {
+		return errors.New("fixed fee should not be negative")
+	}
+	return nil
+}
+
+// Of return fee of captured amount. Rate part is rounded half to even to minor units
+func (f Fee) Of(amount money.Money) (money.Money, error) {
+	fee, err := amount.MultiplyRat(f.RateBPS, maxFeeRateBPS)
+	if err != nil {
+		return money.Money{}, errors.WithStack(err)
+	}
+	fee, err = fee.Add(money.New(f.Fixed, amount.Currency()))
+	return fee, errors.WithStack(err)
+}
+
+// Recorder posts money movements of payment sessions to ledger.
+// Transactions failed to post are queued and posted again until they succeed
+type Recorder struct {
+	ledger *Ledger
+	// fees by provider name, payments of other providers have no fees
+	fees  map[string]Fee
+	retry time.Duration
+
+	mu     sync.Mutex
+	closed bool
+	queue  []*Transaction
+	timer  *time.Timer
+}
+
+// NewRecorder construct recorder of sessions money movements with providers fees
+func NewRecorder(l *Ledger, fees map[string]Fee) *Recorder {
+	return &Recorder{ledger: l, fees: fees, retry: retryInterval}
+}
+
+// Record post transactions of session last status transition. It's a session.Listener.
+// Transactions ids are derived from session, so repeated notification of the same transition is posted once
+func (r *Recorder) Record(ctx context.Context, s *session.Session) {
+	l := utils.Logger(ctx).WithField("session_id", s.ID)
+
+	txs, err := r.transactions(s)
+	if err != nil {
+		l.WithError(err).Error("failed to record payment in ledger")
+		return
+	}
+
+	r.mu.Lock()
+	r.queue = append(r.queue, txs...)
+	r.mu.Unlock()
+	if err := r.Flush(ctx); err != nil {
+		l.WithError(err).Error("failed to post ledger transactions, retrying")
+	}
+}
+
+// Flush post queued transactions in order. Transactions failed to post stay queued and are posted again
+// after retry interval. It returns error of the first failed transaction
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l := utils.Logger(ctx)
+	var failed error
+	kept := r.queue[:0]
+	for _, t := range r.queue {
+		tl := l.WithFields(logrus.Fields{"transaction_id": t.ID, "kind": t.Kind})
+		err := r.ledger.Post(ctx, t)
+		switch {
+		case err == nil:
+			tl.Debug("ledger transaction posted")
+		case errors.Is(err, ErrExists):
+			tl.Debug("ledger transaction is posted already")
+		default:
+			if failed == nil {
+				failed = errors.Wrapf(err, "transaction %s", t.ID)
+			}
+			kept = append(kept, t)
+		}
+	}
+	r.queue = kept
+
+	if len(r.queue) > 0 && r.timer == nil && !r.closed {
+		r.timer = time.AfterFunc(r.retry, func() {
+			r.mu.Lock()
+			r.timer = nil
+			r.mu.Unlock()
+			ctx := context.Background()
+			if err := r.Flush(ctx); err != nil {
+				utils.Logger(ctx).WithError(err).Error("failed to post ledger transactions, retrying")
+			}
+		})
+	}
+	return failed
+}
+
+// Close stop retries and post queued transactions the last time.
+// It returns error if some transactions still aren't posted, they are lost
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	r.closed = true
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.mu.Unlock()
+
+	if err := r.Flush(ctx); err != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return errors.Wrapf(err, "%d ledger transactions aren't posted", len(r.queue))
+	}
+	return nil
+}
+
+// transactions return transactions of money moved by session last transition
+func (r *Recorder) transactions(s *session.Session) ([]*Transaction, error) {
+	if len(s.History) == 0 {
+		return nil, nil
+	}
+	h := s.History[len(s.History)-1]
+	amount := money.New(s.Amount, money.Currency(s.Currency))
+
+	newTx := func(kind Kind, id string, entries ...[]Entry) *Transaction {
+		t := &Transaction{ID: s.ID + ":" + id, Kind: kind, Reference: s.ID, PostedAt: h.At}
+		for _, e := range entries {
+			t.Entries = append(t.Entries, e...)
+		}
+		return t
+	}
+	// release moves authorized amount back, so held accounts are zero once payment is captured or voided
+	release := Transfer(MerchantAuthorized(s.Tenant), ProviderAuthorized(s.Provider), amount)
+
+	switch h.To {
+	case session.StatusAuthorized:
+		return []*Transaction{
+			newTx(KindAuthorization, string(KindAuthorization), Transfer(ProviderAuthorized(s.Provider), MerchantAuthorized(s.Tenant), amount)),
+		}, nil
+	case session.StatusFailed, session.StatusExpired:
+		if h.From != session.StatusAuthorized {
+			return nil, nil
+		}
+		return []*Transaction{newTx(KindVoid, string(KindVoid), release)}, nil
+	case session.StatusCaptured:
+		capture := Transfer(ProviderClearing(s.Provider), MerchantReceivable(s.Tenant), amount)
+		if h.From != session.StatusAuthorized {
+			release = nil
+		}
+		txs := []*Transaction{newTx(KindCapture, string(KindCapture), release, capture)}
+
+		fee, err := r.fees[s.Provider].Of(amount)
+		if err != nil {
+			return nil, errors.Wrapf(err, "provider %s fee", s.Provider)
+		}
+		if !fee.IsZero() {
+			txs = append(txs, newTx(KindFee, string(KindFee), Transfer(Fees(s.Provider), ProviderClearing(s.Provider), fee)))
+		}
+		return txs, nil
+	case session.StatusPartiallyRefunded, session.StatusRefunded:
+		rf, ok := s.Refund(h.Refund)
+		if !ok {
+			return nil, errors.Errorf("refund %q of transition isn't found", h.Refund)
+		}
+		refunded := money.New(rf.Amount, money.Currency(rf.Currency))
+		return []*Transaction{
+			newTx(KindRefund, rf.ID, Transfer(MerchantReceivable(s.Tenant), ProviderClearing(s.Provider), refunded)),
+		}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,184 @@
+package ledger
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+)
+
+func TestRecorder_Record(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(NewMemoryStore())
+	r := NewRecorder(l, map[string]Fee{"apay": {RateBPS: 290, Fixed: 30}})
+
+	s := &session.Session{ID: "pay_1", Tenant: "shop", Amount: 1000, Currency: "USD", Provider: "apay", Status: session.StatusPending}
+	move := func(to session.Status) {
+		at = at.Add(time.Minute)
+		require.NoError(t, s.Transition(to, at, ""))
+		r.Record(ctx, s.Clone())
+	}
+
+	move(session.StatusAuthorized)
+	// repeated notification is posted once
+	r.Record(ctx, s.Clone())
+	authorized := at
+	move(session.StatusCaptured)
+	captured := at
+
+	s.Refunds = append(s.Refunds, &session.Refund{ID: "re_1", Amount: 400, Currency: "USD", Status: session.RefundSucceeded})
+	at = at.Add(time.Minute)
+	require.NoError(t, s.Transition(session.StatusPartiallyRefunded, at, ""))
+	s.History[len(s.History)-1].Refund = "re_1"
+	r.Record(ctx, s.Clone())
+
+	txs, err := l.store.Transactions(ctx, at)
+	require.NoError(t, err)
+	usd := func(amount int64) money.Money { return money.New(amount, money.USD) }
+	require.Equal(t, []*Transaction{
+		{
+			ID:        "pay_1:authorization",
+			Kind:      KindAuthorization,
+			Reference: "pay_1",
+			Entries:   Transfer("provider:apay:authorized", "merchant:shop:authorized", usd(1000)),
+			PostedAt:  authorized,
+		},
+		{
+			ID:        "pay_1:capture",
+			Kind:      KindCapture,
+			Reference: "pay_1",
+			Entries: append(
+				Transfer("merchant:shop:authorized", "provider:apay:authorized", usd(1000)),
+				Transfer("provider:apay:clearing", "merchant:shop:receivable", usd(1000))...,
+			),
+			PostedAt: captured,
+		},
+		{
+			ID:        "pay_1:fee",
+			Kind:      KindFee,
+			Reference: "pay_1",
+			Entries:   Transfer("fees:apay", "provider:apay:clearing", usd(59)),
+			PostedAt:  captured,
+		},
+		{
+			ID:        "pay_1:re_1",
+			Kind:      KindRefund,
+			Reference: "pay_1",
+			Entries:   Transfer("merchant:shop:receivable", "provider:apay:clearing", usd(400)),
+			PostedAt:  at,
+		},
+	}, txs)
+
+	tb, err := l.TrialBalance(ctx, at)
+	require.NoError(t, err)
+	require.True(t, tb.Balanced)
+	net := make(map[Account]money.Money)
+	for _, b := range tb.Accounts {
+		net[b.Account] = b.Net()
+	}
+	require.Equal(t, map[Account]money.Money{
+		"provider:apay:authorized": usd(0),
+		"merchant:shop:authorized": usd(0),
+		"provider:apay:clearing":   usd(541),
+		"merchant:shop:receivable": usd(-600),
+		"fees:apay":                usd(59),
+	}, net)
+}
+
+func TestRecorder_RecordVoid(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		history []session.Status
+		kinds   []Kind
+	}{
+		{name: "captured without authorization", history: []session.Status{session.StatusCaptured}, kinds: []Kind{KindCapture}},
+		{name: "failed", history: []session.Status{session.StatusFailed}},
+		{name: "authorization expired", history: []session.Status{session.StatusAuthorized, session.StatusExpired}, kinds: []Kind{KindAuthorization, KindVoid}},
+	}
+	for _, tt := range tests {
+		l := New(NewMemoryStore())
+		r := NewRecorder(l, nil)
+		s := &session.Session{ID: "pay_1", Tenant: "shop", Amount: 1000, Currency: "EUR", Provider: "gpay", Status: session.StatusPending}
+		for _, to := range tt.history {
+			require.NoError(t, s.Transition(to, at, ""), tt.name)
+			r.Record(ctx, s.Clone())
+		}
+
+		tb, err := l.TrialBalance(ctx, at)
+		require.NoError(t, err, tt.name)
+		require.True(t, tb.Balanced, tt.name)
+		txs, err := l.store.Transactions(ctx, at)
+		require.NoError(t, err, tt.name)
+		var kinds []Kind
+		for _, tx := range txs {
+			kinds = append(kinds, tx.Kind)
+		}
+		require.Equal(t, tt.kinds, kinds, tt.name)
+	}
+}
+
+// failingStore store failing to append transactions while fail is set
+type failingStore struct {
+	Store
+	fail int32
+}
+
+func (s *failingStore) Append(ctx context.Context, t *Transaction) error {
+	if atomic.LoadInt32(&s.fail) == 1 {
+		return errors.New("disk is full")
+	}
+	return s.Store.Append(ctx, t)
+}
+
+func TestRecorder_RecordRetry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &failingStore{Store: NewMemoryStore(), fail: 1}
+	l := New(store)
+	r := NewRecorder(l, nil)
+	r.retry = time.Millisecond
+
+	s := &session.Session{ID: "pay_1", Tenant: "shop", Amount: 1000, Currency: "USD", Provider: "apay", Status: session.StatusPending}
+	require.NoError(t, s.Transition(session.StatusAuthorized, time.Now(), ""))
+	r.Record(ctx, s.Clone())
+	require.NoError(t, s.Transition(session.StatusCaptured, time.Now(), ""))
+	r.Record(ctx, s.Clone())
+	require.Error(t, r.Flush(ctx))
+
+	// queued transactions are posted in order once store recovers
+	atomic.StoreInt32(&store.fail, 0)
+	var kinds []Kind
+	require.Eventually(t, func() bool {
+		txs, err := store.Transactions(ctx, time.Now())
+		require.NoError(t, err)
+		kinds = kinds[:0]
+		for _, tx := range txs {
+			kinds = append(kinds, tx.Kind)
+		}
+		return len(txs) == 2
+	}, time.Second, time.Millisecond)
+	require.Equal(t, []Kind{KindAuthorization, KindCapture}, kinds)
+	require.NoError(t, r.Close(ctx))
+
+	// transactions not posted on close are reported
+	atomic.StoreInt32(&store.fail, 1)
+	require.NoError(t, s.Transition(session.StatusRefunded, time.Now(), ""))
+	s.Refunds = []*session.Refund{{ID: "re_1", Amount: 1000, Currency: "USD", Status: session.RefundSucceeded}}
+	s.History[len(s.History)-1].Refund = "re_1"
+	r.Record(ctx, s.Clone())
+	require.Error(t, r.Close(ctx))
+}
@@ -0,0 +1,196 @@
+package ledger
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxRecordSize max size of transaction line
+const maxRecordSize = 1 << 20
+
+// Store ledger transactions storage. Posted transactions are never changed
+type Store interface {
+	// Append store posted transaction. ErrExists is returned if transaction id is taken
+	Append(ctx context.Context, t *Transaction) error
+	// Transactions return transactions posted not after asOf in append order
+	Transactions(ctx context.Context, asOf time.Time) ([]*Transaction, error)
+}
+
+// MemoryStore in-memory transactions storage. Transactions are lost on restart
+type MemoryStore struct {
+	mu   sync.RWMutex
+	txs  []*Transaction
+	byID map[string]struct{}
+}
+
+// NewMemoryStore construct empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{byID: make(map[string]struct{})}
+}
+
+// Append store copy of transaction
+func (s *MemoryStore) Append(_ context.Context, t *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.append(t)
+}
+
+// append store copy of transaction, mu should be held
+func (s *MemoryStore) append(t *Transaction) error {
+	if _, ok := s.byID[t.ID]; ok {
+		return errors.Wrapf(ErrExists, "transaction %s", t.ID)
+	}
+	s.txs = append(s.txs, t.Clone())
+	s.byID[t.ID] = struct{}{}
+	return nil
+}
+
+// Transactions return copies of transactions posted not after asOf
+func (s *MemoryStore) Transactions(_ context.Context, asOf time.Time) ([]*Transaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var txs []*Transaction
+	for _, t := range s.txs {
+		if !t.PostedAt.After(asOf) {
+			txs = append(txs, t.Clone())
+		}
+	}
+	return txs, nil
+}
+
+// exists check that transaction id is taken
+func (s *MemoryStore) exists(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.byID[id]
+	return ok
+}
+
+// FileStore transactions storage persisted to append-only file of JSON lines.
+// Transactions are kept in memory and loaded from file on open
+type FileStore struct {
+	path string
+
+	mu  sync.Mutex
+	mem *MemoryStore
+	f   *os.File
+}
+
+// OpenFileStore load transactions from file creating it if there is no one.
+// Truncated last line left by crash is dropped
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, mem: NewMemoryStore()}
+	size, err := s.load()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s.f = f
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, errors.WithStack(err)
+	}
+	if size > fi.Size() {
+		// newline of the last line wasn't written, so appended transactions would be glued to it
+		if _, err := f.Write([]byte{'\n'}); err != nil {
+			f.Close()
+			return nil, errors.WithStack(err)
+		}
+	}
+	return s, nil
+}
+
+// load read transactions from file and return its valid size counting newline of every line
+func (s *FileStore) load() (int64, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxRecordSize)
+	var (
+		broken error
+		// valid size of file without broken last line
+		size int64
+	)
+	for line := 1; sc.Scan(); line++ {
+		if broken != nil {
+			return 0, broken
+		}
+
+		t := &Transaction{}
+		if err := json.Unmarshal(sc.Bytes(), t); err != nil {
+			// only the last line may be broken by interrupted write
+			broken = errors.Wrapf(err, "%s:%d", s.path, line)
+			continue
+		}
+		if err := s.mem.append(t); err != nil {
+			return 0, errors.Wrapf(err, "%s:%d", s.path, line)
+		}
+		size += int64(len(sc.Bytes())) + 1
+	}
+	if err := sc.Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if broken == nil {
+		return size, nil
+	}
+
+	// drop broken line, so appended transactions start on a new line
+	return size, errors.WithStack(os.Truncate(s.path, size))
+}
+
+// Append store transaction once it's written to file
+func (s *FileStore) Append(ctx context.Context, t *Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mem.exists(t.ID) {
+		return errors.Wrapf(ErrExists, "transaction %s", t.ID)
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return errors.WithStack(err)
+	}
+	return s.mem.Append(ctx, t)
+}
+
+// Transactions return transactions posted not after asOf
+func (s *FileStore) Transactions(ctx context.Context, asOf time.Time) ([]*Transaction, error) {
+	return s.mem.Transactions(ctx, asOf)
+}
+
+// Close close file
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.WithStack(s.f.Close())
+}
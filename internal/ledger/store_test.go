@@ -0,0 +1,109 @@
+package ledger
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+)
+
+func TestFileStore(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "ledger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ledger.jsonl")
+
+	ctx := context.Background()
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+
+	tx1 := &Transaction{ID: "tx_1", Kind: KindCapture, Entries: Transfer("a", "b", money.New(999, money.USD)), PostedAt: at}
+	tx2 := &Transaction{ID: "tx_2", Kind: KindRefund, Entries: Transfer("b", "a", money.New(100, money.USD)), PostedAt: at.Add(time.Minute)}
+	require.NoError(t, s.Append(ctx, tx1))
+	require.NoError(t, s.Append(ctx, tx2))
+	require.Equal(t, ErrExists, errors.Cause(s.Append(ctx, tx1)))
+	require.NoError(t, s.Close())
+
+	// interrupted write leaves broken last line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"id":"tx_3","ki`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	txs, err := s.Transactions(ctx, at.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []*Transaction{tx1, tx2}, txs)
+
+	txs, err = s.Transactions(ctx, at)
+	require.NoError(t, err)
+	require.Equal(t, []*Transaction{tx1}, txs)
+
+	// broken line is dropped, so the next transaction is readable
+	tx3 := &Transaction{ID: "tx_3", Kind: KindFee, Entries: Transfer("c", "a", money.New(30, money.EUR)), PostedAt: at.Add(time.Minute)}
+	require.NoError(t, s.Append(ctx, tx3))
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 3, strings.Count(string(b), "\n"))
+	require.NotContains(t, string(b), `"ki`+"\n")
+}
+
+func TestOpenFileStore_Broken(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "ledger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ledger.jsonl")
+
+	// broken line followed by others isn't left by interrupted write
+	require.NoError(t, ioutil.WriteFile(path, []byte("{\"id\":\"tx_1\n{\"id\":\"tx_2\"}\n"), 0o600))
+	_, err = OpenFileStore(path)
+	require.Error(t, err)
+
+	// transaction is appended once
+	tx := `{"id":"tx_1","kind":"fee","entries":[]}` + "\n"
+	require.NoError(t, ioutil.WriteFile(path, []byte(tx+tx), 0o600))
+	_, err = OpenFileStore(path)
+	require.Equal(t, ErrExists, errors.Cause(err))
+}
+
+func TestOpenFileStore_MissingNewline(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "ledger")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ledger.jsonl")
+
+	// the last line is written, but its newline isn't
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"id":"tx_1","kind":"fee","entries":[]}`), 0o600))
+	s, err := OpenFileStore(path)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, s.Append(ctx, &Transaction{ID: "tx_2", Kind: KindFee, Entries: []Entry{}}))
+	require.NoError(t, s.Close())
+
+	s, err = OpenFileStore(path)
+	require.NoError(t, err)
+	defer s.Close()
+	txs, err := s.Transactions(ctx, time.Now())
+	require.NoError(t, err)
+	require.Len(t, txs, 2)
+}
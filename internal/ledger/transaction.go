@@ -0,0 +1,159 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+)
+
+// Account ledger account name
+type Account string
+
+// MerchantAuthorized merchant account of authorized, not captured yet payments
+func MerchantAuthorized(tenant string) Account {
+	return Account("merchant:" + tenant + ":authorized")
+}
+
+// MerchantReceivable merchant account of captured payments the merchant is owed
+func MerchantReceivable(tenant string) Account {
+	return Account("merchant:" + tenant + ":receivable")
+}
+
+// ProviderAuthorized provider account of payments authorizations held
+func ProviderAuthorized(provider string) Account {
+	return Account("provider:" + provider + ":authorized")
+}
+
+// ProviderClearing provider account of captured payments the provider is to settle
+func ProviderClearing(provider string) Account {
+	return Account("provider:" + provider + ":clearing")
+}
+
+// Fees account of provider fees
+func Fees(provider string) Account {
+	return Account("fees:" + provider)
+}
+
+// Direction entry side
+type Direction string
+
+// entries directions
+const (
+	Debit  Direction = "debit"
+	Credit Direction = "credit"
+)
+
+// Kind money movement transaction records
+type Kind string
+
+// transactions kinds
+const (
+	// KindAuthorization provider authorized payment, amount is held
+	KindAuthorization Kind = "authorization"
+	// KindVoid payment authorization is released without capture
+	KindVoid Kind = "void"
+	// KindCapture payment is captured
+	KindCapture Kind = "capture"
+	// KindRefund captured payment is refunded
+	KindRefund Kind = "refund"
+	// KindFee provider fee of captured payment
+	KindFee Kind = "fee"
+)
+
+var (
+	// ErrUnbalanced returned when transaction debits don't equal credits in some currency
+	ErrUnbalanced = errors.New("unbalanced transaction")
+	// ErrInvalidTransaction returned when transaction isn't well formed
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	// ErrExists returned when transaction with the same id is already posted
+	ErrExists = errors.New("transaction already exists")
+)
+
+// Entry debit or credit of account
+type Entry struct {
+	Account   Account   `json:"account"`
+	Direction Direction `json:"direction"`
+	// Amount positive entry amount
+	Amount money.Money `json:"amount"`
+}
+
+// Transaction balanced set of entries posted at once
+type Transaction struct {
+	// ID unique transaction id. Transaction with the same id is posted once
+	ID   string `json:"id"`
+	Kind Kind   `json:"kind"`
+	// Reference id of moved money source, e.g. payment session id
+	Reference   string    `json:"reference,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Entries     []Entry   `json:"entries"`
+	PostedAt    time.Time `json:"posted_at"`
+}
+
+// Validate check that transaction is well formed and its debits equal credits in every currency
+func (t *Transaction) Validate() error {
+	if t.ID == "" {
+		return errors.Wrap(ErrInvalidTransaction, "id is required")
+	}
+	if t.Kind == "" {
+		return errors.Wrapf(ErrInvalidTransaction, "%s kind is required", t.ID)
+	}
+	if len(t.Entries) < 2 {
+		return errors.Wrapf(ErrInvalidTransaction, "%s has less than 2 entries", t.ID)
+	}
+
+	// debits minus credits by currency
+	sums := make(map[money.Currency]money.Money)
+	for i, e := range t.Entries {
+		if e.Account == "" {
+			return errors.Wrapf(ErrInvalidTransaction, "%s entry %d account is required", t.ID, i)
+		}
+		if !e.Amount.Currency().Valid() {
+			return errors.Wrapf(money.ErrUnknownCurrency, "%s entry %d %q", t.ID, i, e.Amount.Currency())
+		}
+		if e.Amount.IsZero() || e.Amount.IsNegative() {
+			return errors.Wrapf(ErrInvalidTransaction, "%s entry %d amount %s should be positive", t.ID, i, e.Amount)
+		}
+
+		sum, ok := sums[e.Amount.Currency()]
+		if !ok {
+			sum = money.New(0, e.Amount.Currency())
+		}
+		var err error
+		switch e.Direction {
+		case Debit:
+			sum, err = sum.Add(e.Amount)
+		case Credit:
+			sum, err = sum.Sub(e.Amount)
+		default:
+			return errors.Wrapf(ErrInvalidTransaction, "%s entry %d unknown direction %q", t.ID, i, e.Direction)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s entry %d", t.ID, i)
+		}
+		sums[e.Amount.Currency()] = sum
+	}
+
+	for _, sum := range sums {
+		if !sum.IsZero() {
+			return errors.Wrapf(ErrUnbalanced, "%s debits minus credits is %s", t.ID, sum)
+		}
+	}
+	return nil
+}
+
+// Clone return deep copy of transaction
+func (t *Transaction) Clone() *Transaction {
+	c := *t
+	c.Entries = append([]Entry(nil), t.Entries...)
+	return &c
+}
+
+// Transfer return entries moving amount from debited account to credited one
+func Transfer(debit, credit Account, amount money.Money) []Entry {
+	return []Entry{
+		{Account: debit, Direction: Debit, Amount: amount},
+		{Account: credit, Direction: Credit, Amount: amount},
+	}
+}
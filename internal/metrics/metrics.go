@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+// Metrics payments service metrics
+type Metrics struct {
+	*Registry
+
+	// HTTPRequests handled requests by route, method and status code
+	HTTPRequests *CounterVec
+	// HTTPDuration requests latency by route and method
+	HTTPDuration *HistogramVec
+	// HTTPInFlight requests being handled
+	HTTPInFlight *Gauge
+	// ProviderCalls providers calls by provider and result class
+	ProviderCalls *CounterVec
+	// ProviderDuration providers calls latency by provider
+	ProviderDuration *HistogramVec
+	// Fallbacks responses with app store urls by failed provider error class
+	Fallbacks *CounterVec
+	// CacheLookups providers pay urls cache lookups by provider and result
+	CacheLookups *CounterVec
+	// RateLimited requests rejected by rate limiter ("client", "tenant" or "provider") by tenant or provider name
+	RateLimited *CounterVec
+	// WebhookDeliveries merchants webhooks delivery attempts by tenant and result
+	WebhookDeliveries *CounterVec
+}
+
+// New construct payments service metrics
+func New() *Metrics {
+	r := NewRegistry()
+
+	return &Metrics{
+		Registry: r,
+		HTTPRequests: r.NewCounterVec("payments_http_requests_total",
+			"Total number of handled http requests.", "route", "method", "status"),
+		HTTPDuration: r.NewHistogramVec("payments_http_request_duration_seconds",
+			"Http requests latency in seconds.", DefaultBuckets, "route", "method"),
+		HTTPInFlight: r.NewGauge("payments_http_requests_in_flight",
+			"Number of http requests being handled."),
+		ProviderCalls: r.NewCounterVec("payments_provider_calls_total",
+			"Total number of payment providers calls.", "provider", "result"),
+		ProviderDuration: r.NewHistogramVec("payments_provider_call_duration_seconds",
+			"Payment providers calls latency in seconds.", DefaultBuckets, "provider"),
+		Fallbacks: r.NewCounterVec("payments_fallback_responses_total",
+			"Total number of responses with app store urls instead of payment urls.", "reason"),
+		CacheLookups: r.NewCounterVec("payments_provider_cache_lookups_total",
+			"Total number of providers pay urls cache lookups.", "provider", "result"),
+		RateLimited: r.NewCounterVec("payments_rate_limited_total",
+			"Total number of requests and providers calls rejected by rate limits.", "limiter", "name"),
+		WebhookDeliveries: r.NewCounterVec("payments_webhook_deliveries_total",
+			"Total number of merchants webhooks delivery attempts.", "tenant", "result"),
+	}
+}
+
+// instrumentedProvider payment provider decorator collecting calls metrics
+type instrumentedProvider struct {
+	name string
+	p    providers.Provider
+	m    *Metrics
+}
+
+// InstrumentProvider wrap provider to collect calls count, latency and errors classes
+func (m *Metrics) InstrumentProvider(name string, p providers.Provider) providers.Provider {
+	return &instrumentedProvider{name: name, p: p, m: m}
+}
+
+// GetPayURL call provider and collect call metrics
+func (ip *instrumentedProvider) GetPayURL(ctx context.Context, req *providers.PaymentRequest) (string, error) {
+	start := time.Now()
+	u, err := ip.p.GetPayURL(ctx, req)
+
+	ip.m.ProviderDuration.Observe(time.Since(start).Seconds(), ip.name)
+	ip.m.ProviderCalls.Inc(ip.name, providers.ErrorClass(err))
+	return u, err
+}
+
+// Refund refund payment by provider and collect call metrics
+func (ip *instrumentedProvider) Refund(ctx context.Context, req *providers.RefundRequest) (string, error) {
+	start := time.Now()
+	id, err := providers.Refund(ctx, ip.p, req)
+
+	ip.m.ProviderDuration.Observe(time.Since(start).Seconds(), ip.name)
+	ip.m.ProviderCalls.Inc(ip.name, providers.ErrorClass(err))
+	return id, err
+}
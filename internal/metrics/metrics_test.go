@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test counter.", "code")
+	g := r.NewGauge("test_in_flight", "Test gauge.")
+	h := r.NewHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1}, "route")
+
+	c.Inc("200")
+	c.Add(2, "200")
+	c.Inc(`"quoted"\`)
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+
+	buf := &bytes.Buffer{}
+	n, err := r.WriteTo(buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(buf.Len()), n)
+	require.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{code="\"quoted\"\\"} 1
+test_total{code="200"} 3
+# HELP test_in_flight Test gauge.
+# TYPE test_in_flight gauge
+test_in_flight 1
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{route="/a",le="0.1"} 1
+test_seconds_bucket{route="/a",le="1"} 2
+test_seconds_bucket{route="/a",le="+Inf"} 3
+test_seconds_sum{route="/a"} 5.55
+test_seconds_count{route="/a"} 3
+`, buf.String())
+
+	require.Equal(t, float64(3), c.Value("200"))
+	require.Equal(t, float64(0), c.Value("500"))
+	require.Equal(t, uint64(3), h.Count("/a"))
+	require.Panics(t, func() { c.Inc() })
+	require.Panics(t, func() { c.Add(-1, "200") })
+}
+
+func TestMetrics_InstrumentProvider(t *testing.T) {
+	t.Parallel()
+
+	m := New()
+	pMock := &mocks.Provider{}
+	p := m.InstrumentProvider("apay", pMock)
+
+	pMock.On("GetPayURL", mock.Anything, &providers.PaymentRequest{ProductID: "ok"}).Return("url", nil).Once()
+	pMock.On("GetPayURL", mock.Anything, &providers.PaymentRequest{ProductID: "fail"}).Return("", errors.Wrap(providers.ErrNotOK, "apay")).Twice()
+
+	_, _ = p.GetPayURL(context.Background(), &providers.PaymentRequest{ProductID: "ok"})
+	_, _ = p.GetPayURL(context.Background(), &providers.PaymentRequest{ProductID: "fail"})
+	_, _ = p.GetPayURL(context.Background(), &providers.PaymentRequest{ProductID: "fail"})
+
+	require.Equal(t, float64(1), m.ProviderCalls.Value("apay", providers.ClassOK))
+	require.Equal(t, float64(2), m.ProviderCalls.Value("apay", providers.ClassNotOK))
+	require.Equal(t, uint64(3), m.ProviderDuration.Count("apay"))
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
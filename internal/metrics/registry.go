@@ -0,0 +1,348 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets default histogram buckets in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector metric which could be written in prometheus text exposition format
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Registry set of metrics exposed together
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry construct empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounterVec register counter partitioned by labels
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, labels)}
+	r.register(c)
+	return c
+}
+
+// NewGauge register gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, nil)}
+	r.register(g)
+	return g
+}
+
+// NewHistogramVec register histogram partitioned by labels. Buckets should be sorted
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{vec: newVec(name, help, labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo write all metrics in prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, c := range collectors {
+		if err := c.write(cw); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ServeHTTP expose metrics in prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// vec common part of metrics partitioned by labels
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series single metric values for labels values
+type series struct {
+	labelValues []string
+	value       float64
+	// buckets and count used by histograms only
+	buckets []uint64
+	count   uint64
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{name: name, help: help, labels: labels, series: make(map[string]*series)}
+}
+
+// get return series for label values creating it if needed. Should be called under lock
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+// lookup return series for label values if exists. Should be called under lock
+func (v *vec) lookup(labelValues []string) (*series, bool) {
+	s, ok := v.series[strings.Join(labelValues, "\xff")]
+	return s, ok
+}
+
+// sorted return series sorted by labels values. Should be called under lock
+func (v *vec) sorted() []*series {
+	ss := make([]*series, 0, len(v.series))
+	for _, s := range v.series {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		return strings.Join(ss[i].labelValues, "\xff") < strings.Join(ss[j].labelValues, "\xff")
+	})
+	return ss
+}
+
+// writeHeader write metric help and type
+func (v *vec) writeHeader(w io.Writer, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, typ)
+	return err
+}
+
+// labelsString format labels pairs with optional extra label
+func (v *vec) labelsString(values []string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, l := range v.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l, escapeLabel(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, escapeLabel(extraValue)))
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec monotonically increasing counter partitioned by labels
+type CounterVec struct {
+	vec
+}
+
+// Inc increment counter for labels values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add add non negative value to counter for labels values
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s can't decrease", c.name))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.get(labelValues).value += v
+}
+
+// Value return counter value for labels values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.lookup(labelValues); ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.writeHeader(w, "counter"); err != nil {
+		return err
+	}
+	for _, s := range c.sorted() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelsString(s.labelValues, "", ""), formatFloat(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gauge value which could go up and down
+type Gauge struct {
+	vec
+}
+
+// Inc increment gauge
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec decrement gauge
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Add add value to gauge
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(nil).value += v
+}
+
+// Value return gauge value
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.get(nil).value
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := g.writeHeader(w, "gauge"); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.get(nil).value))
+	return err
+}
+
+// HistogramVec observations distribution partitioned by labels
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// Observe add observation for labels values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.buckets))
+	}
+
+	for i, ub := range h.buckets {
+		if v <= ub {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// Count return number of observations for labels values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.lookup(labelValues); ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	for _, s := range h.sorted() {
+		for i, ub := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelsString(s.labelValues, "le", formatFloat(ub)), s.buckets[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, h.labelsString(s.labelValues, "le", "+Inf"), s.count,
+			h.name, h.labelsString(s.labelValues, "", ""), formatFloat(s.value),
+			h.name, h.labelsString(s.labelValues, "", ""), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFloat format value as prometheus expects
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+// countingWriter count written bytes
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
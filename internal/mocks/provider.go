@@ -5,6 +5,7 @@ package mocks
 import (
 	context "context"
 
+	providers "github.com/fedoseev-vitaliy/payments/internal/providers"
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -13,20 +14,20 @@ type Provider struct {
 	mock.Mock
 }
 
-// GetPayURL provides a mock function with given fields: ctx, productID
-func (_m *Provider) GetPayURL(ctx context.Context, productID string) (string, error) {
-	ret := _m.Called(ctx, productID)
+// GetPayURL provides a mock function with given fields: ctx, req
+func (_m *Provider) GetPayURL(ctx context.Context, req *providers.PaymentRequest) (string, error) {
+	ret := _m.Called(ctx, req)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
-		r0 = rf(ctx, productID)
+	if rf, ok := ret.Get(0).(func(context.Context, *providers.PaymentRequest) string); ok {
+		r0 = rf(ctx, req)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, productID)
+	if rf, ok := ret.Get(1).(func(context.Context, *providers.PaymentRequest) error); ok {
+		r1 = rf(ctx, req)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,114 @@
+package money
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownCurrency returned for currency code which isn't ISO 4217 currency
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// Currency ISO 4217 alphabetic currency code
+type Currency string
+
+// common currencies
+const (
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+	GBP Currency = "GBP"
+	JPY Currency = "JPY"
+	BHD Currency = "BHD"
+)
+
+// currencyInfo currency minor units exponent and display symbol
+type currencyInfo struct {
+	exponent int
+	symbol   string
+}
+
+// currencies ISO 4217 currencies. Symbol is currency code if empty
+var currencies = map[Currency]currencyInfo{
+	"AED": {exponent: 2},
+	"ARS": {exponent: 2},
+	"AUD": {exponent: 2, symbol: "A$"},
+	"BGN": {exponent: 2},
+	"BHD": {exponent: 3},
+	"BRL": {exponent: 2, symbol: "R$"},
+	"CAD": {exponent: 2, symbol: "CA$"},
+	"CHF": {exponent: 2},
+	"CLP": {exponent: 0},
+	"CNY": {exponent: 2, symbol: "CN¥"},
+	"COP": {exponent: 2},
+	"CZK": {exponent: 2, symbol: "Kč"},
+	"DKK": {exponent: 2},
+	"EGP": {exponent: 2},
+	"EUR": {exponent: 2, symbol: "€"},
+	"GBP": {exponent: 2, symbol: "£"},
+	"HKD": {exponent: 2, symbol: "HK$"},
+	"HUF": {exponent: 2, symbol: "Ft"},
+	"IDR": {exponent: 2, symbol: "Rp"},
+	"ILS": {exponent: 2, symbol: "₪"},
+	"INR": {exponent: 2, symbol: "₹"},
+	"IQD": {exponent: 3},
+	"ISK": {exponent: 0},
+	"JOD": {exponent: 3},
+	"JPY": {exponent: 0, symbol: "¥"},
+	"KRW": {exponent: 0, symbol: "₩"},
+	"KWD": {exponent: 3},
+	"KZT": {exponent: 2, symbol: "₸"},
+	"LYD": {exponent: 3},
+	"MXN": {exponent: 2, symbol: "MX$"},
+	"MYR": {exponent: 2, symbol: "RM"},
+	"NOK": {exponent: 2},
+	"NZD": {exponent: 2, symbol: "NZ$"},
+	"OMR": {exponent: 3},
+	"PHP": {exponent: 2, symbol: "₱"},
+	"PLN": {exponent: 2, symbol: "zł"},
+	"RON": {exponent: 2},
+	"RUB": {exponent: 2, symbol: "₽"},
+	"SAR": {exponent: 2},
+	"SEK": {exponent: 2},
+	"SGD": {exponent: 2, symbol: "S$"},
+	"THB": {exponent: 2, symbol: "฿"},
+	"TND": {exponent: 3},
+	"TRY": {exponent: 2, symbol: "₺"},
+	"TWD": {exponent: 2, symbol: "NT$"},
+	"UAH": {exponent: 2, symbol: "₴"},
+	"UGX": {exponent: 0},
+	"USD": {exponent: 2, symbol: "$"},
+	"VND": {exponent: 0, symbol: "₫"},
+	"XAF": {exponent: 0},
+	"XOF": {exponent: 0},
+	"ZAR": {exponent: 2, symbol: "R"},
+}
+
+// ParseCurrency return currency of ISO 4217 code
+func ParseCurrency(code string) (Currency, error) {
+	c := Currency(code)
+	if !c.Valid() {
+		return "", errors.Wrapf(ErrUnknownCurrency, "%q", code)
+	}
+	return c, nil
+}
+
+// Valid check that currency is known ISO 4217 currency
+func (c Currency) Valid() bool {
+	_, ok := currencies[c]
+	return ok
+}
+
+// Exponent return number of minor units digits, e.g. 2 for USD, 0 for JPY and 3 for BHD.
+// Unknown currency has 2 digits
+func (c Currency) Exponent() int {
+	if info, ok := currencies[c]; ok {
+		return info.exponent
+	}
+	return 2
+}
+
+// Symbol return currency display symbol, currency code if currency has no common symbol
+func (c Currency) Symbol() string {
+	if info, ok := currencies[c]; ok && info.symbol != "" {
+		return info.symbol
+	}
+	return string(c)
+}
@@ -0,0 +1,86 @@
+package money
+
+import (
+	"strings"
+)
+
+// localeFormat locale number and currency symbol conventions
+type localeFormat struct {
+	group   string
+	decimal string
+	// suffix symbol placed after amount, e.g. "9,99 €"
+	suffix bool
+	// space between symbol and amount
+	space string
+}
+
+const (
+	nbsp       = "\u00a0"
+	narrowNbsp = "\u202f"
+)
+
+// locales supported display locales. Locale is looked up by full tag and then by language
+var locales = map[string]localeFormat{
+	"en":    {group: ",", decimal: "."},
+	"de":    {group: ".", decimal: ",", suffix: true, space: nbsp},
+	"de-ch": {group: "’", decimal: ".", space: nbsp},
+	"es":    {group: ".", decimal: ",", suffix: true, space: nbsp},
+	"fr":    {group: narrowNbsp, decimal: ",", suffix: true, space: nbsp},
+	"it":    {group: ".", decimal: ",", suffix: true, space: nbsp},
+	"ja":    {group: ",", decimal: "."},
+	"nl":    {group: ".", decimal: ",", space: nbsp},
+	"pl":    {group: nbsp, decimal: ",", suffix: true, space: nbsp},
+	"pt":    {group: ".", decimal: ",", space: nbsp},
+	"ru":    {group: nbsp, decimal: ",", suffix: true, space: nbsp},
+	"uk":    {group: nbsp, decimal: ",", suffix: true, space: nbsp},
+	"zh":    {group: ",", decimal: "."},
+}
+
+// Format return amount formatted for display in locale, e.g. "$1,234.56" for en-US and "1.234,56 €" for de-DE.
+// Locale is BCP 47 language tag, unsupported locales are formatted as en
+func (m Money) Format(locale string) string {
+	lf := lookupLocale(locale)
+
+	whole, frac := m.parts()
+	var b strings.Builder
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(lf.group)
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(lf.decimal)
+		b.WriteString(frac)
+	}
+
+	symbol := m.currency.Symbol()
+	space := lf.space
+	if space == "" && len(symbol) == 3 && symbol == string(m.currency) {
+		// currency code is separated from amount even if symbol isn't
+		space = nbsp
+	}
+
+	s := symbol + space + b.String()
+	if lf.suffix {
+		s = b.String() + space + symbol
+	}
+	if m.amount < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// lookupLocale return locale format by full tag, then by language, falls back to en
+func lookupLocale(locale string) localeFormat {
+	tag := strings.ToLower(strings.Replace(locale, "_", "-", -1))
+	if lf, ok := locales[tag]; ok {
+		return lf
+	}
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		if lf, ok := locales[tag[:i]]; ok {
+			return lf
+		}
+	}
+	return locales["en"]
+}
@@ -0,0 +1,34 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoney_Format(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		m      Money
+		locale string
+		want   string
+	}{
+		{m: New(123456, USD), locale: "en-US", want: "$1,234.56"},
+		{m: New(-123456, USD), locale: "en", want: "-$1,234.56"},
+		{m: New(5, USD), locale: "en", want: "$0.05"},
+		{m: New(123456, EUR), locale: "de-DE", want: "1.234,56\u00a0€"},
+		{m: New(123456, EUR), locale: "de_AT", want: "1.234,56\u00a0€"},
+		{m: New(123456, "CHF"), locale: "de-CH", want: "CHF\u00a01’234.56"},
+		{m: New(123456, EUR), locale: "fr-FR", want: "1\u202f234,56\u00a0€"},
+		{m: New(123456789, JPY), locale: "ja-JP", want: "¥123,456,789"},
+		{m: New(1234567, BHD), locale: "en", want: "BHD\u00a01,234.567"},
+		{m: New(100, EUR), locale: "nl", want: "€\u00a01,00"},
+		{m: New(99900, "UAH"), locale: "uk-UA", want: "999,00\u00a0₴"},
+		{m: New(123456, USD), locale: "xx", want: "$1,234.56"},
+		{m: New(123456, USD), locale: "", want: "$1,234.56"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, tt.m.Format(tt.locale), "%s in %s", tt.m, tt.locale)
+	}
+}
@@ -0,0 +1,289 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrCurrencyMismatch returned by operations on amounts of different currencies
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrOverflow returned when operation result doesn't fit int64 minor units
+	ErrOverflow = errors.New("amount overflow")
+	// ErrInvalidAmount returned for malformed decimal amount
+	ErrInvalidAmount = errors.New("invalid amount")
+)
+
+// Money amount in currency minor units, e.g. cents. Floats are never used for amounts
+type Money struct {
+	amount   int64
+	currency Currency
+}
+
+// New construct money of amount in currency minor units
+func New(amount int64, c Currency) Money {
+	return Money{amount: amount, currency: c}
+}
+
+// Parse construct money of decimal amount in currency major units, e.g. "9.99".
+// Amount with more fraction digits than currency exponent is rejected
+func Parse(amount string, c Currency) (Money, error) {
+	if !c.Valid() {
+		return Money{}, errors.Wrapf(ErrUnknownCurrency, "%q", c)
+	}
+
+	s := amount
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+		if frac == "" {
+			return Money{}, errors.Wrapf(ErrInvalidAmount, "%q", amount)
+		}
+	}
+	exp := c.Exponent()
+	if whole == "" || len(frac) > exp || !digits(whole) || !digits(frac) {
+		return Money{}, errors.Wrapf(ErrInvalidAmount, "%q of %s", amount, c)
+	}
+
+	minor, err := strconv.ParseInt(whole+frac+strings.Repeat("0", exp-len(frac)), 10, 64)
+	if err != nil {
+		return Money{}, errors.Wrapf(ErrOverflow, "%q", amount)
+	}
+	if neg {
+		minor = -minor
+	}
+	return Money{amount: minor, currency: c}, nil
+}
+
+// Amount return amount in currency minor units
+func (m Money) Amount() int64 {
+	return m.amount
+}
+
+// Currency return money currency
+func (m Money) Currency() Currency {
+	return m.currency
+}
+
+// IsZero check that amount is zero
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+// IsNegative check that amount is less than zero
+func (m Money) IsNegative() bool {
+	return m.amount < 0
+}
+
+// Add return sum of amounts of the same currency
+func (m Money) Add(o Money) (Money, error) {
+	if m.currency != o.currency {
+		return Money{}, errors.Wrapf(ErrCurrencyMismatch, "%s + %s", m.currency, o.currency)
+	}
+	if (o.amount > 0 && m.amount > math.MaxInt64-o.amount) || (o.amount < 0 && m.amount < math.MinInt64-o.amount) {
+		return Money{}, errors.Wrapf(ErrOverflow, "%s + %s", m, o)
+	}
+	return Money{amount: m.amount + o.amount, currency: m.currency}, nil
+}
+
+// Sub return difference of amounts of the same currency
+func (m Money) Sub(o Money) (Money, error) {
+	if m.currency != o.currency {
+		return Money{}, errors.Wrapf(ErrCurrencyMismatch, "%s - %s", m.currency, o.currency)
+	}
+	if (o.amount < 0 && m.amount > math.MaxInt64+o.amount) || (o.amount > 0 && m.amount < math.MinInt64+o.amount) {
+		return Money{}, errors.Wrapf(ErrOverflow, "%s - %s", m, o)
+	}
+	return Money{amount: m.amount - o.amount, currency: m.currency}, nil
+}
+
+// Cmp compare amounts of the same currency. Return -1, 0 or 1 if m is less, equal or greater than o
+func (m Money) Cmp(o Money) (int, error) {
+	if m.currency != o.currency {
+		return 0, errors.Wrapf(ErrCurrencyMismatch, "%s and %s", m.currency, o.currency)
+	}
+	switch {
+	case m.amount < o.amount:
+		return -1, nil
+	case m.amount > o.amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Multiply return amount multiplied by n
+func (m Money) Multiply(n int64) (Money, error) {
+	return m.MultiplyRat(n, 1)
+}
+
+// MultiplyRat return amount multiplied by num/den, e.g. 7/100 for 7% tax.
+// Result is rounded half to even to minor units
+func (m Money) MultiplyRat(num, den int64) (Money, error) {
+	if den == 0 {
+		return Money{}, errors.New("zero denominator")
+	}
+
+	x := new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(num))
+	r := roundHalfEven(x, big.NewInt(den))
+	if !r.IsInt64() {
+		return Money{}, errors.Wrapf(ErrOverflow, "%s * %d/%d", m, num, den)
+	}
+	return Money{amount: r.Int64(), currency: m.currency}, nil
+}
+
+// Allocate split amount into parts proportional to ratios without losing minor units.
+// Minor units left after proportional split are given one by one to the first parts
+func (m Money) Allocate(ratios ...int64) ([]Money, error) {
+	if len(ratios) == 0 {
+		return nil, errors.New("no ratios to allocate by")
+	}
+	total := new(big.Int)
+	for _, r := range ratios {
+		if r < 0 {
+			return nil, errors.Errorf("negative ratio %d", r)
+		}
+		total.Add(total, big.NewInt(r))
+	}
+	if total.Sign() == 0 {
+		return nil, errors.New("ratios sum should be positive")
+	}
+
+	// allocate absolute amount, so remainder is given away in the same direction as amount
+	abs := new(big.Int).Abs(big.NewInt(m.amount))
+	parts := make([]Money, len(ratios))
+	left := new(big.Int).Set(abs)
+	for i, r := range ratios {
+		share := new(big.Int).Mul(abs, big.NewInt(r))
+		share.Quo(share, total)
+		left.Sub(left, share)
+		parts[i] = Money{amount: share.Int64(), currency: m.currency}
+	}
+	for i := 0; left.Sign() > 0; i++ {
+		if ratios[i%len(ratios)] == 0 {
+			continue
+		}
+		parts[i%len(ratios)].amount++
+		left.Sub(left, big.NewInt(1))
+	}
+
+	if m.amount < 0 {
+		for i := range parts {
+			parts[i].amount = -parts[i].amount
+		}
+	}
+	return parts, nil
+}
+
+// Split split amount into n equal parts without losing minor units. The first parts are bigger by minor unit
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, errors.Errorf("can't split into %d parts", n)
+	}
+	ratios := make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+	return m.Allocate(ratios...)
+}
+
+// Decimal return amount in currency major units, e.g. "9.99" for 999 USD minor units
+func (m Money) Decimal() string {
+	whole, frac := m.parts()
+	s := whole
+	if frac != "" {
+		s += "." + frac
+	}
+	if m.amount < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// String return decimal amount with currency code, e.g. "9.99 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + string(m.currency)
+}
+
+// moneyJSON money json representation
+type moneyJSON struct {
+	Amount   string   `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+// MarshalJSON encode money as decimal string amount and currency, e.g. {"amount": "9.99", "currency": "USD"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&moneyJSON{Amount: m.Decimal(), Currency: m.currency})
+}
+
+// UnmarshalJSON decode money of decimal string amount and currency
+func (m *Money) UnmarshalJSON(b []byte) error {
+	mj := &moneyJSON{}
+	if err := json.Unmarshal(b, mj); err != nil {
+		return err
+	}
+	v, err := Parse(mj.Amount, mj.Currency)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// parts return absolute amount whole and fraction digits
+func (m Money) parts() (string, string) {
+	// uint64 keeps absolute value of min int64
+	abs := uint64(m.amount)
+	if m.amount < 0 {
+		abs = -abs
+	}
+	s := strconv.FormatUint(abs, 10)
+
+	exp := m.currency.Exponent()
+	if exp == 0 {
+		return s, ""
+	}
+	if len(s) <= exp {
+		s = strings.Repeat("0", exp-len(s)+1) + s
+	}
+	return s[:len(s)-exp], s[len(s)-exp:]
+}
+
+// roundHalfEven return x/y rounded half to even (banker's rounding)
+func roundHalfEven(x, y *big.Int) *big.Int {
+	if y.Sign() < 0 {
+		x, y = new(big.Int).Neg(x), new(big.Int).Neg(y)
+	}
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+
+	// compare doubled remainder with divisor to find out if remainder is more than half
+	r2 := new(big.Int).Abs(r)
+	r2.Lsh(r2, 1)
+	switch c := r2.Cmp(y); {
+	case c > 0, c == 0 && q.Bit(0) == 1:
+		if x.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// digits check that s consists of decimal digits only
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
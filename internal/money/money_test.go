@@ -0,0 +1,192 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		amount   string
+		currency Currency
+		want     int64
+		wantErr  error
+	}{
+		{amount: "9.99", currency: USD, want: 999},
+		{amount: "9.9", currency: USD, want: 990},
+		{amount: "9", currency: USD, want: 900},
+		{amount: "-0.01", currency: USD, want: -1},
+		{amount: "1000", currency: JPY, want: 1000},
+		{amount: "1.234", currency: BHD, want: 1234},
+		{amount: "9.999", currency: USD, wantErr: ErrInvalidAmount},
+		{amount: "1.5", currency: JPY, wantErr: ErrInvalidAmount},
+		{amount: "9.", currency: USD, wantErr: ErrInvalidAmount},
+		{amount: ".99", currency: USD, wantErr: ErrInvalidAmount},
+		{amount: "1e3", currency: USD, wantErr: ErrInvalidAmount},
+		{amount: "+1", currency: USD, wantErr: ErrInvalidAmount},
+		{amount: "", currency: USD, wantErr: ErrInvalidAmount},
+		{amount: "92233720368547758.08", currency: USD, wantErr: ErrOverflow},
+		{amount: "1", currency: "XXX", wantErr: ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		m, err := Parse(tt.amount, tt.currency)
+		if tt.wantErr != nil {
+			require.Equal(t, tt.wantErr, errors.Cause(err), tt.amount)
+			continue
+		}
+		require.NoError(t, err, tt.amount)
+		require.Equal(t, New(tt.want, tt.currency), m, tt.amount)
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{m: New(999, USD), want: "9.99 USD"},
+		{m: New(5, USD), want: "0.05 USD"},
+		{m: New(-5, USD), want: "-0.05 USD"},
+		{m: New(0, EUR), want: "0.00 EUR"},
+		{m: New(1000, JPY), want: "1000 JPY"},
+		{m: New(1234, BHD), want: "1.234 BHD"},
+		{m: New(math.MinInt64, USD), want: "-92233720368547758.08 USD"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, tt.m.String())
+	}
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	t.Parallel()
+
+	sum, err := New(999, USD).Add(New(1, USD))
+	require.NoError(t, err)
+	require.Equal(t, New(1000, USD), sum)
+
+	diff, err := New(999, USD).Sub(New(1000, USD))
+	require.NoError(t, err)
+	require.Equal(t, New(-1, USD), diff)
+
+	_, err = New(999, USD).Add(New(1, EUR))
+	require.Equal(t, ErrCurrencyMismatch, errors.Cause(err))
+	_, err = New(999, USD).Sub(New(1, EUR))
+	require.Equal(t, ErrCurrencyMismatch, errors.Cause(err))
+
+	_, err = New(math.MaxInt64, USD).Add(New(1, USD))
+	require.Equal(t, ErrOverflow, errors.Cause(err))
+	_, err = New(math.MinInt64, USD).Add(New(-1, USD))
+	require.Equal(t, ErrOverflow, errors.Cause(err))
+	_, err = New(math.MinInt64, USD).Sub(New(1, USD))
+	require.Equal(t, ErrOverflow, errors.Cause(err))
+	_, err = New(0, USD).Sub(New(math.MinInt64, USD))
+	require.Equal(t, ErrOverflow, errors.Cause(err))
+
+	product, err := New(999, USD).Multiply(3)
+	require.NoError(t, err)
+	require.Equal(t, New(2997, USD), product)
+	_, err = New(math.MaxInt64/2+1, USD).Multiply(2)
+	require.Equal(t, ErrOverflow, errors.Cause(err))
+
+	cmp, err := New(1, USD).Cmp(New(2, USD))
+	require.NoError(t, err)
+	require.Equal(t, -1, cmp)
+	_, err = New(1, USD).Cmp(New(1, EUR))
+	require.Equal(t, ErrCurrencyMismatch, errors.Cause(err))
+}
+
+func TestMoney_MultiplyRat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		amount   int64
+		num, den int64
+		want     int64
+	}{
+		{amount: 25, num: 1, den: 10, want: 2},
+		{amount: 35, num: 1, den: 10, want: 4},
+		{amount: 26, num: 1, den: 10, want: 3},
+		{amount: -25, num: 1, den: 10, want: -2},
+		{amount: -35, num: 1, den: 10, want: -4},
+		{amount: 25, num: -1, den: 10, want: -2},
+		{amount: 25, num: 1, den: -10, want: -2},
+		{amount: 999, num: 7, den: 100, want: 70},
+		{amount: 1000, num: 1, den: 3, want: 333},
+		{amount: 2000, num: 1, den: 3, want: 667},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.amount, USD).MultiplyRat(tt.num, tt.den)
+		require.NoError(t, err)
+		require.Equal(t, New(tt.want, USD), got, "%d * %d/%d", tt.amount, tt.num, tt.den)
+	}
+
+	_, err := New(1, USD).MultiplyRat(1, 0)
+	require.Error(t, err)
+}
+
+func TestMoney_Allocate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		amount  int64
+		ratios  []int64
+		want    []int64
+		wantErr bool
+	}{
+		{name: "even", amount: 100, ratios: []int64{1, 1}, want: []int64{50, 50}},
+		{name: "remainder", amount: 100, ratios: []int64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{name: "proportional", amount: 5, ratios: []int64{3, 7}, want: []int64{2, 3}},
+		{name: "negative", amount: -100, ratios: []int64{1, 1, 1}, want: []int64{-34, -33, -33}},
+		{name: "zero ratio", amount: 101, ratios: []int64{0, 1, 1}, want: []int64{0, 51, 50}},
+		{name: "max", amount: math.MaxInt64, ratios: []int64{1, 1}, want: []int64{math.MaxInt64/2 + 1, math.MaxInt64 / 2}},
+		{name: "no ratios", amount: 100, wantErr: true},
+		{name: "zero ratios", amount: 100, ratios: []int64{0, 0}, wantErr: true},
+		{name: "negative ratio", amount: 100, ratios: []int64{2, -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		parts, err := New(tt.amount, USD).Allocate(tt.ratios...)
+		if tt.wantErr {
+			require.Error(t, err, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+
+		got := make([]int64, len(parts))
+		for i, p := range parts {
+			require.Equal(t, USD, p.Currency(), tt.name)
+			got[i] = p.Amount()
+		}
+		require.Equal(t, tt.want, got, tt.name)
+	}
+
+	parts, err := New(1000, JPY).Split(3)
+	require.NoError(t, err)
+	require.Equal(t, []Money{New(334, JPY), New(333, JPY), New(333, JPY)}, parts)
+	_, err = New(1000, JPY).Split(0)
+	require.Error(t, err)
+}
+
+func TestMoney_JSON(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal(New(1234, BHD))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"amount":"1.234","currency":"BHD"}`, string(b))
+
+	m := Money{}
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":"9.99","currency":"USD"}`), &m))
+	require.Equal(t, New(999, USD), m)
+
+	require.Error(t, json.Unmarshal([]byte(`{"amount":9.99,"currency":"USD"}`), &m), "number amount")
+	require.Error(t, json.Unmarshal([]byte(`{"amount":"9.999","currency":"USD"}`), &m))
+	require.Error(t, json.Unmarshal([]byte(`{"amount":"9.99","currency":"usd"}`), &m))
+}
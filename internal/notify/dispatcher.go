@@ -0,0 +1,486 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// DeliveryStatus webhook delivery status
+type DeliveryStatus string
+
+// delivery statuses
+const (
+	// DeliveryPending delivery waits for attempt
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliverySucceeded merchant accepted delivery with 2xx response
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryDead every attempt failed, delivery may be redelivered manually only
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// Valid check that status is known
+func (s DeliveryStatus) Valid() bool {
+	return s == DeliveryPending || s == DeliverySucceeded || s == DeliveryDead
+}
+
+// ErrNotFound returned when delivery doesn't exist
+var ErrNotFound = errors.New("delivery not found")
+
+// Config deliveries config
+type Config struct {
+	// Retry failed deliveries retry policy. Delivery is dead after Retry.MaxAttempts attempts
+	Retry utils.RetryPolicy
+	// Timeout merchant response timeout
+	Timeout time.Duration
+	// Workers max number of concurrent deliveries
+	Workers int
+	// MaxDeliveries max number of deliveries kept in log, the oldest completed ones are dropped
+	MaxDeliveries int
+}
+
+// DefaultConfig default deliveries config
+func DefaultConfig() Config {
+	return Config{
+		Retry: utils.RetryPolicy{
+			MaxAttempts: 8,
+			BaseBackoff: utils.Duration(5 * time.Second),
+			MaxBackoff:  utils.Duration(time.Hour),
+			Jitter:      0.2,
+		},
+		Timeout:       10 * time.Second,
+		Workers:       4,
+		MaxDeliveries: 10000,
+	}
+}
+
+// Validate check config values
+func (c *Config) Validate() error {
+	switch {
+	case c.Retry.MaxAttempts < 1:
+		return errors.New("webhooks max attempts should be positive")
+	case c.Retry.BaseBackoff < 0 || c.Retry.MaxBackoff < 0:
+		return errors.New("webhooks backoff should not be negative")
+	case c.Timeout <= 0:
+		return errors.New("webhooks timeout should be positive")
+	case c.Workers < 1 || c.MaxDeliveries < 1:
+		return errors.New("webhooks workers and max deliveries should be positive")
+	}
+	return nil
+}
+
+// Event payment session event delivered to merchants
+type Event struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      *session.Session `json:"data"`
+}
+
+// Attempt delivery attempt result
+type Attempt struct {
+	At time.Time `json:"at"`
+	// StatusCode merchant response status code. Missing if request failed
+	StatusCode int     `json:"status_code,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Delivery event delivery to subscription
+type Delivery struct {
+	ID             string         `json:"id"`
+	Tenant         string         `json:"tenant"`
+	SubscriptionID string         `json:"subscription_id"`
+	URL            string         `json:"url"`
+	EventID        string         `json:"event_id"`
+	EventType      string         `json:"event_type"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       []Attempt      `json:"attempts"`
+	// NextAttemptAt time of the next attempt of pending delivery
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	// RedeliveryOf id of delivery manually redelivered by this one
+	RedeliveryOf string    `json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	payload []byte
+	secret  string
+}
+
+// clone return copy of delivery
+func (d *Delivery) clone() *Delivery {
+	c := *d
+	c.Attempts = append(make([]Attempt, 0, len(d.Attempts)), d.Attempts...)
+	if d.NextAttemptAt != nil {
+		next := *d.NextAttemptAt
+		c.NextAttemptAt = &next
+	}
+	return &c
+}
+
+// Dispatcher delivers payment sessions events to merchants subscriptions and keeps deliveries log.
+// Failed deliveries are retried with exponential backoff until they are dead
+type Dispatcher struct {
+	l             *logrus.Logger
+	m             *metrics.Metrics
+	client        *utils.Client
+	cfg           Config
+	subscriptions func(tenant string) []*Subscription
+	now           func() time.Time
+
+	work chan string
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	mu         sync.Mutex
+	closed     bool
+	deliveries map[string]*Delivery
+	// order deliveries ids from the oldest
+	order  []string
+	timers map[string]*time.Timer
+	// inflight ids of deliveries being attempted
+	inflight map[string]bool
+	// drained ids of deliveries attempted after dispatcher is closed
+	drained map[string]bool
+}
+
+// NewDispatcher construct dispatcher of events to tenants subscriptions and start its workers
+func NewDispatcher(l *logrus.Logger, m *metrics.Metrics, cfg Config, subscriptions func(tenant string) []*Subscription) *Dispatcher {
+	d := &Dispatcher{
+		l:             l,
+		m:             m,
+		client:        utils.NewClient(cfg.Timeout),
+		cfg:           cfg,
+		subscriptions: subscriptions,
+		now:           time.Now,
+		work:          make(chan string),
+		quit:          make(chan struct{}),
+		deliveries:    make(map[string]*Delivery),
+		timers:        make(map[string]*time.Timer),
+		inflight:      make(map[string]bool),
+	}
+
+	for i := 0; i < cfg.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	return d
+}
+
+// Notify deliver event of session status change to session tenant subscriptions. It doesn't block
+func (d *Dispatcher) Notify(ctx context.Context, s *session.Session) {
+	subs := d.subscriptions(s.Tenant)
+	if len(subs) == 0 {
+		return
+	}
+
+	l := utils.Logger(ctx).WithField("session_id", s.ID)
+	id, err := newID("evt_")
+	if err != nil {
+		l.WithError(err).Error("failed to create webhook event")
+		return
+	}
+	ev := &Event{ID: id, Type: EventType(s.Status), CreatedAt: d.now().UTC(), Data: s}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		l.WithError(err).Error("failed to create webhook event")
+		return
+	}
+
+	for _, sub := range subs {
+		if !sub.Wants(ev.Type) {
+			continue
+		}
+
+		dl, err := d.add(&Delivery{
+			Tenant:         s.Tenant,
+			SubscriptionID: sub.ID,
+			URL:            sub.URL,
+			EventID:        ev.ID,
+			EventType:      ev.Type,
+			payload:        payload,
+			secret:         sub.Secret,
+		})
+		if err != nil {
+			l.WithError(err).Error("failed to create webhook delivery")
+			continue
+		}
+		l.WithFields(logrus.Fields{"delivery_id": dl.ID, "subscription_id": sub.ID}).Debug("webhook delivery created")
+	}
+}
+
+// Deliveries return tenant deliveries from the newest, filtered by status if it's set
+func (d *Dispatcher) Deliveries(tenant string, status DeliveryStatus, limit int) []*Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	res := make([]*Delivery, 0)
+	for i := len(d.order) - 1; i >= 0 && len(res) < limit; i-- {
+		dl := d.deliveries[d.order[i]]
+		if dl.Tenant == tenant && (status == "" || dl.Status == status) {
+			res = append(res, dl.clone())
+		}
+	}
+	return res
+}
+
+// Delivery return tenant delivery by id
+func (d *Dispatcher) Delivery(tenant, id string) (*Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dl, ok := d.deliveries[id]
+	if !ok || dl.Tenant != tenant {
+		return nil, errors.Wrapf(ErrNotFound, "delivery %s", id)
+	}
+	return dl.clone(), nil
+}
+
+// Redeliver deliver event of tenant delivery again by new delivery. Subscription is looked up again
+// so redelivery uses its current url and secret
+func (d *Dispatcher) Redeliver(tenant, id string) (*Delivery, error) {
+	orig, err := d.Delivery(tenant, id)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, sub := range d.subscriptions(tenant) {
+		if sub.ID != orig.SubscriptionID {
+			continue
+		}
+		return d.add(&Delivery{
+			Tenant:         tenant,
+			SubscriptionID: sub.ID,
+			URL:            sub.URL,
+			EventID:        orig.EventID,
+			EventType:      orig.EventType,
+			RedeliveryOf:   orig.ID,
+			payload:        orig.payload,
+			secret:         sub.Secret,
+		})
+	}
+	return nil, errors.Wrapf(ErrNotFound, "subscription %s of delivery %s", orig.SubscriptionID, id)
+}
+
+// Close stop accepting deliveries and make the last attempt of pending ones, including waiting for retry,
+// until ctx is done. Deliveries failed on the last attempt or not attempted are dropped and logged
+func (d *Dispatcher) Close(ctx context.Context) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	d.drained = make(map[string]bool)
+	for _, t := range d.timers {
+		t.Stop()
+	}
+	var pending []string
+	for _, id := range d.order {
+		if d.deliveries[id].Status == DeliveryPending {
+			pending = append(pending, id)
+		}
+	}
+	d.mu.Unlock()
+
+drain:
+	for _, id := range pending {
+		select {
+		case d.work <- id:
+		case <-ctx.Done():
+			break drain
+		}
+	}
+
+	close(d.quit)
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, id := range pending {
+		if dl := d.deliveries[id]; dl.Status == DeliveryPending && !d.drained[id] {
+			d.drop(dl, "not attempted")
+		}
+	}
+}
+
+// drop count and log pending delivery left on close. Should be called with lock held
+func (d *Dispatcher) drop(dl *Delivery, reason string) {
+	d.m.WebhookDeliveries.Inc(dl.Tenant, "dropped")
+	d.l.WithFields(logrus.Fields{
+		"delivery_id":     dl.ID,
+		"tenant":          dl.Tenant,
+		"subscription_id": dl.SubscriptionID,
+		"event_id":        dl.EventID,
+	}).WithField("error", reason).Error("webhook delivery dropped on shutdown")
+}
+
+// add store pending delivery, drop the oldest completed deliveries exceeding log size and schedule delivery attempt
+func (d *Dispatcher) add(dl *Delivery) (*Delivery, error) {
+	id, err := newID("dlv_")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, errors.New("dispatcher is closed")
+	}
+
+	now := d.now().UTC()
+	dl.ID = id
+	dl.Status = DeliveryPending
+	dl.Attempts = []Attempt{}
+	dl.NextAttemptAt = &now
+	dl.CreatedAt = now
+	d.deliveries[id] = dl
+	d.order = append(d.order, id)
+
+	if len(d.order) > d.cfg.MaxDeliveries {
+		kept := d.order[:0]
+		excess := len(d.order) - d.cfg.MaxDeliveries
+		for _, id := range d.order {
+			if excess > 0 && d.deliveries[id].Status != DeliveryPending {
+				delete(d.deliveries, id)
+				excess--
+				continue
+			}
+			kept = append(kept, id)
+		}
+		d.order = kept
+	}
+
+	d.schedule(id, 0)
+	return dl.clone(), nil
+}
+
+// schedule queue delivery attempt after wait. Should be called with lock held
+func (d *Dispatcher) schedule(id string, wait time.Duration) {
+	d.timers[id] = time.AfterFunc(wait, func() {
+		select {
+		case d.work <- id:
+		case <-d.quit:
+		}
+	})
+}
+
+// worker make queued delivery attempts until dispatcher is closed
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+	for {
+		select {
+		case id := <-d.work:
+			d.attempt(id)
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// attempt post delivery payload to subscription url and remember result.
+// Failed delivery is scheduled for retry or is dead if attempts are exhausted.
+// Delivery failed after dispatcher is closed is dropped
+func (d *Dispatcher) attempt(id string) {
+	d.mu.Lock()
+	dl, ok := d.deliveries[id]
+	if !ok || dl.Status != DeliveryPending || d.inflight[id] || d.drained[id] {
+		d.mu.Unlock()
+		return
+	}
+	if d.closed {
+		d.drained[id] = true
+	}
+	d.inflight[id] = true
+	delete(d.timers, id)
+	payload, secret, target := dl.payload, dl.secret, dl.URL
+	d.mu.Unlock()
+
+	start := d.now()
+	sc, err := d.post(id, dl.EventID, target, secret, payload)
+	a := Attempt{At: start.UTC(), StatusCode: sc, DurationMS: float64(d.now().Sub(start).Microseconds()) / 1000}
+	if err != nil {
+		a.StatusCode = 0
+		a.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.inflight, id)
+	if d.closed {
+		d.drained[id] = true
+	}
+	dl.Attempts = append(dl.Attempts, a)
+	l := d.l.WithFields(logrus.Fields{
+		"delivery_id":     id,
+		"tenant":          dl.Tenant,
+		"subscription_id": dl.SubscriptionID,
+		"attempt":         len(dl.Attempts),
+		"status_code":     a.StatusCode,
+	})
+	switch {
+	case err == nil && sc >= 200 && sc < 300:
+		dl.Status = DeliverySucceeded
+		dl.NextAttemptAt = nil
+		d.m.WebhookDeliveries.Inc(dl.Tenant, "succeeded")
+		l.Info("webhook delivered")
+	case len(dl.Attempts) >= d.cfg.Retry.MaxAttempts:
+		dl.Status = DeliveryDead
+		dl.NextAttemptAt = nil
+		d.m.WebhookDeliveries.Inc(dl.Tenant, "dead")
+		l.WithField("error", a.Error).Error("webhook delivery is dead")
+	default:
+		wait := d.cfg.Retry.Backoff(len(dl.Attempts))
+		next := d.now().Add(wait).UTC()
+		dl.NextAttemptAt = &next
+		if d.closed {
+			d.drop(dl, a.Error)
+			return
+		}
+		d.m.WebhookDeliveries.Inc(dl.Tenant, "retry")
+		l.WithField("error", a.Error).Warn("webhook delivery failed, retrying")
+		d.schedule(id, wait)
+	}
+}
+
+// post send signed payload to subscription url
+func (d *Dispatcher) post(id, eventID, target, secret string, payload []byte) (int, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	ts := d.now().Unix()
+	headers := map[string][]string{
+		SignatureHeader:  {"t=" + strconv.FormatInt(ts, 10) + ",v1=" + Signature(secret, ts, payload)},
+		eventIDHeader:    {eventID},
+		deliveryIDHeader: {id},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+	sc, err := d.client.PostWithHeaders(ctx, u, payload, nil, nil, headers)
+	return sc, errors.WithStack(err)
+}
+
+// newID generate random id with prefix
+func newID(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
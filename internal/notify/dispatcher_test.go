@@ -0,0 +1,238 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// receiver test merchant endpoint verifying deliveries signatures.
+// It responds with failures statuses first and with 200 after
+type receiver struct {
+	*httptest.Server
+
+	calls    int32
+	failures []int
+	events   chan *Event
+}
+
+func newReceiver(failures ...int) *receiver {
+	rc := &receiver{failures: failures, events: make(chan *Event, 10)}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		parts := strings.Split(r.Header.Get(SignatureHeader), ",")
+		ts, _ := strconv.ParseInt(strings.TrimPrefix(parts[0], "t="), 10, 64)
+		if len(parts) != 2 || parts[1] != "v1="+Signature(testSecret, ts, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if n := int(atomic.AddInt32(&rc.calls, 1)); n <= len(rc.failures) {
+			w.WriteHeader(rc.failures[n-1])
+			return
+		}
+		ev := &Event{}
+		_ = json.Unmarshal(body, ev)
+		rc.events <- ev
+	}))
+	return rc
+}
+
+func newTestDispatcher(subs ...*Subscription) *Dispatcher {
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	cfg := DefaultConfig()
+	cfg.Retry = utils.RetryPolicy{MaxAttempts: 3, BaseBackoff: utils.Duration(time.Millisecond), MaxBackoff: utils.Duration(5 * time.Millisecond)}
+	cfg.Timeout = time.Second
+	return NewDispatcher(l, metrics.New(), cfg, func(tenant string) []*Subscription {
+		if tenant != "shop" {
+			return nil
+		}
+		return subs
+	})
+}
+
+// waitStatus wait until delivery has status
+func waitStatus(t *testing.T, d *Dispatcher, id string, status DeliveryStatus) *Delivery {
+	var dl *Delivery
+	require.Eventually(t, func() bool {
+		var err error
+		dl, err = d.Delivery("shop", id)
+		require.NoError(t, err)
+		return dl.Status == status
+	}, time.Second, time.Millisecond)
+	return dl
+}
+
+func TestDispatcher_Notify(t *testing.T) {
+	t.Parallel()
+
+	rc := newReceiver(http.StatusInternalServerError)
+	defer rc.Close()
+	captured := newReceiver()
+	defer captured.Close()
+
+	d := newTestDispatcher(
+		&Subscription{ID: "all", URL: rc.URL, Secret: testSecret},
+		&Subscription{ID: "captured", URL: captured.URL, Secret: testSecret, Events: []string{"payment.captured"}},
+	)
+	defer d.Close(context.Background())
+
+	ps := &session.Session{ID: "pay_1", Tenant: "shop", Status: session.StatusPending}
+	d.Notify(context.Background(), ps)
+	d.Notify(context.Background(), &session.Session{ID: "pay_2", Tenant: "games", Status: session.StatusPending})
+
+	deliveries := d.Deliveries("shop", "", 10)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, "all", deliveries[0].SubscriptionID)
+
+	dl := waitStatus(t, d, deliveries[0].ID, DeliverySucceeded)
+	require.Len(t, dl.Attempts, 2)
+	require.Equal(t, http.StatusInternalServerError, dl.Attempts[0].StatusCode)
+	require.Equal(t, http.StatusOK, dl.Attempts[1].StatusCode)
+	require.Nil(t, dl.NextAttemptAt)
+
+	ev := <-rc.events
+	require.Equal(t, dl.EventID, ev.ID)
+	require.Equal(t, "payment.pending", ev.Type)
+	require.Equal(t, ps, ev.Data)
+	require.Empty(t, d.Deliveries("games", "", 10))
+	require.Empty(t, captured.events)
+}
+
+func TestDispatcher_Redeliver(t *testing.T) {
+	t.Parallel()
+
+	rc := newReceiver(http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	defer rc.Close()
+
+	d := newTestDispatcher(&Subscription{ID: "all", URL: rc.URL, Secret: testSecret})
+	defer d.Close(context.Background())
+
+	d.Notify(context.Background(), &session.Session{ID: "pay_1", Tenant: "shop", Status: session.StatusCaptured})
+	dead := waitStatus(t, d, d.Deliveries("shop", "", 10)[0].ID, DeliveryDead)
+	require.Len(t, dead.Attempts, 3)
+	require.Equal(t, []*Delivery{dead}, d.Deliveries("shop", DeliveryDead, 10))
+
+	_, err := d.Redeliver("games", dead.ID)
+	require.Equal(t, ErrNotFound, errors.Cause(err))
+
+	re, err := d.Redeliver("shop", dead.ID)
+	require.NoError(t, err)
+	require.Equal(t, dead.ID, re.RedeliveryOf)
+	require.Equal(t, dead.EventID, re.EventID)
+
+	re = waitStatus(t, d, re.ID, DeliverySucceeded)
+	require.Len(t, re.Attempts, 1)
+	require.Equal(t, dead.EventID, (<-rc.events).ID)
+}
+
+func TestDispatcher_Close(t *testing.T) {
+	t.Parallel()
+
+	rc := newReceiver(http.StatusServiceUnavailable)
+	defer rc.Close()
+	failing := newReceiver(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	defer failing.Close()
+
+	d := newTestDispatcher(
+		&Subscription{ID: "all", URL: rc.URL, Secret: testSecret},
+		&Subscription{ID: "failing", URL: failing.URL, Secret: testSecret},
+	)
+	d.cfg.Retry.BaseBackoff = utils.Duration(time.Hour)
+	d.cfg.Retry.MaxBackoff = utils.Duration(time.Hour)
+
+	d.Notify(context.Background(), &session.Session{ID: "pay_1", Tenant: "shop", Status: session.StatusCaptured})
+	deliveries := d.Deliveries("shop", "", 10)
+	require.Len(t, deliveries, 2)
+	for _, dl := range deliveries {
+		id := dl.ID
+		require.Eventually(t, func() bool {
+			dl, err := d.Delivery("shop", id)
+			require.NoError(t, err)
+			return len(dl.Attempts) == 1
+		}, time.Second, time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	d.Close(ctx)
+
+	// delivery waiting for retry is attempted on close
+	dl, err := d.Delivery("shop", deliveries[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, DeliverySucceeded, dl.Status)
+	require.Len(t, dl.Attempts, 2)
+	require.Equal(t, dl.EventID, (<-rc.events).ID)
+
+	// delivery failed on close is dropped
+	dl, err = d.Delivery("shop", deliveries[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, DeliveryPending, dl.Status)
+	require.Len(t, dl.Attempts, 2)
+	require.Equal(t, int32(2), atomic.LoadInt32(&failing.calls))
+
+	d.Notify(context.Background(), &session.Session{ID: "pay_2", Tenant: "shop", Status: session.StatusCaptured})
+	require.Len(t, d.Deliveries("shop", "", 10), 2)
+}
+
+func TestDispatcher_MaxDeliveries(t *testing.T) {
+	t.Parallel()
+
+	rc := newReceiver()
+	defer rc.Close()
+
+	d := newTestDispatcher(&Subscription{ID: "all", URL: rc.URL, Secret: testSecret})
+	d.cfg.MaxDeliveries = 2
+	defer d.Close(context.Background())
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		d.Notify(context.Background(), &session.Session{ID: "pay_1", Tenant: "shop", Status: session.StatusPending})
+		id := d.Deliveries("shop", "", 1)[0].ID
+		waitStatus(t, d, id, DeliverySucceeded)
+		ids = append(ids, id)
+	}
+
+	got := d.Deliveries("shop", "", 10)
+	require.Len(t, got, 2)
+	require.Equal(t, ids[2], got[0].ID)
+	require.Equal(t, ids[1], got[1].ID)
+	_, err := d.Delivery("shop", ids[0])
+	require.Equal(t, ErrNotFound, errors.Cause(err))
+}
+
+func TestSubscription_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		sub     Subscription
+		wantErr bool
+	}{
+		{name: "valid", sub: Subscription{ID: "orders", URL: "https://shop.example.com/hooks", Secret: testSecret, Events: []string{"payment.captured"}}},
+		{name: "relative url", sub: Subscription{ID: "orders", URL: "/hooks", Secret: testSecret}, wantErr: true},
+		{name: "short secret", sub: Subscription{ID: "orders", URL: "https://shop.example.com/hooks", Secret: "secret"}, wantErr: true},
+		{name: "unknown event", sub: Subscription{ID: "orders", URL: "https://shop.example.com/hooks", Secret: testSecret, Events: []string{"payment.created"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.wantErr, tt.sub.Validate() != nil, tt.name)
+	}
+}
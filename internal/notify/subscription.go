@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+)
+
+// SignatureHeader deliveries signature header of "t=<unix time>,v1=<hex signature>" format, see Signature
+const SignatureHeader = "X-Payments-Signature"
+
+// deliveries headers
+const (
+	eventIDHeader    = "X-Payments-Event-ID"
+	deliveryIDHeader = "X-Payments-Delivery-ID"
+)
+
+// minSecretLen min length of subscription secret
+const minSecretLen = 32
+
+// subscriptionIDRe subscription id format
+var subscriptionIDRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// eventTypes event types merchants may subscribe to
+var eventTypes = map[string]bool{
+	EventType(session.StatusPending):           true,
+	EventType(session.StatusAuthorized):        true,
+	EventType(session.StatusCaptured):          true,
+	EventType(session.StatusFailed):            true,
+	EventType(session.StatusExpired):           true,
+	EventType(session.StatusPartiallyRefunded): true,
+	EventType(session.StatusRefunded):          true,
+}
+
+// Subscription merchant endpoint receiving payment sessions events
+type Subscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret key deliveries are signed with
+	Secret string `json:"secret"`
+	// Events event types to deliver, e.g. payment.captured. Every event is delivered if empty
+	Events []string `json:"events"`
+}
+
+// EventType return type of event of session moved to status
+func EventType(s session.Status) string {
+	return "payment." + string(s)
+}
+
+// Validate check subscription values
+func (s *Subscription) Validate() error {
+	if !subscriptionIDRe.MatchString(s.ID) {
+		return errors.Errorf("subscription id %q should be lowercase letters, digits, - and _", s.ID)
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return errors.Wrapf(err, "invalid subscription %s url", s.ID)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.Errorf("subscription %s url should be absolute http or https url", s.ID)
+	}
+
+	if len(s.Secret) < minSecretLen {
+		return errors.Errorf("subscription %s secret should be at least %d characters", s.ID, minSecretLen)
+	}
+
+	for _, t := range s.Events {
+		if !eventTypes[t] {
+			return errors.Errorf("subscription %s unknown event type %q", s.ID, t)
+		}
+	}
+	return nil
+}
+
+// Wants check that subscription receives events of type
+func (s *Subscription) Wants(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, t := range s.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Signature return hex encoded HMAC-SHA256 of unix time ts and body joined with "." signed with secret.
+// Merchants should compare it with v1 value of SignatureHeader and check that t is close to their time
+func Signature(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
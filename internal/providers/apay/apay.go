@@ -2,8 +2,11 @@ package apay
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -11,6 +14,12 @@ import (
 	"github.com/fedoseev-vitaliy/payments/internal/utils"
 )
 
+// Name Apple Pay provider name
+const Name = "apay"
+
+// Platforms platforms Apple Pay is available on
+var Platforms = []providers.Platform{providers.PlatformIOS, providers.PlatformWeb}
+
 type ApplePay struct {
 	url    *url.URL
 	client *utils.Client
@@ -24,6 +33,21 @@ type applePayError struct {
 	Error string `json:"a_err"`
 }
 
+// applePayRefund Apple Pay refund request. Refund id is sent in Idempotency-Key header
+type applePayRefund struct {
+	OrderRef string `json:"order_ref"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type applePayRefundResponse struct {
+	RefundID string `json:"a_refund_id"`
+}
+
+// refundKeyHeader header of refund id Apple Pay deduplicates refunds by
+const refundKeyHeader = "Idempotency-Key"
+
 func New(cli *utils.Client, u *url.URL) *ApplePay {
 	return &ApplePay{
 		client: cli,
@@ -31,13 +55,19 @@ func New(cli *utils.Client, u *url.URL) *ApplePay {
 	}
 }
 
-func (g *ApplePay) GetPayURL(ctx context.Context, productID string) (string, error) {
+func (g *ApplePay) GetPayURL(ctx context.Context, req *providers.PaymentRequest) (string, error) {
 	res := &applePayResponse{}
 	eres := &applePayError{}
 
 	u := *g.url
 	q := u.Query()
-	q.Set("productID", productID)
+	q.Set("productID", req.ProductID)
+	q.Set("amount", strconv.FormatInt(req.Price.Amount(), 10))
+	q.Set("currency", string(req.Price.Currency()))
+	q.Set("description", req.Description)
+	if req.Reference != "" {
+		q.Set("reference", req.Reference)
+	}
 	u.RawQuery = q.Encode()
 
 	sc, err := g.client.Get(ctx, &u, res, eres)
@@ -46,8 +76,37 @@ func (g *ApplePay) GetPayURL(ctx context.Context, productID string) (string, err
 	}
 
 	if sc != http.StatusOK {
-		return "", errors.Wrapf(providers.ErrNotOK, "applePay status code:%d", sc)
+		return "", providers.StatusError("applePay", sc)
 	}
 
 	return res.PayButtonURL, nil
 }
+
+// Refund refund captured payment. Payment is refunded once for the same refund id, so request is safe to retry
+func (g *ApplePay) Refund(ctx context.Context, req *providers.RefundRequest) (string, error) {
+	body, err := json.Marshal(&applePayRefund{
+		OrderRef: req.Reference,
+		Amount:   req.Amount.Amount(),
+		Currency: string(req.Amount.Currency()),
+		Reason:   req.Reason,
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	res := &applePayRefundResponse{}
+	eres := &applePayError{}
+	u := *g.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/refunds"
+
+	sc, err := g.client.PostWithHeaders(ctx, &u, body, res, eres, map[string][]string{refundKeyHeader: {req.ID}})
+	if err != nil {
+		return "", errors.Wrapf(providers.ErrInternalProvider, "applePay err: %s", err.Error())
+	}
+
+	if sc != http.StatusOK {
+		return "", providers.StatusError("applePay", sc)
+	}
+
+	return res.RefundID, nil
+}
@@ -1,16 +1,33 @@
 package apay
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
 )
 
 // MockAPay is mock for like e2e test
-type MockAPay struct{}
+type MockAPay struct {
+	// WebhookSecret secret to sign webhooks with
+	WebhookSecret string
+}
 
 func (ma *MockAPay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	pid := r.URL.Query().Get("productID")
+	if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/refunds") {
+		ma.refund(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	pid := q.Get("productID")
 	if pid == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(&applePayError{
@@ -20,11 +37,10 @@ func (ma *MockAPay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-
-	if pid == "badGoogle" {
-		w.WriteHeader(http.StatusInternalServerError)
+	if q.Get("amount") == "" || q.Get("currency") == "" {
+		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(&applePayError{
-			Error: "bad google product",
+			Error: "amount and currency query params are required",
 		}); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -37,3 +53,53 @@ func (ma *MockAPay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+// refund refund payment. Refund id is derived from idempotency key, so the same refund is returned on retries
+func (ma *MockAPay) refund(w http.ResponseWriter, r *http.Request) {
+	req := &applePayRefund{}
+	key := r.Header.Get(refundKeyHeader)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || key == "" || req.OrderRef == "" || req.Amount <= 0 || req.Currency == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(&applePayError{
+			Error: "idempotency key, order_ref, amount and currency are required",
+		}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&applePayRefundResponse{RefundID: "are_" + key}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// NewWebhook construct webhook callback request to url reporting event the way Apple Pay does.
+// Request is signed at event timestamp
+func (ma *MockAPay) NewWebhook(url string, ev *providers.Event) (*http.Request, error) {
+	typ := ""
+	for name, t := range applePayEventTypes {
+		if t == ev.Type {
+			typ = name
+		}
+	}
+
+	body, err := json.Marshal(&applePayEvent{
+		EventID:  ev.ID,
+		Type:     typ,
+		OrderRef: ev.SessionID,
+		Reason:   ev.Reason,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ts := strconv.FormatInt(ev.Timestamp.Unix(), 10)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(SignatureHeader, "t="+ts+",v1="+hex.EncodeToString(webhookSignature(ma.WebhookSecret, ts, body)))
+	return r, nil
+}
@@ -0,0 +1,110 @@
+package apay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+// SignatureHeader Apple Pay webhook signature header of "t=<unix time>,v1=<hex signature>" format
+const SignatureHeader = "X-APay-Signature"
+
+// applePayEventTypes Apple Pay webhook event types
+var applePayEventTypes = map[string]providers.EventType{
+	"payment.authorized": providers.EventAuthorized,
+	"payment.captured":   providers.EventCaptured,
+	"payment.failed":     providers.EventFailed,
+}
+
+type applePayEvent struct {
+	EventID  string `json:"event_id"`
+	Type     string `json:"type"`
+	OrderRef string `json:"order_ref"`
+	Reason   string `json:"failure_reason,omitempty"`
+}
+
+// WebhookVerifier Apple Pay webhooks verifier.
+// Signature is hex encoded HMAC-SHA256 of signature timestamp and body joined with "."
+type WebhookVerifier struct {
+	secret string
+}
+
+// NewWebhookVerifier construct verifier of webhooks signed with secret
+func NewWebhookVerifier(secret string) *WebhookVerifier {
+	return &WebhookVerifier{secret: secret}
+}
+
+// ParseWebhook verify webhook signature and return its event
+func (v *WebhookVerifier) ParseWebhook(r *http.Request, body []byte) (*providers.Event, error) {
+	ts, sig, err := parseSignatureHeader(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !hmac.Equal(sig, webhookSignature(v.secret, ts, body)) {
+		return nil, errors.WithStack(providers.ErrInvalidWebhookSignature)
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(providers.ErrInvalidWebhook, "applePay signature timestamp %q", ts)
+	}
+
+	ev := &applePayEvent{}
+	if err := json.Unmarshal(body, ev); err != nil {
+		return nil, errors.Wrapf(providers.ErrInvalidWebhook, "applePay event: %s", err.Error())
+	}
+	t, ok := applePayEventTypes[ev.Type]
+	if !ok || ev.EventID == "" || ev.OrderRef == "" {
+		return nil, errors.Wrapf(providers.ErrInvalidWebhook, "applePay event %q of type %q", ev.EventID, ev.Type)
+	}
+
+	return &providers.Event{
+		ID:        ev.EventID,
+		Provider:  Name,
+		Type:      t,
+		SessionID: ev.OrderRef,
+		Timestamp: time.Unix(sec, 0).UTC(),
+		Reason:    ev.Reason,
+	}, nil
+}
+
+// parseSignatureHeader return timestamp and signature of signature header
+func parseSignatureHeader(h string) (string, []byte, error) {
+	var (
+		ts  string
+		sig []byte
+	)
+	for _, part := range strings.Split(h, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sig, _ = hex.DecodeString(kv[1])
+		}
+	}
+	if ts == "" || len(sig) == 0 {
+		return "", nil, errors.Wrapf(providers.ErrInvalidWebhook, "applePay %s header is malformed", SignatureHeader)
+	}
+	return ts, sig, nil
+}
+
+// webhookSignature return signature of webhook body signed at ts
+func webhookSignature(secret, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(ts + "."))
+	_, _ = mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,63 @@
+package apay
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+func TestWebhookVerifier_ParseWebhook(t *testing.T) {
+	t.Parallel()
+
+	ev := &providers.Event{
+		ID:        "evt_1",
+		Provider:  Name,
+		Type:      providers.EventFailed,
+		SessionID: "pay_1",
+		Timestamp: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Reason:    "card declined",
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		body   func(b []byte) []byte
+		err    error
+	}{
+		{name: "signed", secret: "secret"},
+		{name: "wrong secret", secret: "guess", err: providers.ErrInvalidWebhookSignature},
+		{
+			name:   "tampered body",
+			secret: "secret",
+			body:   func(b []byte) []byte { return bytes.Replace(b, []byte("pay_1"), []byte("pay_2"), 1) },
+			err:    providers.ErrInvalidWebhookSignature,
+		},
+	}
+	for _, tt := range tests {
+		r, err := (&MockAPay{WebhookSecret: "secret"}).NewWebhook("http://localhost/api/v1/webhooks/apay", ev)
+		require.NoError(t, err, tt.name)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err, tt.name)
+		if tt.body != nil {
+			body = tt.body(body)
+		}
+
+		got, err := NewWebhookVerifier(tt.secret).ParseWebhook(r, body)
+		require.Equal(t, tt.err, errors.Cause(err), tt.name)
+		if tt.err == nil {
+			require.Equal(t, ev, got, tt.name)
+		}
+	}
+
+	r, err := (&MockAPay{WebhookSecret: "secret"}).NewWebhook("http://localhost/api/v1/webhooks/apay", ev)
+	require.NoError(t, err)
+	r.Header.Set(SignatureHeader, "v1=00")
+	_, err = NewWebhookVerifier("secret").ParseWebhook(r, nil)
+	require.True(t, errors.Is(err, providers.ErrInvalidWebhook))
+}
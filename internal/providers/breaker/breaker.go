@@ -0,0 +1,292 @@
+package breaker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// State circuit breaker state
+type State int
+
+const (
+	// StateClosed provider is called and calls results are tracked
+	StateClosed State = iota
+	// StateOpen provider isn't called, calls fail fast with providers.ErrCircuitOpen
+	StateOpen
+	// StateHalfOpen limited number of probe calls decide whether to close or open circuit again
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// Config circuit breaker configuration
+type Config struct {
+	// FailureRate failed calls rate in window to open circuit, from 0 to 1. Breaker is disabled if 0
+	FailureRate float64 `json:"failure_rate"`
+	// WindowSize number of last calls to calculate failure rate
+	WindowSize int `json:"window_size"`
+	// MinRequests min number of calls in window before failure rate is checked
+	MinRequests int `json:"min_requests"`
+	// OpenTimeout how long circuit stays open before probe calls
+	OpenTimeout utils.Duration `json:"open_timeout"`
+	// HalfOpenRequests number of successful probe calls to close circuit
+	HalfOpenRequests int `json:"half_open_requests"`
+}
+
+// Status circuit breaker status
+type Status struct {
+	State    string     `json:"state"`
+	Requests int        `json:"requests"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// Breaker circuit breaker decorator of payment provider
+type Breaker struct {
+	name string
+	p    providers.Provider
+	cfg  Config
+	l    *logrus.Logger
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	window   []bool
+	pos      int
+	requests int
+	failures int
+	openedAt time.Time
+	// probes number of in-flight half open calls, successes number of succeeded ones
+	probes    int
+	successes int
+}
+
+// New construct circuit breaker around provider
+func New(name string, p providers.Provider, cfg Config, l *logrus.Logger) *Breaker {
+	if cfg.WindowSize < 1 {
+		cfg.WindowSize = 1
+	}
+	if cfg.HalfOpenRequests < 1 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	return &Breaker{
+		name:   name,
+		p:      p,
+		cfg:    cfg,
+		l:      l,
+		now:    time.Now,
+		window: make([]bool, cfg.WindowSize),
+	}
+}
+
+// Name return provider name
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// GetPayURL call provider if circuit isn't open
+func (b *Breaker) GetPayURL(ctx context.Context, req *providers.PaymentRequest) (string, error) {
+	return b.call(ctx, func() (string, error) {
+		return b.p.GetPayURL(ctx, req)
+	})
+}
+
+// Refund refund payment by provider if circuit isn't open
+func (b *Breaker) Refund(ctx context.Context, req *providers.RefundRequest) (string, error) {
+	return b.call(ctx, func() (string, error) {
+		return providers.Refund(ctx, b.p, req)
+	})
+}
+
+// call make provider call if circuit isn't open and record its result
+func (b *Breaker) call(ctx context.Context, f func() (string, error)) (string, error) {
+	if b.cfg.FailureRate <= 0 {
+		return f()
+	}
+
+	probe, err := b.allow()
+	if err != nil {
+		return "", err
+	}
+
+	res, err := f()
+	// call canceled by client or unsupported by provider says nothing about provider health
+	if err != nil && (ctx.Err() == context.Canceled || errors.Is(err, providers.ErrRefundNotSupported)) {
+		b.cancel(probe)
+		return "", err
+	}
+
+	// request rejected by provider, e.g. unknown product, is answered by healthy provider
+	b.done(probe, err == nil || errors.Is(err, providers.ErrNotOK))
+	return res, err
+}
+
+// State return current circuit state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState()
+}
+
+// Status return circuit breaker status
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := Status{
+		State:    b.currentState().String(),
+		Requests: b.requests,
+		Failures: b.failures,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+	return s
+}
+
+// currentState return state taking open timeout into account
+func (b *Breaker) currentState() State {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= time.Duration(b.cfg.OpenTimeout) {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// allow check if call is allowed and return whether it's a half open probe
+func (b *Breaker) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case StateClosed:
+		return false, nil
+	case StateHalfOpen:
+		if b.state == StateOpen {
+			b.setState(StateHalfOpen)
+		}
+		if b.probes+b.successes < b.cfg.HalfOpenRequests {
+			b.probes++
+			return true, nil
+		}
+	}
+
+	return false, errors.Wrapf(providers.ErrCircuitOpen, "%s", b.name)
+}
+
+// cancel release probe slot without recording call result
+func (b *Breaker) cancel(probe bool) {
+	if !probe {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.probes--
+	}
+}
+
+// done record call result
+func (b *Breaker) done(probe, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		// circuit state changed while probe was in-flight
+		if b.state != StateHalfOpen {
+			return
+		}
+
+		b.probes--
+		if !ok {
+			b.open()
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.setState(StateClosed)
+			b.reset()
+		}
+		return
+	}
+
+	if b.state != StateClosed {
+		return
+	}
+
+	if b.requests == len(b.window) {
+		if b.window[b.pos] {
+			b.failures--
+		}
+	} else {
+		b.requests++
+	}
+
+	b.window[b.pos] = !ok
+	if !ok {
+		b.failures++
+	}
+	b.pos = (b.pos + 1) % len(b.window)
+
+	if b.requests >= b.cfg.MinRequests && float64(b.failures)/float64(b.requests) >= b.cfg.FailureRate {
+		b.open()
+	}
+}
+
+// open move circuit to open state
+func (b *Breaker) open() {
+	b.setState(StateOpen)
+	b.openedAt = b.now()
+	b.reset()
+}
+
+// reset clear calls window and probes
+func (b *Breaker) reset() {
+	for i := range b.window {
+		b.window[i] = false
+	}
+	b.pos = 0
+	b.requests = 0
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+}
+
+// setState change state and log transition
+func (b *Breaker) setState(s State) {
+	if b.state == s {
+		return
+	}
+
+	b.l.WithFields(logrus.Fields{
+		"provider": b.name,
+		"from":     b.state.String(),
+		"to":       s.String(),
+		"failures": b.failures,
+		"requests": b.requests,
+	}).Warn("circuit breaker state changed")
+	b.state = s
+}
@@ -0,0 +1,195 @@
+package breaker
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+var req = &providers.PaymentRequest{ProductID: "testProduct"}
+
+func newTestBreaker(p providers.Provider, cfg Config) (*Breaker, *time.Time) {
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	b := New("apay", p, cfg, l)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestBreaker_GetPayURL(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{
+		FailureRate:      0.5,
+		WindowSize:       4,
+		MinRequests:      4,
+		OpenTimeout:      utils.Duration(time.Minute),
+		HalfOpenRequests: 2,
+	}
+	pErr := errors.Wrap(providers.ErrInternalProvider, "boom")
+
+	pMock := &mocks.Provider{}
+	b, now := newTestBreaker(pMock, cfg)
+
+	// 2 of 4 calls failed
+	pMock.On("GetPayURL", mock.Anything, req).Return("url", nil).Twice()
+	pMock.On("GetPayURL", mock.Anything, req).Return("", pErr).Twice()
+	for i := 0; i < 4; i++ {
+		_, _ = b.GetPayURL(context.Background(), req)
+	}
+	require.Equal(t, StateOpen, b.State())
+	require.NotNil(t, b.Status().OpenedAt)
+
+	// fail fast while open
+	_, err := b.GetPayURL(context.Background(), req)
+	require.Equal(t, providers.ErrCircuitOpen, errors.Cause(err))
+
+	// probe failed, circuit opened again
+	*now = now.Add(time.Minute)
+	require.Equal(t, StateHalfOpen, b.State())
+	pMock.On("GetPayURL", mock.Anything, req).Return("", pErr).Once()
+	_, err = b.GetPayURL(context.Background(), req)
+	require.Equal(t, providers.ErrInternalProvider, errors.Cause(err))
+	require.Equal(t, StateOpen, b.State())
+
+	// probes succeeded, circuit closed
+	*now = now.Add(time.Minute)
+	pMock.On("GetPayURL", mock.Anything, req).Return("url", nil).Twice()
+	for i := 0; i < 2; i++ {
+		u, err := b.GetPayURL(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, "url", u)
+	}
+	require.Equal(t, StateClosed, b.State())
+	require.Equal(t, Status{State: "closed"}, b.Status())
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestBreaker_MinRequests(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	b, _ := newTestBreaker(pMock, Config{FailureRate: 0.5, WindowSize: 10, MinRequests: 3})
+
+	pMock.On("GetPayURL", mock.Anything, req).Return("", errors.New("boom")).Twice()
+	for i := 0; i < 2; i++ {
+		_, _ = b.GetPayURL(context.Background(), req)
+	}
+	require.Equal(t, StateClosed, b.State())
+	require.Equal(t, Status{State: "closed", Requests: 2, Failures: 2}, b.Status())
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestBreaker_SlidingWindow(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	b, _ := newTestBreaker(pMock, Config{FailureRate: 0.5, WindowSize: 4, MinRequests: 4})
+
+	// old failures leave window
+	pMock.On("GetPayURL", mock.Anything, req).Return("", errors.New("boom")).Once()
+	pMock.On("GetPayURL", mock.Anything, req).Return("url", nil).Times(4)
+	pMock.On("GetPayURL", mock.Anything, req).Return("", errors.New("boom")).Once()
+	for i := 0; i < 6; i++ {
+		_, _ = b.GetPayURL(context.Background(), req)
+	}
+	require.Equal(t, StateClosed, b.State())
+	require.Equal(t, Status{State: "closed", Requests: 4, Failures: 1}, b.Status())
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestBreaker_Disabled(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	b, _ := newTestBreaker(pMock, Config{WindowSize: 1, MinRequests: 1})
+
+	pMock.On("GetPayURL", mock.Anything, req).Return("", errors.New("boom")).Times(3)
+	for i := 0; i < 3; i++ {
+		_, err := b.GetPayURL(context.Background(), req)
+		require.Error(t, err)
+	}
+	require.Equal(t, StateClosed, b.State())
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestBreaker_CanceledCallsIgnored(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	b, _ := newTestBreaker(pMock, Config{FailureRate: 0.5, WindowSize: 1, MinRequests: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pMock.On("GetPayURL", mock.Anything, req).Return("", context.Canceled).Once()
+	_, err := b.GetPayURL(ctx, req)
+	require.Error(t, err)
+	require.Equal(t, StateClosed, b.State())
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestBreaker_RejectionsIgnored(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	b, _ := newTestBreaker(pMock, Config{FailureRate: 0.5, WindowSize: 2, MinRequests: 2, OpenTimeout: utils.Duration(time.Minute)})
+
+	// provider answered unknown product, it's healthy
+	pMock.On("GetPayURL", mock.Anything, req).Return("", providers.StatusError("apay", http.StatusNotFound)).Twice()
+	for i := 0; i < 2; i++ {
+		_, err := b.GetPayURL(context.Background(), req)
+		require.Equal(t, providers.ErrNotOK, errors.Cause(err))
+	}
+	require.Equal(t, StateClosed, b.State())
+	require.Equal(t, 0, b.Status().Failures)
+
+	// server error fails half of window
+	pMock.On("GetPayURL", mock.Anything, req).Return("", providers.StatusError("apay", http.StatusBadGateway)).Once()
+	_, err := b.GetPayURL(context.Background(), req)
+	require.Equal(t, providers.ErrInternalProvider, errors.Cause(err))
+	require.Equal(t, StateOpen, b.State())
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestBreaker_Refund(t *testing.T) {
+	t.Parallel()
+
+	refund := &providers.RefundRequest{ID: "re_1", Reference: "pay_1", Amount: money.New(999, money.USD)}
+
+	// refund failures open circuit
+	pMock := &mocks.RefundProvider{}
+	b, _ := newTestBreaker(pMock, Config{FailureRate: 0.5, WindowSize: 1, MinRequests: 1, OpenTimeout: utils.Duration(time.Minute)})
+	pMock.On("Refund", mock.Anything, refund).Return("", providers.ErrInternalProvider).Once()
+	_, err := b.Refund(context.Background(), refund)
+	require.Equal(t, providers.ErrInternalProvider, errors.Cause(err))
+	require.Equal(t, StateOpen, b.State())
+	_, err = b.Refund(context.Background(), refund)
+	require.Equal(t, providers.ErrCircuitOpen, errors.Cause(err))
+	mock.AssertExpectationsForObjects(t, pMock)
+
+	// provider without refunds isn't unhealthy
+	b, _ = newTestBreaker(&mocks.Provider{}, Config{FailureRate: 0.5, WindowSize: 1, MinRequests: 1})
+	_, err = b.Refund(context.Background(), refund)
+	require.Equal(t, providers.ErrRefundNotSupported, errors.Cause(err))
+	require.Equal(t, StateClosed, b.State())
+}
@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// cache lookups results
+const (
+	ResultHit         = "hit"
+	ResultNegativeHit = "negative_hit"
+	ResultMiss        = "miss"
+	ResultShared      = "shared"
+)
+
+// Config pay urls cache configuration
+type Config struct {
+	// TTL how long pay url is cached. Cache is disabled if 0
+	TTL utils.Duration `json:"ttl"`
+	// NegativeTTL how long providers.ErrNotOK is cached. Errors aren't cached if 0
+	NegativeTTL utils.Duration `json:"negative_ttl"`
+	// MaxEntries max number of cached products, least recently used are evicted. Unlimited if 0
+	MaxEntries int `json:"max_entries"`
+}
+
+// entry cached provider result
+type entry struct {
+	key     string
+	url     string
+	err     error
+	expires time.Time
+}
+
+// call in-flight provider call shared by concurrent requests of the same payment
+type call struct {
+	done chan struct{}
+	url  string
+	err  error
+}
+
+// Cache payment provider decorator caching pay urls by product payment request
+type Cache struct {
+	name string
+	p    providers.Provider
+	cfg  Config
+	m    *metrics.Metrics
+	now  func() time.Time
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	calls map[string]*call
+}
+
+// New construct pay urls cache around provider
+func New(name string, p providers.Provider, cfg Config, m *metrics.Metrics) *Cache {
+	return &Cache{
+		name:  name,
+		p:     p,
+		cfg:   cfg,
+		m:     m,
+		now:   time.Now,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+		calls: make(map[string]*call),
+	}
+}
+
+// GetPayURL return cached pay url or call provider.
+// Concurrent calls for the same payment make only one provider call.
+// Pay urls of requests with merchant reference are unique and aren't cached
+func (c *Cache) GetPayURL(ctx context.Context, req *providers.PaymentRequest) (string, error) {
+	if c.cfg.TTL <= 0 || req.Reference != "" {
+		return c.p.GetPayURL(ctx, req)
+	}
+
+	key := cacheKey(req)
+	c.mu.Lock()
+	if e, ok := c.get(key); ok {
+		c.mu.Unlock()
+		if e.err != nil {
+			c.observe(ctx, ResultNegativeHit)
+		} else {
+			c.observe(ctx, ResultHit)
+		}
+		return e.url, e.err
+	}
+
+	if cl, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		c.observe(ctx, ResultShared)
+		return c.wait(ctx, cl, req)
+	}
+
+	cl := &call{done: make(chan struct{})}
+	c.calls[key] = cl
+	c.mu.Unlock()
+	c.observe(ctx, ResultMiss)
+
+	cl.url, cl.err = c.p.GetPayURL(ctx, req)
+
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.set(key, cl.url, cl.err)
+	c.mu.Unlock()
+	close(cl.done)
+
+	return cl.url, cl.err
+}
+
+// Refund refund payment by provider, refunds aren't cached
+func (c *Cache) Refund(ctx context.Context, req *providers.RefundRequest) (string, error) {
+	return providers.Refund(ctx, c.p, req)
+}
+
+// Len return number of cached payments
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// wait for shared call result. Call canceled by its initiator is repeated with own context
+func (c *Cache) wait(ctx context.Context, cl *call, req *providers.PaymentRequest) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-cl.done:
+	}
+
+	if (errors.Is(cl.err, context.Canceled) || errors.Is(cl.err, context.DeadlineExceeded)) && ctx.Err() == nil {
+		return c.p.GetPayURL(ctx, req)
+	}
+	return cl.url, cl.err
+}
+
+// get return not expired entry moving it to the front. Should be called under lock
+func (c *Cache) get(key string) (*entry, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	return e, true
+}
+
+// set cache provider result if it's cacheable evicting least recently used entries. Should be called under lock
+func (c *Cache) set(key, u string, err error) {
+	ttl := time.Duration(c.cfg.TTL)
+	if err != nil {
+		if !errors.Is(err, providers.ErrNotOK) || c.cfg.NegativeTTL <= 0 {
+			return
+		}
+		ttl = time.Duration(c.cfg.NegativeTTL)
+	}
+
+	e := &entry{key: key, url: u, err: err, expires: c.now().Add(ttl)}
+	if el, ok := c.items[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.lru.PushFront(e)
+
+	for c.cfg.MaxEntries > 0 && c.lru.Len() > c.cfg.MaxEntries {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.items, el.Value.(*entry).key)
+	}
+}
+
+// observe report cache lookup result
+func (c *Cache) observe(ctx context.Context, result string) {
+	c.m.CacheLookups.Inc(c.name, result)
+	utils.Logger(ctx).WithField("provider", c.name).WithField("cache", result).Debug("pay url cache lookup")
+}
+
+// cacheKey return cache key of payment request. Payments of the same product with changed price are cached separately
+func cacheKey(req *providers.PaymentRequest) string {
+	return req.ProductID + "\x00" + req.Price.String() + "\x00" + req.Description
+}
@@ -0,0 +1,180 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+func newTestCache(p providers.Provider, cfg Config) (*Cache, *metrics.Metrics, *time.Time) {
+	m := metrics.New()
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	c := New("apay", p, cfg, m)
+	c.now = func() time.Time { return now }
+	return c, m, &now
+}
+
+// payment return payment request of product
+func payment(productID string) *providers.PaymentRequest {
+	return &providers.PaymentRequest{ProductID: productID, Price: money.New(999, money.USD), Description: "Product " + productID}
+}
+
+func TestCache_GetPayURL(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{
+		TTL:         utils.Duration(time.Minute),
+		NegativeTTL: utils.Duration(10 * time.Second),
+		MaxEntries:  2,
+	}
+	notOK := errors.Wrap(providers.ErrNotOK, "bad product")
+	internal := errors.Wrap(providers.ErrInternalProvider, "boom")
+
+	pMock := &mocks.Provider{}
+	c, m, now := newTestCache(pMock, cfg)
+	ctx := context.Background()
+
+	pMock.On("GetPayURL", mock.Anything, payment("p1")).Return("url1", nil).Twice()
+	pMock.On("GetPayURL", mock.Anything, payment("p2")).Return("url2", nil).Once()
+	pMock.On("GetPayURL", mock.Anything, payment("p3")).Return("url3", nil).Once()
+	pMock.On("GetPayURL", mock.Anything, payment("bad")).Return("", notOK).Twice()
+	pMock.On("GetPayURL", mock.Anything, payment("err")).Return("", internal).Twice()
+
+	// miss and hit
+	for i := 0; i < 2; i++ {
+		u, err := c.GetPayURL(ctx, payment("p1"))
+		require.NoError(t, err)
+		require.Equal(t, "url1", u)
+	}
+	require.EqualValues(t, 1, m.CacheLookups.Value("apay", ResultMiss))
+	require.EqualValues(t, 1, m.CacheLookups.Value("apay", ResultHit))
+
+	// least recently used p2 is evicted
+	_, _ = c.GetPayURL(ctx, payment("p2"))
+	_, _ = c.GetPayURL(ctx, payment("p1"))
+	_, _ = c.GetPayURL(ctx, payment("p3"))
+	require.Equal(t, 2, c.Len())
+	_, _ = c.GetPayURL(ctx, payment("p1"))
+	require.EqualValues(t, 3, m.CacheLookups.Value("apay", ResultHit))
+
+	// expired
+	*now = now.Add(time.Minute)
+	u, err := c.GetPayURL(ctx, payment("p1"))
+	require.NoError(t, err)
+	require.Equal(t, "url1", u)
+
+	// not ok is cached with negative ttl
+	for i := 0; i < 2; i++ {
+		_, err = c.GetPayURL(ctx, payment("bad"))
+		require.Equal(t, providers.ErrNotOK, errors.Cause(err))
+	}
+	require.EqualValues(t, 1, m.CacheLookups.Value("apay", ResultNegativeHit))
+	*now = now.Add(10 * time.Second)
+	_, err = c.GetPayURL(ctx, payment("bad"))
+	require.Equal(t, providers.ErrNotOK, errors.Cause(err))
+
+	// internal errors aren't cached
+	for i := 0; i < 2; i++ {
+		_, err = c.GetPayURL(ctx, payment("err"))
+		require.Equal(t, providers.ErrInternalProvider, errors.Cause(err))
+	}
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestCache_GetPayURLSingleFlight(t *testing.T) {
+	t.Parallel()
+
+	const callers = 10
+
+	release := make(chan struct{})
+	pMock := &mocks.Provider{}
+	pMock.On("GetPayURL", mock.Anything, payment("p1")).
+		Run(func(mock.Arguments) { <-release }).
+		Return("url1", nil).Once()
+
+	c, m, _ := newTestCache(pMock, Config{TTL: utils.Duration(time.Minute)})
+
+	var wg sync.WaitGroup
+	urls := make([]string, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			urls[i], errs[i] = c.GetPayURL(context.Background(), payment("p1"))
+		}(i)
+	}
+
+	require.Eventually(t, func() bool {
+		return m.CacheLookups.Value("apay", ResultShared) == callers-1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range urls {
+		require.NoError(t, errs[i])
+		require.Equal(t, "url1", urls[i])
+	}
+	require.EqualValues(t, 1, m.CacheLookups.Value("apay", ResultMiss))
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestCache_GetPayURLDisabled(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	pMock.On("GetPayURL", mock.Anything, payment("p1")).Return("url1", nil).Twice()
+
+	c, m, _ := newTestCache(pMock, Config{})
+	for i := 0; i < 2; i++ {
+		u, err := c.GetPayURL(context.Background(), payment("p1"))
+		require.NoError(t, err)
+		require.Equal(t, "url1", u)
+	}
+	require.Equal(t, 0, c.Len())
+	require.EqualValues(t, 0, m.CacheLookups.Value("apay", ResultMiss))
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestCache_GetPayURLRequest(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	c, _, _ := newTestCache(pMock, Config{TTL: utils.Duration(time.Minute)})
+
+	repriced := payment("p1")
+	repriced.Price = money.New(1999, money.USD)
+	session := payment("p1")
+	session.Reference = "pay_1"
+	pMock.On("GetPayURL", mock.Anything, payment("p1")).Return("url1", nil).Once()
+	pMock.On("GetPayURL", mock.Anything, repriced).Return("url2", nil).Once()
+	pMock.On("GetPayURL", mock.Anything, session).Return("url3", nil).Twice()
+
+	for i := 0; i < 2; i++ {
+		u, err := c.GetPayURL(context.Background(), payment("p1"))
+		require.NoError(t, err)
+		require.Equal(t, "url1", u)
+
+		u, err = c.GetPayURL(context.Background(), repriced)
+		require.NoError(t, err)
+		require.Equal(t, "url2", u, "changed price is cached separately")
+
+		u, err = c.GetPayURL(context.Background(), session)
+		require.NoError(t, err)
+		require.Equal(t, "url3", u)
+	}
+	require.Equal(t, 2, c.Len(), "pay urls of payments with reference aren't cached")
+	mock.AssertExpectationsForObjects(t, pMock)
+}
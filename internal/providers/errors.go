@@ -1,10 +1,70 @@
 package providers
 
-import "errors"
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
 
 type ProviderErr error
 
 var (
+	// ErrInternalProvider returned when provider isn't reachable or failed with server error status
 	ErrInternalProvider = errors.New("internal provider error")
-	ErrNotOK            = errors.New("status code not OK")
+	// ErrNotOK returned when provider rejected request with not OK status, e.g. unknown product.
+	// Provider is healthy and executed nothing
+	ErrNotOK = errors.New("status code not OK")
+	// ErrCircuitOpen returned without calling provider while its circuit breaker is open
+	ErrCircuitOpen = errors.New("provider circuit breaker is open")
+	// ErrRateLimited returned without calling provider when its outbound rate limit is exceeded
+	ErrRateLimited = errors.New("provider rate limit exceeded")
+	// ErrRefundNotSupported returned by providers which can't refund payments
+	ErrRefundNotSupported = errors.New("provider doesn't support refunds")
+)
+
+// provider errors classes
+const (
+	ClassOK            = "ok"
+	ClassInternalError = "internal_error"
+	ClassNotOK         = "not_ok"
+	ClassCircuitOpen   = "circuit_open"
+	ClassRateLimited   = "rate_limited"
+	ClassNotSupported  = "not_supported"
+	ClassUnknownError  = "unknown_error"
 )
+
+// StatusError return error of provider not OK response status. Server errors and throttling are
+// internal provider errors, other statuses are rejections of request
+func StatusError(provider string, sc int) error {
+	if sc >= http.StatusInternalServerError || sc == http.StatusTooManyRequests {
+		return errors.Wrapf(ErrInternalProvider, "%s status code:%d", provider, sc)
+	}
+	return errors.Wrapf(ErrNotOK, "%s status code:%d", provider, sc)
+}
+
+// NotExecuted check that failed call was definitely not executed by provider, because provider rejected it
+// or it wasn't made. Calls failed otherwise, e.g. timed out, may have been executed
+func NotExecuted(err error) bool {
+	return errors.Is(err, ErrNotOK) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, ErrRefundNotSupported)
+}
+
+// ErrorClass classify provider call error
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return ClassOK
+	case errors.Is(err, ErrInternalProvider):
+		return ClassInternalError
+	case errors.Is(err, ErrNotOK):
+		return ClassNotOK
+	case errors.Is(err, ErrCircuitOpen):
+		return ClassCircuitOpen
+	case errors.Is(err, ErrRateLimited):
+		return ClassRateLimited
+	case errors.Is(err, ErrRefundNotSupported):
+		return ClassNotSupported
+	default:
+		return ClassUnknownError
+	}
+}
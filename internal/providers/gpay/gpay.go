@@ -2,8 +2,11 @@ package gpay
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -11,6 +14,12 @@ import (
 	"github.com/fedoseev-vitaliy/payments/internal/utils"
 )
 
+// Name Google Pay provider name
+const Name = "gpay"
+
+// Platforms platforms Google Pay is available on
+var Platforms = []providers.Platform{providers.PlatformAndroid, providers.PlatformWeb}
+
 type GooglePay struct {
 	url    *url.URL
 	client *utils.Client
@@ -24,6 +33,19 @@ type googlePayError struct {
 	Error string `json:"err"`
 }
 
+// googlePayRefund Google Pay refund request. Google Pay deduplicates refunds by request id
+type googlePayRefund struct {
+	RequestID         string `json:"requestId"`
+	MerchantReference string `json:"merchantReference"`
+	AmountMinor       int64  `json:"amountMinor"`
+	CurrencyCode      string `json:"currencyCode"`
+	Reason            string `json:"reason,omitempty"`
+}
+
+type googlePayRefundResponse struct {
+	RefundID string `json:"refundId"`
+}
+
 func New(cli *utils.Client, u *url.URL) *GooglePay {
 	return &GooglePay{
 		client: cli,
@@ -31,13 +53,19 @@ func New(cli *utils.Client, u *url.URL) *GooglePay {
 	}
 }
 
-func (g *GooglePay) GetPayURL(ctx context.Context, productID string) (string, error) {
+func (g *GooglePay) GetPayURL(ctx context.Context, req *providers.PaymentRequest) (string, error) {
 	res := &googlePayResponse{}
 	eres := &googlePayError{}
 
 	u := *g.url
 	q := u.Query()
-	q.Set("productID", productID)
+	q.Set("productID", req.ProductID)
+	q.Set("amount", strconv.FormatInt(req.Price.Amount(), 10))
+	q.Set("currency", string(req.Price.Currency()))
+	q.Set("description", req.Description)
+	if req.Reference != "" {
+		q.Set("reference", req.Reference)
+	}
 	u.RawQuery = q.Encode()
 
 	sc, err := g.client.Get(ctx, &u, res, eres)
@@ -46,8 +74,38 @@ func (g *GooglePay) GetPayURL(ctx context.Context, productID string) (string, er
 	}
 
 	if sc != http.StatusOK {
-		return "", errors.Wrapf(providers.ErrNotOK, "googlePay status code:%d", sc)
+		return "", providers.StatusError("googlePay", sc)
 	}
 
 	return res.PayButtonURL, nil
 }
+
+// Refund refund captured payment. Payment is refunded once for the same refund id, so request is safe to retry
+func (g *GooglePay) Refund(ctx context.Context, req *providers.RefundRequest) (string, error) {
+	body, err := json.Marshal(&googlePayRefund{
+		RequestID:         req.ID,
+		MerchantReference: req.Reference,
+		AmountMinor:       req.Amount.Amount(),
+		CurrencyCode:      string(req.Amount.Currency()),
+		Reason:            req.Reason,
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	res := &googlePayRefundResponse{}
+	eres := &googlePayError{}
+	u := *g.url
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/refunds"
+
+	sc, err := g.client.Post(ctx, &u, body, res, eres)
+	if err != nil {
+		return "", errors.Wrapf(providers.ErrInternalProvider, "googlePay err: %s", err.Error())
+	}
+
+	if sc != http.StatusOK {
+		return "", providers.StatusError("googlePay", sc)
+	}
+
+	return res.RefundID, nil
+}
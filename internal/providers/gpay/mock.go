@@ -1,16 +1,33 @@
 package gpay
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
 )
 
 // MockGPay is mock for like e2e test
-type MockGPay struct{}
+type MockGPay struct {
+	// WebhookSecret secret to sign webhooks with
+	WebhookSecret string
+}
 
 func (mg *MockGPay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	pid := r.URL.Query().Get("productID")
+	if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/refunds") {
+		mg.refund(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	pid := q.Get("productID")
 	if pid == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(&googlePayError{
@@ -20,11 +37,10 @@ func (mg *MockGPay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-
-	if pid == "badApple" {
-		w.WriteHeader(http.StatusInternalServerError)
+	if q.Get("amount") == "" || q.Get("currency") == "" {
+		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(&googlePayError{
-			Error: "bad apple product",
+			Error: "amount and currency query params are required",
 		}); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 		}
@@ -37,3 +53,54 @@ func (mg *MockGPay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
+
+// refund refund payment. Refund id is derived from request id, so the same refund is returned on retries
+func (mg *MockGPay) refund(w http.ResponseWriter, r *http.Request) {
+	req := &googlePayRefund{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.RequestID == "" || req.MerchantReference == "" ||
+		req.AmountMinor <= 0 || req.CurrencyCode == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(&googlePayError{
+			Error: "requestId, merchantReference, amountMinor and currencyCode are required",
+		}); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(&googlePayRefundResponse{RefundID: "gre_" + req.RequestID}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// NewWebhook construct webhook callback request to url reporting event the way Google Pay does.
+// Request is signed at event timestamp
+func (mg *MockGPay) NewWebhook(url string, ev *providers.Event) (*http.Request, error) {
+	status := ""
+	for name, t := range googlePayStatuses {
+		if t == ev.Type {
+			status = name
+		}
+	}
+
+	body, err := json.Marshal(&googlePayEvent{
+		ID:                ev.ID,
+		Status:            status,
+		MerchantReference: ev.SessionID,
+		Message:           ev.Reason,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	r, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ts := ev.Timestamp.UTC().Format(time.RFC3339)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(TimestampHeader, ts)
+	r.Header.Set(SignatureHeader, base64.StdEncoding.EncodeToString(webhookSignature(mg.WebhookSecret, ts, body)))
+	return r, nil
+}
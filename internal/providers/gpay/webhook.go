@@ -0,0 +1,90 @@
+package gpay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+// Google Pay webhook signature headers
+const (
+	// TimestampHeader RFC 3339 time webhook is signed at
+	TimestampHeader = "X-GPay-Timestamp"
+	// SignatureHeader base64 encoded signature
+	SignatureHeader = "X-GPay-Signature"
+)
+
+// googlePayStatuses Google Pay webhook payment statuses
+var googlePayStatuses = map[string]providers.EventType{
+	"AUTHORIZED": providers.EventAuthorized,
+	"CAPTURED":   providers.EventCaptured,
+	"DECLINED":   providers.EventFailed,
+}
+
+type googlePayEvent struct {
+	ID                string `json:"id"`
+	Status            string `json:"status"`
+	MerchantReference string `json:"merchant_reference"`
+	Message           string `json:"message,omitempty"`
+}
+
+// WebhookVerifier Google Pay webhooks verifier.
+// Signature is base64 encoded HMAC-SHA256 of timestamp header and body joined with new line
+type WebhookVerifier struct {
+	secret string
+}
+
+// NewWebhookVerifier construct verifier of webhooks signed with secret
+func NewWebhookVerifier(secret string) *WebhookVerifier {
+	return &WebhookVerifier{secret: secret}
+}
+
+// ParseWebhook verify webhook signature and return its event
+func (v *WebhookVerifier) ParseWebhook(r *http.Request, body []byte) (*providers.Event, error) {
+	ts := r.Header.Get(TimestampHeader)
+	sig, err := base64.StdEncoding.DecodeString(r.Header.Get(SignatureHeader))
+	if ts == "" || err != nil || len(sig) == 0 {
+		return nil, errors.Wrapf(providers.ErrInvalidWebhook, "googlePay %s and %s headers are required", TimestampHeader, SignatureHeader)
+	}
+	if !hmac.Equal(sig, webhookSignature(v.secret, ts, body)) {
+		return nil, errors.WithStack(providers.ErrInvalidWebhookSignature)
+	}
+
+	signedAt, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return nil, errors.Wrapf(providers.ErrInvalidWebhook, "googlePay timestamp %q", ts)
+	}
+
+	ev := &googlePayEvent{}
+	if err := json.Unmarshal(body, ev); err != nil {
+		return nil, errors.Wrapf(providers.ErrInvalidWebhook, "googlePay event: %s", err.Error())
+	}
+	t, ok := googlePayStatuses[ev.Status]
+	if !ok || ev.ID == "" || ev.MerchantReference == "" {
+		return nil, errors.Wrapf(providers.ErrInvalidWebhook, "googlePay event %q of status %q", ev.ID, ev.Status)
+	}
+
+	return &providers.Event{
+		ID:        ev.ID,
+		Provider:  Name,
+		Type:      t,
+		SessionID: ev.MerchantReference,
+		Timestamp: signedAt.UTC(),
+		Reason:    ev.Message,
+	}, nil
+}
+
+// webhookSignature return signature of webhook body signed at ts
+func webhookSignature(secret, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(ts + "\n"))
+	_, _ = mac.Write(body)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,91 @@
+package limiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/ratelimit"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// Config provider outbound rate limit configuration
+type Config struct {
+	ratelimit.Config
+	// MaxWait how long call may wait for rate limit token. Call never waits beyond its context deadline
+	MaxWait utils.Duration `json:"max_wait"`
+}
+
+// Limiter payment provider decorator limiting calls rate to stay under provider quota
+type Limiter struct {
+	name    string
+	p       providers.Provider
+	bucket  *ratelimit.Bucket
+	maxWait time.Duration
+	m       *metrics.Metrics
+	now     func() time.Time
+}
+
+// New construct rate limiter around provider. Provider is called without limit if rate limit is disabled
+func New(name string, p providers.Provider, cfg Config, m *metrics.Metrics) providers.Provider {
+	if !cfg.Enabled() {
+		return p
+	}
+
+	return &Limiter{
+		name:    name,
+		p:       p,
+		bucket:  ratelimit.NewBucket(cfg.Config),
+		maxWait: time.Duration(cfg.MaxWait),
+		m:       m,
+		now:     time.Now,
+	}
+}
+
+// GetPayURL call provider once rate limit token is available.
+// providers.ErrRateLimited is returned without calling provider if token isn't available in time
+func (l *Limiter) GetPayURL(ctx context.Context, req *providers.PaymentRequest) (string, error) {
+	if err := l.wait(ctx); err != nil {
+		return "", err
+	}
+	return l.p.GetPayURL(ctx, req)
+}
+
+// Refund refund payment by provider once rate limit token is available. Refunds share pay urls quota
+func (l *Limiter) Refund(ctx context.Context, req *providers.RefundRequest) (string, error) {
+	if err := l.wait(ctx); err != nil {
+		return "", err
+	}
+	return providers.Refund(ctx, l.p, req)
+}
+
+// wait wait for rate limit token. providers.ErrRateLimited is returned if token isn't available in time
+func (l *Limiter) wait(ctx context.Context) error {
+	now := l.now()
+	maxWait := l.maxWait
+	if d, ok := ctx.Deadline(); ok && d.Sub(now) < maxWait {
+		maxWait = d.Sub(now)
+	}
+
+	wait, ok := l.bucket.Reserve(now, maxWait)
+	if !ok {
+		l.m.RateLimited.Inc("provider", l.name)
+		utils.Logger(ctx).WithField("provider", l.name).Debug("provider rate limit exceeded")
+		return errors.Wrapf(providers.ErrRateLimited, "next call in %s", wait)
+	}
+
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	}
+	return nil
+}
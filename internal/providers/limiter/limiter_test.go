@@ -0,0 +1,61 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/ratelimit"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+func TestLimiter_GetPayURL(t *testing.T) {
+	t.Parallel()
+
+	req := &providers.PaymentRequest{ProductID: "1"}
+	pMock := &mocks.Provider{}
+	pMock.On("GetPayURL", mock.Anything, req).Return("url1", nil).Times(3)
+
+	m := metrics.New()
+	l := New("apay", pMock, Config{
+		Config:  ratelimit.Config{RPS: 20, Burst: 1},
+		MaxWait: utils.Duration(60 * time.Millisecond),
+	}, m).(*Limiter)
+	ctx := context.Background()
+
+	u, err := l.GetPayURL(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, "url1", u)
+
+	// next token is in 50ms which is within max wait
+	start := time.Now()
+	_, err = l.GetPayURL(ctx, req)
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= 40*time.Millisecond, "call waited for token")
+
+	// the only token is reserved, the next one is beyond context deadline
+	_, err = l.GetPayURL(ctx, req)
+	require.NoError(t, err)
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = l.GetPayURL(dctx, req)
+	require.Equal(t, providers.ErrRateLimited, errors.Cause(err))
+	require.Equal(t, providers.ClassRateLimited, providers.ErrorClass(err))
+	require.EqualValues(t, 1, m.RateLimited.Value("provider", "apay"))
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
+
+func TestNew_Disabled(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	require.Equal(t, providers.Provider(pMock), New("apay", pMock, Config{}, metrics.New()))
+}
@@ -0,0 +1,27 @@
+package providers
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Platform client device platform to choose eligible providers
+type Platform string
+
+// supported platforms
+const (
+	// PlatformAny unknown platform, every provider is eligible
+	PlatformAny     Platform = ""
+	PlatformIOS     Platform = "ios"
+	PlatformAndroid Platform = "android"
+	PlatformWeb     Platform = "web"
+)
+
+// ParsePlatform parse platform name. Empty name is PlatformAny
+func ParsePlatform(s string) (Platform, error) {
+	switch p := Platform(s); p {
+	case PlatformAny, PlatformIOS, PlatformAndroid, PlatformWeb:
+		return p, nil
+	default:
+		return PlatformAny, errors.Errorf("unknown platform %q", s)
+	}
+}
@@ -1,7 +1,22 @@
 package providers
 
-import "context"
+import (
+	"context"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+)
+
+// PaymentRequest product payment parameters passed to provider
+type PaymentRequest struct {
+	ProductID string
+	// Price payment amount in currency minor units
+	Price       money.Money
+	Description string
+	// Reference merchant reference of payment, e.g. payment session id. Providers return it in webhooks.
+	// Empty for payment urls which aren't bound to payment session
+	Reference string
+}
 
 type Provider interface {
-	GetPayURL(ctx context.Context, productID string) (string, error)
+	GetPayURL(ctx context.Context, req *PaymentRequest) (string, error)
 }
@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// recoveredProvider payment provider decorator turning panics into errors
+type recoveredProvider struct {
+	p Provider
+}
+
+// Recover wrap provider to return ErrInternalProvider instead of panic.
+// Providers are called in separate goroutines where panic would crash the whole server
+func Recover(p Provider) Provider {
+	return &recoveredProvider{p: p}
+}
+
+// GetPayURL call provider recovering from panic
+func (rp *recoveredProvider) GetPayURL(ctx context.Context, req *PaymentRequest) (u string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			u, err = "", errors.Wrapf(ErrInternalProvider, "provider panic: %v", r)
+		}
+	}()
+
+	return rp.p.GetPayURL(ctx, req)
+}
+
+// Refund refund payment by provider recovering from panic
+func (rp *recoveredProvider) Refund(ctx context.Context, req *RefundRequest) (id string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			id, err = "", errors.Wrapf(ErrInternalProvider, "provider panic: %v", r)
+		}
+	}()
+
+	return Refund(ctx, rp.p, req)
+}
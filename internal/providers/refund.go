@@ -0,0 +1,42 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+)
+
+// RefundRequest refund of captured payment passed to provider
+type RefundRequest struct {
+	// ID refund id. Provider refunds payment once for the same refund id
+	ID string
+	// Reference merchant reference of refunded payment, payment session id
+	Reference string
+	// Amount refunded amount, partial refund is less than payment amount
+	Amount money.Money
+	Reason string
+}
+
+// Refunder provider which can refund captured payments. It's optional, providers
+// which don't implement it can't refund. Refund return provider refund id
+type Refunder interface {
+	Refund(ctx context.Context, req *RefundRequest) (string, error)
+}
+
+// Refund refund payment by provider. ErrRefundNotSupported is returned if provider isn't a Refunder.
+// Providers decorators refund by decorated provider with it
+func Refund(ctx context.Context, p Provider, req *RefundRequest) (string, error) {
+	r, ok := p.(Refunder)
+	if !ok {
+		return "", errors.Wrapf(ErrRefundNotSupported, "%T", p)
+	}
+	return r.Refund(ctx, req)
+}
+
+// RefundProvider provider which can refund payments
+type RefundProvider interface {
+	Provider
+	Refunder
+}
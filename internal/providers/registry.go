@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Registry named set of payment providers
+type Registry struct {
+	mu        sync.RWMutex
+	names     []string
+	providers map[string]Provider
+	platforms map[string][]Platform
+}
+
+// NewRegistry construct empty providers registry
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: make(map[string]Provider),
+		platforms: make(map[string][]Platform),
+	}
+}
+
+// Register add provider to registry under unique name.
+// Provider is eligible for given platforms only or for every platform if there are no one
+func (r *Registry) Register(name string, p Provider, platforms ...Platform) error {
+	if name == "" {
+		return errors.New("provider name shouldn't be empty")
+	}
+
+	if p == nil {
+		return errors.Errorf("provider %s shouldn't be nil", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.providers[name]; ok {
+		return errors.Errorf("provider %s already registered", name)
+	}
+
+	r.names = append(r.names, name)
+	r.providers[name] = p
+	r.platforms[name] = platforms
+
+	return nil
+}
+
+// Get return provider by name
+func (r *Registry) Get(name string) (Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names return registered providers names in registration order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.names))
+	copy(names, r.names)
+	return names
+}
+
+// Len return number of registered providers
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.names)
+}
+
+// Eligible return names of providers eligible for platform in registration order.
+// Every provider is eligible for PlatformAny
+func (r *Registry) Eligible(platform Platform) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.names))
+	for _, name := range r.names {
+		if platform == PlatformAny || eligible(r.platforms[name], platform) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// eligible check that platform is one of provider platforms. Provider without platforms is eligible for any
+func eligible(platforms []Platform, platform Platform) bool {
+	if len(platforms) == 0 {
+		return true
+	}
+
+	for _, p := range platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
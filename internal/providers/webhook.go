@@ -0,0 +1,48 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// EventType payment outcome reported by provider webhook
+type EventType string
+
+// webhook event types
+const (
+	// EventAuthorized provider authorized payment
+	EventAuthorized EventType = "authorized"
+	// EventCaptured provider captured payment
+	EventCaptured EventType = "captured"
+	// EventFailed payment is declined or failed
+	EventFailed EventType = "failed"
+)
+
+var (
+	// ErrInvalidWebhook returned when webhook payload or signature headers are malformed
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	// ErrInvalidWebhookSignature returned when webhook isn't signed with provider secret
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+)
+
+// Event provider webhook event in common format
+type Event struct {
+	// ID provider event id, unique per provider
+	ID       string
+	Provider string
+	Type     EventType
+	// SessionID payment session id passed to provider as merchant reference
+	SessionID string
+	// Timestamp time provider signed event at
+	Timestamp time.Time
+	// Reason failure reason reported by provider
+	Reason string
+}
+
+// WebhookVerifier verify provider webhook signature and parse its event
+type WebhookVerifier interface {
+	// ParseWebhook return event of webhook request with body.
+	// ErrInvalidWebhook or ErrInvalidWebhookSignature is returned if webhook can't be trusted
+	ParseWebhook(r *http.Request, body []byte) (*Event, error)
+}
@@ -0,0 +1,183 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config token bucket rate limit. Unlimited if RPS is 0
+type Config struct {
+	// RPS tokens refilled per second
+	RPS float64 `json:"rps"`
+	// Burst bucket capacity. RPS rounded up is used if 0
+	Burst int `json:"burst"`
+}
+
+// Enabled check that limit is set
+func (c Config) Enabled() bool {
+	return c.RPS > 0
+}
+
+// Validate check that limit values aren't negative
+func (c Config) Validate() error {
+	if c.RPS < 0 || c.Burst < 0 {
+		return errors.New("rate limit rps and burst should not be negative")
+	}
+	return nil
+}
+
+// burst return bucket capacity
+func (c Config) burst() float64 {
+	if c.Burst > 0 {
+		return float64(c.Burst)
+	}
+	return math.Max(1, math.Ceil(c.RPS))
+}
+
+// Result rate limit check result
+type Result struct {
+	Allowed bool
+	// Limit bucket capacity
+	Limit int
+	// Remaining tokens left after check
+	Remaining int
+	// Reset time until bucket is full again
+	Reset time.Duration
+	// RetryAfter time until next token if request isn't allowed
+	RetryAfter time.Duration
+}
+
+// Bucket token bucket
+type Bucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket construct full token bucket
+func NewBucket(cfg Config) *Bucket {
+	return &Bucket{rate: cfg.RPS, burst: cfg.burst(), tokens: cfg.burst()}
+}
+
+// Take take token at now if there is one
+func (b *Bucket) Take(now time.Time) Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, ok := b.reserve(now, 0)
+	res := Result{
+		Allowed:   ok,
+		Limit:     int(b.burst),
+		Remaining: int(math.Max(0, math.Floor(b.tokens))),
+		Reset:     b.wait(b.burst),
+	}
+	if !ok {
+		res.RetryAfter = b.wait(1)
+	}
+	return res
+}
+
+// Reserve take token at now if it's available within maxWait. Return how long to wait before using the token
+func (b *Bucket) Reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.reserve(now, maxWait)
+}
+
+// reserve refill bucket and take token going into debt for at most maxWait
+func (b *Bucket) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	wait := b.wait(1)
+	if wait > maxWait {
+		return wait, false
+	}
+
+	b.tokens--
+	return wait, true
+}
+
+// wait return time until bucket has n tokens
+func (b *Bucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	if b.rate <= 0 {
+		return math.MaxInt64
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full check that bucket is refilled at now
+func (b *Bucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// purgeInterval how often idle buckets are evicted
+const purgeInterval = time.Minute
+
+// Limiter token buckets by key, e.g. client ip. Idle buckets are evicted once refilled
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	nextPurge time.Time
+}
+
+// NewLimiter construct limiter with the same limit for every key
+func NewLimiter(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+// Allow take token of key bucket
+func (l *Limiter) Allow(key string) Result {
+	now := l.now()
+
+	l.mu.Lock()
+	if now.After(l.nextPurge) {
+		for k, b := range l.buckets {
+			if b.full(now) {
+				delete(l.buckets, k)
+			}
+		}
+		l.nextPurge = now.Add(purgeInterval)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = NewBucket(l.cfg)
+		l.buckets[key] = b
+	}
+	l.mu.Unlock()
+
+	return b.Take(now)
+}
+
+// Len return number of tracked keys
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.buckets)
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucket_Take(t *testing.T) {
+	t.Parallel()
+
+	b := NewBucket(Config{RPS: 2, Burst: 3})
+	now := time.Unix(1600000000, 0)
+
+	for i := 2; i >= 0; i-- {
+		res := b.Take(now)
+		require.True(t, res.Allowed)
+		require.Equal(t, 3, res.Limit)
+		require.Equal(t, i, res.Remaining)
+	}
+
+	res := b.Take(now)
+	require.False(t, res.Allowed)
+	require.Equal(t, 0, res.Remaining)
+	require.Equal(t, 500*time.Millisecond, res.RetryAfter)
+	require.Equal(t, 1500*time.Millisecond, res.Reset)
+
+	res = b.Take(now.Add(500 * time.Millisecond))
+	require.True(t, res.Allowed, "token refilled")
+	require.False(t, b.Take(now.Add(500*time.Millisecond)).Allowed)
+
+	res = b.Take(now.Add(time.Hour))
+	require.True(t, res.Allowed)
+	require.Equal(t, 2, res.Remaining, "refill is capped by burst")
+}
+
+func TestBucket_Reserve(t *testing.T) {
+	t.Parallel()
+
+	b := NewBucket(Config{RPS: 10})
+	now := time.Unix(1600000000, 0)
+	for i := 0; i < 10; i++ {
+		wait, ok := b.Reserve(now, 0)
+		require.True(t, ok)
+		require.Zero(t, wait)
+	}
+
+	_, ok := b.Reserve(now, 50*time.Millisecond)
+	require.False(t, ok, "next token is in 100ms")
+
+	wait, ok := b.Reserve(now, 100*time.Millisecond)
+	require.True(t, ok)
+	require.Equal(t, 100*time.Millisecond, wait)
+
+	wait, ok = b.Reserve(now, time.Second)
+	require.True(t, ok)
+	require.Equal(t, 200*time.Millisecond, wait, "reserved tokens are waited in order")
+}
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(Config{RPS: 1})
+	now := time.Unix(1600000000, 0)
+	l.now = func() time.Time { return now }
+
+	require.True(t, l.Allow("a").Allowed)
+	require.False(t, l.Allow("a").Allowed)
+	require.True(t, l.Allow("b").Allowed, "keys have own buckets")
+	require.Equal(t, 2, l.Len())
+
+	now = now.Add(2 * purgeInterval)
+	require.True(t, l.Allow("c").Allowed)
+	require.Equal(t, 1, l.Len(), "refilled buckets are evicted")
+}
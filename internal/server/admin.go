@@ -0,0 +1,110 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/faults"
+	"github.com/fedoseev-vitaliy/payments/internal/ledger"
+)
+
+// AdminHandler service administration handler. Every request requires admin bearer token
+type AdminHandler struct {
+	l      *logrus.Logger
+	token  string
+	faults *faults.Injector
+	ledger *ledger.Ledger
+}
+
+// NewAdminHandler construct admin handler
+func NewAdminHandler(l *logrus.Logger, token string, f *faults.Injector, lg *ledger.Ledger) *AdminHandler {
+	return &AdminHandler{l: l, token: token, faults: f, ledger: lg}
+}
+
+// authorized check admin bearer token
+func (ah *AdminHandler) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ah.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(ah.token)) == 1
+}
+
+// Faults return or replace faults injection config
+func (ah *AdminHandler) Faults(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ah.authorized(r) {
+		ah.writeError(w, http.StatusUnauthorized, "admin token is missing or invalid")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		cfg := faults.Config{}
+		d := json.NewDecoder(r.Body)
+		d.DisallowUnknownFields()
+		if err := d.Decode(&cfg); err != nil {
+			ah.writeError(w, http.StatusBadRequest, "invalid faults config: "+err.Error())
+			return
+		}
+
+		if err := ah.faults.SetConfig(cfg); err != nil {
+			ah.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		ah.writeError(w, http.StatusForbidden, "Only GET and PUT methods supported")
+		return
+	}
+
+	cfg := ah.faults.Config()
+	if err := json.NewEncoder(w).Encode(&cfg); err != nil {
+		ah.l.Error(err.Error())
+	}
+}
+
+// TrialBalance return ledger accounts balances as of as_of query param or now
+func (ah *AdminHandler) TrialBalance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ah.authorized(r) {
+		ah.writeError(w, http.StatusUnauthorized, "admin token is missing or invalid")
+		return
+	}
+	if r.Method != http.MethodGet {
+		ah.writeError(w, http.StatusForbidden, "Only GET method supported")
+		return
+	}
+
+	var asOf time.Time
+	if v := r.URL.Query().Get("as_of"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			ah.writeError(w, http.StatusBadRequest, "as_of should be RFC3339 date-time")
+			return
+		}
+		asOf = t
+	}
+
+	tb, err := ah.ledger.TrialBalance(r.Context(), asOf)
+	if err != nil {
+		ah.l.WithError(err).Error("failed to get ledger trial balance")
+		ah.writeError(w, http.StatusInternalServerError, "failed to get trial balance")
+		return
+	}
+	if err := json.NewEncoder(w).Encode(tb); err != nil {
+		ah.l.Error(err.Error())
+	}
+}
+
+// writeError write error response
+func (ah *AdminHandler) writeError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&ErrorResponse{
+		Error: msg,
+	}); err != nil {
+		ah.l.Error(err.Error())
+	}
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/faults"
+	"github.com/fedoseev-vitaliy/payments/internal/ledger"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+func TestAdminHandler_Faults(t *testing.T) {
+	t.Parallel()
+
+	l := newTestLogger()
+	inj, err := faults.New(faults.Config{}, l)
+	require.NoError(t, err)
+
+	r := newRouter(l, providers.NewRegistry(), NewHealthHandler(l, nil), Options{
+		Validation: ValidationStrict,
+		Faults:     inj,
+		AdminToken: "secret",
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		body   string
+		want   int
+	}{
+		{name: "no token", method: http.MethodGet, want: http.StatusUnauthorized},
+		{name: "wrong token", method: http.MethodGet, token: "guess", want: http.StatusUnauthorized},
+		{name: "get", method: http.MethodGet, token: "secret", want: http.StatusOK},
+		{
+			name:   "invalid rule",
+			method: http.MethodPut,
+			token:  "secret",
+			body:   `{"enabled":true,"rules":[{"route":"/healthz","kind":"panic","probability":2}]}`,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "put",
+			method: http.MethodPut,
+			token:  "secret",
+			body:   `{"enabled":true,"rules":[{"route":"/healthz","kind":"status","status":503,"probability":1}]}`,
+			want:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1/admin/faults", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		require.Equal(t, tt.want, rec.Code, "%s: %s", tt.name, rec.Body.String())
+	}
+
+	require.True(t, inj.Config().Enabled)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	t.Run("disabled without token", func(t *testing.T) {
+		r := newRouter(l, providers.NewRegistry(), NewHealthHandler(l, nil), Options{Faults: inj})
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/faults", nil))
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestAdminHandler_TrialBalance(t *testing.T) {
+	t.Parallel()
+
+	l := newTestLogger()
+	lg := ledger.New(ledger.NewMemoryStore())
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, lg.Post(context.Background(), &ledger.Transaction{
+		ID:       "pay_1:capture",
+		Kind:     ledger.KindCapture,
+		Entries:  ledger.Transfer(ledger.ProviderClearing("apay"), ledger.MerchantReceivable("shop"), money.New(999, money.USD)),
+		PostedAt: at,
+	}))
+
+	r := newRouter(l, providers.NewRegistry(), NewHealthHandler(l, nil), Options{
+		Validation: ValidationStrict,
+		Ledger:     lg,
+		AdminToken: "secret",
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		token    string
+		want     int
+		accounts int
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "now", token: "secret", want: http.StatusOK, accounts: 2},
+		{name: "as of posting", query: "?as_of=2020-01-01T00:00:00Z", token: "secret", want: http.StatusOK, accounts: 2},
+		{name: "before posting", query: "?as_of=2019-12-31T23:59:59Z", token: "secret", want: http.StatusOK},
+		{name: "invalid as of", query: "?as_of=yesterday", token: "secret", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/ledger/trial-balance"+tt.query, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		require.Equal(t, tt.want, rec.Code, "%s: %s", tt.name, rec.Body.String())
+		if tt.want != http.StatusOK {
+			continue
+		}
+
+		tb := &ledger.TrialBalance{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), tb), tt.name)
+		require.Len(t, tb.Accounts, tt.accounts, tt.name)
+		require.True(t, tb.Balanced, tt.name)
+	}
+}
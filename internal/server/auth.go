@@ -0,0 +1,315 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// authentication headers
+const (
+	// APIKeyHeader static api key
+	APIKeyHeader = "X-API-Key"
+	// SignatureKeyIDHeader id of HMAC key request is signed with
+	SignatureKeyIDHeader = "X-Signature-Key-ID"
+	// SignatureTimestampHeader unix time request is signed at
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	// SignatureNonceHeader unique random string of signed request
+	SignatureNonceHeader = "X-Signature-Nonce"
+	// SignatureHeader hex encoded HMAC-SHA256 of request, see SignRequest
+	SignatureHeader = "X-Signature"
+)
+
+// authentication methods
+const (
+	AuthMethodAPIKey = "api_key"
+	AuthMethodHMAC   = "hmac"
+)
+
+// DefaultAuthMaxSkew default max difference between signed request timestamp and server time
+const DefaultAuthMaxSkew = 5 * time.Minute
+
+// signature limits
+const (
+	maxSignedBodySize = 1 << 20
+	minNonceLen       = 16
+	maxNonceLen       = 128
+)
+
+// errors returned to client when authentication failed
+var (
+	errAuthRequired     = errors.New("authentication required")
+	errInvalidAPIKey    = errors.New("invalid api key")
+	errAmbiguousAuth    = errors.New("either api key or signature should be set")
+	errSignatureHeaders = errors.New("signature key id, timestamp, nonce and signature headers are required")
+	errSignatureExpired = errors.New("signature timestamp is out of allowed window")
+	errInvalidNonce     = errors.New("signature nonce should be from 16 to 128 characters")
+	errInvalidSignature = errors.New("invalid signature")
+	errBodyTooLarge     = errors.New("request body is too large")
+	errNonceReused      = errors.New("signature nonce is already used")
+)
+
+// Identity authenticated client identity
+type Identity struct {
+	// Tenant id of tenant credentials belong to
+	Tenant string
+	// KeyID HMAC key id or api key hash prefix, safe to log
+	KeyID string
+	// Method authentication method, AuthMethodAPIKey or AuthMethodHMAC
+	Method string
+}
+
+type authContextKey int
+
+const (
+	identityKey authContextKey = iota
+	authErrorKey
+)
+
+// WithIdentity return context with authenticated client identity
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey, id)
+}
+
+// IdentityFromContext return authenticated client identity from context if request is authenticated
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey).(*Identity)
+	return id, ok && id != nil
+}
+
+// SignRequest set HMAC signature headers of request signed at now with key secret.
+// Signature is hex encoded HMAC-SHA256 of method, path, raw query, timestamp, nonce
+// and hex encoded SHA256 of body joined with new lines
+func SignRequest(r *http.Request, keyID, secret, nonce string, now time.Time) error {
+	body, err := readBody(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ts := strconv.FormatInt(now.Unix(), 10)
+	r.Header.Set(SignatureKeyIDHeader, keyID)
+	r.Header.Set(SignatureTimestampHeader, ts)
+	r.Header.Set(SignatureNonceHeader, nonce)
+	r.Header.Set(SignatureHeader, hex.EncodeToString(signature(r, secret, ts, nonce, body)))
+	return nil
+}
+
+// signature calculate request HMAC-SHA256
+func signature(r *http.Request, secret, ts, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	msg := strings.Join([]string{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, ts, nonce, hex.EncodeToString(sum[:])}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// readBody read request body restoring it for handlers
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxSignedBodySize+1))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(body) > maxSignedBodySize {
+		return nil, errors.Wrapf(errBodyTooLarge, "%d bytes max", maxSignedBodySize)
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// nonceCache remembers nonces of signed requests until their timestamps leave allowed window
+type nonceCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextPurge time.Time
+}
+
+// newNonceCache construct empty nonce cache
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// add remember nonce until expiry. Return false if nonce is already remembered
+func (c *nonceCache) add(nonce string, now, expiry time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.nextPurge) {
+		for n, exp := range c.seen {
+			if now.After(exp) {
+				delete(c.seen, n)
+			}
+		}
+		c.nextPurge = now.Add(time.Minute)
+	}
+
+	if exp, ok := c.seen[nonce]; ok && !now.After(exp) {
+		return false
+	}
+	c.seen[nonce] = expiry
+	return true
+}
+
+// remove forget nonce so it may be added again
+func (c *nonceCache) remove(nonce string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.seen, nonce)
+}
+
+// authMiddleware is a middleware handler that authenticates request by api key or HMAC signature
+// and puts client identity to request context with identity fields added to request scoped logger
+type authMiddleware struct {
+	handler http.Handler
+	tenants *tenant.Resolver
+	nonces  *nonceCache
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+// ServeHTTP handles the request passing client identity or authentication error in context.
+// Routes requiring authentication reject requests with error
+func (am *authMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, err := am.authenticate(r)
+	ctx := r.Context()
+	switch {
+	case err != nil:
+		utils.Logger(ctx).WithError(err).Warn("authentication failed")
+		ctx = context.WithValue(ctx, authErrorKey, err)
+	case id != nil:
+		ctx = WithIdentity(ctx, id)
+		ctx = utils.WithLogger(ctx, utils.Logger(ctx).WithFields(logrus.Fields{
+			"auth_method": id.Method,
+			"key_id":      id.KeyID,
+		}))
+	}
+
+	am.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// authenticate return identity of request credentials. Identity is nil if request has no credentials
+func (am *authMiddleware) authenticate(r *http.Request) (*Identity, error) {
+	key := r.Header.Get(APIKeyHeader)
+	signed := r.Header.Get(SignatureHeader) != "" || r.Header.Get(SignatureKeyIDHeader) != ""
+	switch {
+	case key != "" && signed:
+		return nil, errAmbiguousAuth
+	case key != "":
+		t, ok := am.tenants.APIKey(key)
+		if !ok {
+			return nil, errInvalidAPIKey
+		}
+		return &Identity{Tenant: t.ID, KeyID: tenant.HashAPIKey(key)[:8], Method: AuthMethodAPIKey}, nil
+	case signed:
+		return am.verifySignature(r)
+	default:
+		return nil, nil
+	}
+}
+
+// verifySignature check request HMAC signature, timestamp window and nonce uniqueness
+func (am *authMiddleware) verifySignature(r *http.Request) (*Identity, error) {
+	keyID := r.Header.Get(SignatureKeyIDHeader)
+	ts := r.Header.Get(SignatureTimestampHeader)
+	nonce := r.Header.Get(SignatureNonceHeader)
+	sig, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if keyID == "" || ts == "" || nonce == "" || err != nil || len(sig) == 0 {
+		return nil, errSignatureHeaders
+	}
+
+	if len(nonce) < minNonceLen || len(nonce) > maxNonceLen {
+		return nil, errInvalidNonce
+	}
+
+	now := am.now()
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, errSignatureHeaders
+	}
+	signedAt := time.Unix(sec, 0)
+	if signedAt.Before(now.Add(-am.maxSkew)) || signedAt.After(now.Add(am.maxSkew)) {
+		return nil, errSignatureExpired
+	}
+
+	t, secret, ok := am.tenants.HMACKey(keyID)
+	if !ok {
+		return nil, errInvalidSignature
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !hmac.Equal(sig, signature(r, secret, ts, nonce, body)) {
+		return nil, errInvalidSignature
+	}
+
+	// nonce is remembered only for valid signatures so clients can't exhaust it.
+	// Timestamp outside of window is rejected, so nonce is kept while its timestamp is inside
+	if !am.nonces.add(keyID+":"+nonce, now, signedAt.Add(am.maxSkew)) {
+		return nil, errNonceReused
+	}
+
+	return &Identity{Tenant: t.ID, KeyID: keyID, Method: AuthMethodHMAC}, nil
+}
+
+// newAuthMiddleware constructs a new authMiddleware middleware handler.
+// Signed requests timestamps may differ from server time by maxSkew, DefaultAuthMaxSkew is used if 0
+func newAuthMiddleware(h http.Handler, tenants *tenant.Resolver, maxSkew time.Duration) *authMiddleware {
+	if maxSkew <= 0 {
+		maxSkew = DefaultAuthMaxSkew
+	}
+
+	return &authMiddleware{
+		handler: h,
+		tenants: tenants,
+		nonces:  newNonceCache(),
+		maxSkew: maxSkew,
+		now:     time.Now,
+	}
+}
+
+// requireAuth wrap handler to reject requests with invalid credentials with Unauthorized.
+// Requests without credentials are rejected if required
+func requireAuth(h http.HandlerFunc, l *logrus.Logger, required bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err, _ := r.Context().Value(authErrorKey).(error)
+		if _, ok := IdentityFromContext(r.Context()); !ok && err == nil && required {
+			err = errAuthRequired
+		}
+		if err == nil {
+			h(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		if err := json.NewEncoder(w).Encode(&ErrorResponse{
+			Error: err.Error(),
+		}); err != nil {
+			l.Error(err.Error())
+		}
+	}
+}
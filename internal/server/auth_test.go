@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	t.Parallel()
+
+	const secret = "0123456789abcdef0123456789abcdef"
+	tenants, err := tenant.NewResolver([]*tenant.Tenant{{
+		ID:       "shop",
+		APIKeys:  []string{tenant.HashAPIKey("shop-key")},
+		HMACKeys: map[string]string{"shop-1": secret},
+	}}, "")
+	require.NoError(t, err)
+
+	now := time.Unix(1600000000, 0)
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		id, _ := IdentityFromContext(r.Context())
+		_ = json.NewEncoder(w).Encode(id)
+	}
+
+	signed := func(method, body, keyID, nonce string, at time.Time) *http.Request {
+		req := httptest.NewRequest(method, "/api/v1/payments?productID=1", strings.NewReader(body))
+		require.NoError(t, SignRequest(req, keyID, secret, nonce, at))
+		return req
+	}
+
+	tests := []struct {
+		name     string
+		req      func() *http.Request
+		required bool
+		status   int
+		want     *Identity
+	}{
+		{
+			name:   "no credentials",
+			req:    func() *http.Request { return httptest.NewRequest(http.MethodGet, "/", nil) },
+			status: http.StatusOK,
+		},
+		{
+			name:     "credentials required",
+			req:      func() *http.Request { return httptest.NewRequest(http.MethodGet, "/", nil) },
+			required: true,
+			status:   http.StatusUnauthorized,
+		},
+		{
+			name: "api key",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set(APIKeyHeader, "shop-key")
+				return req
+			},
+			required: true,
+			status:   http.StatusOK,
+			want:     &Identity{Tenant: "shop", KeyID: tenant.HashAPIKey("shop-key")[:8], Method: AuthMethodAPIKey},
+		},
+		{
+			name: "invalid api key",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set(APIKeyHeader, "guess")
+				return req
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:     "signature",
+			req:      func() *http.Request { return signed(http.MethodPost, `{"product_id":"1"}`, "shop-1", "nonce-0000000001", now) },
+			required: true,
+			status:   http.StatusOK,
+			want:     &Identity{Tenant: "shop", KeyID: "shop-1", Method: AuthMethodHMAC},
+		},
+		{
+			name:   "replayed nonce",
+			req:    func() *http.Request { return signed(http.MethodPost, `{"product_id":"1"}`, "shop-1", "nonce-0000000001", now) },
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "timestamp in the past",
+			req:    func() *http.Request { return signed(http.MethodGet, "", "shop-1", "nonce-0000000002", now.Add(-6*time.Minute)) },
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "timestamp in the future",
+			req:    func() *http.Request { return signed(http.MethodGet, "", "shop-1", "nonce-0000000003", now.Add(6*time.Minute)) },
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown key",
+			req:    func() *http.Request { return signed(http.MethodGet, "", "games-1", "nonce-0000000004", now) },
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "short nonce",
+			req:    func() *http.Request { return signed(http.MethodGet, "", "shop-1", "nonce", now) },
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered body",
+			req: func() *http.Request {
+				req := signed(http.MethodPost, `{"product_id":"1"}`, "shop-1", "nonce-0000000005", now)
+				req.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"product_id":"2"}`)).Body
+				return req
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered query",
+			req: func() *http.Request {
+				req := signed(http.MethodGet, "", "shop-1", "nonce-0000000006", now)
+				req.URL.RawQuery = "productID=2"
+				return req
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "missing signature headers",
+			req: func() *http.Request {
+				req := signed(http.MethodGet, "", "shop-1", "nonce-0000000007", now)
+				req.Header.Del(SignatureNonceHeader)
+				return req
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "api key and signature",
+			req: func() *http.Request {
+				req := signed(http.MethodGet, "", "shop-1", "nonce-0000000008", now)
+				req.Header.Set(APIKeyHeader, "shop-key")
+				return req
+			},
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	// nonces are shared between requests to detect replays
+	am := newAuthMiddleware(nil, tenants, 0)
+	am.now = func() time.Time { return now }
+	for _, tt := range tests {
+		am.handler = requireAuth(echo, newTestLogger(), tt.required)
+		rec := httptest.NewRecorder()
+		am.ServeHTTP(rec, tt.req())
+
+		require.Equal(t, tt.status, rec.Code, "%s: %s", tt.name, rec.Body.String())
+		if tt.status != http.StatusOK {
+			res := &ErrorResponse{}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(res), tt.name)
+			require.NotEmpty(t, res.Error, tt.name)
+			continue
+		}
+
+		var got *Identity
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&got), tt.name)
+		require.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	t.Parallel()
+
+	c := newNonceCache()
+	now := time.Unix(1600000000, 0)
+	require.True(t, c.add("a", now, now.Add(time.Minute)))
+	require.False(t, c.add("a", now.Add(time.Minute), now.Add(2*time.Minute)))
+	require.True(t, c.add("a", now.Add(2*time.Minute), now.Add(3*time.Minute)), "expired nonce")
+
+	require.True(t, c.add("b", now.Add(10*time.Minute), now.Add(11*time.Minute)))
+	require.Len(t, c.seen, 1, "expired nonces are purged")
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/notify"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+)
+
+// deliveriesPath merchants webhooks deliveries log route, delivery is addressed by id under it
+const deliveriesPath = "/api/v1/deliveries"
+
+// redeliverSuffix suffix of delivery path to redeliver it
+const redeliverSuffix = "/redeliver"
+
+// deliveries log page size limits
+const (
+	defaultDeliveriesLimit = 100
+	maxDeliveriesLimit     = 1000
+)
+
+// DeliveriesHandler merchants webhooks deliveries log handler
+type DeliveriesHandler struct {
+	l          *logrus.Logger
+	dispatcher *notify.Dispatcher
+}
+
+// DeliveriesResponse deliveries log page
+type DeliveriesResponse struct {
+	Deliveries []*notify.Delivery `json:"deliveries"`
+}
+
+// NewDeliveriesHandler construct deliveries log handler
+func NewDeliveriesHandler(l *logrus.Logger, d *notify.Dispatcher) *DeliveriesHandler {
+	return &DeliveriesHandler{l: l, dispatcher: d}
+}
+
+// List return request tenant deliveries from the newest, filtered by optional status
+func (h *DeliveriesHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusForbidden, "Only GET method supported")
+		return
+	}
+
+	status := notify.DeliveryStatus(r.URL.Query().Get("status"))
+	if status != "" && !status.Valid() {
+		h.writeError(w, http.StatusBadRequest, "unknown delivery status "+string(status))
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeliveriesLimit {
+			h.writeError(w, http.StatusBadRequest, "limit should be from 1 to "+strconv.Itoa(maxDeliveriesLimit))
+			return
+		}
+		limit = n
+	}
+
+	t, _ := tenant.FromContext(r.Context())
+	h.write(w, http.StatusOK, &DeliveriesResponse{Deliveries: h.dispatcher.Deliveries(t.ID, status, limit)})
+}
+
+// Delivery return request tenant delivery by id or redeliver it on POST to its redeliver path
+func (h *DeliveriesHandler) Delivery(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, deliveriesPath+"/")
+	t, _ := tenant.FromContext(r.Context())
+
+	var (
+		dl     *notify.Delivery
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case strings.HasSuffix(id, redeliverSuffix):
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusForbidden, "Only POST method supported")
+			return
+		}
+		dl, err = h.dispatcher.Redeliver(t.ID, strings.TrimSuffix(id, redeliverSuffix))
+		status = http.StatusAccepted
+	case r.Method != http.MethodGet:
+		h.writeError(w, http.StatusForbidden, "Only GET method supported")
+		return
+	default:
+		dl, err = h.dispatcher.Delivery(t.ID, id)
+	}
+
+	switch {
+	case errors.Cause(err) == notify.ErrNotFound:
+		h.writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		h.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if status == http.StatusAccepted {
+		w.Header().Set("Location", deliveriesPath+"/"+dl.ID)
+	}
+	h.write(w, status, dl)
+}
+
+// write write json response with status
+func (h *DeliveriesHandler) write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.l.Error(err.Error())
+	}
+}
+
+// writeError write error response with status
+func (h *DeliveriesHandler) writeError(w http.ResponseWriter, status int, msg string) {
+	h.write(w, status, &ErrorResponse{Error: msg})
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/notify"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+)
+
+func TestRouter_Deliveries(t *testing.T) {
+	t.Parallel()
+
+	merchant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer merchant.Close()
+
+	resolver, err := tenant.NewResolver([]*tenant.Tenant{
+		{
+			ID:        "shop",
+			APIKeys:   []string{tenant.HashAPIKey("shop-key")},
+			Webhooks:  []*notify.Subscription{{ID: "orders", URL: merchant.URL, Secret: "0123456789abcdef0123456789abcdef"}},
+			Providers: providers.NewRegistry(),
+		},
+		{ID: "games", APIKeys: []string{tenant.HashAPIKey("games-key")}, Providers: providers.NewRegistry()},
+	}, "shop")
+	require.NoError(t, err)
+
+	cfg := notify.DefaultConfig()
+	cfg.Retry.MaxAttempts = 1
+	d := notify.NewDispatcher(newTestLogger(), metrics.New(), cfg, resolver.Subscriptions)
+	defer d.Close(context.Background())
+
+	r := newRouter(newTestLogger(), providers.NewRegistry(), NewHealthHandler(newTestLogger(), nil), Options{
+		Catalog:    newTestCatalog(t),
+		Validation: ValidationStrict,
+		Tenants:    resolver,
+		Deliveries: d,
+	})
+
+	do := func(method, url, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set(APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	d.Notify(context.Background(), &session.Session{ID: "pay_1", Tenant: "shop", Status: session.StatusCaptured})
+	res := &DeliveriesResponse{}
+	require.Eventually(t, func() bool {
+		rec := do(http.MethodGet, "/api/v1/deliveries?status=dead", "shop-key")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), res))
+		return len(res.Deliveries) == 1
+	}, time.Second, time.Millisecond)
+	dead := res.Deliveries[0]
+	require.Equal(t, "payment.captured", dead.EventType)
+	require.Equal(t, http.StatusServiceUnavailable, dead.Attempts[0].StatusCode)
+
+	rec := do(http.MethodGet, "/api/v1/deliveries/"+dead.ID, "shop-key")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = do(http.MethodPost, "/api/v1/deliveries/"+dead.ID+"/redeliver", "shop-key")
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	re := &notify.Delivery{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), re))
+	require.Equal(t, dead.ID, re.RedeliveryOf)
+	require.Equal(t, "/api/v1/deliveries/"+re.ID, rec.Header().Get("Location"))
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		key    string
+		status int
+	}{
+		{name: "delivery of other tenant", method: http.MethodGet, url: "/api/v1/deliveries/" + dead.ID, key: "games-key", status: http.StatusNotFound},
+		{name: "redeliver delivery of other tenant", method: http.MethodPost, url: "/api/v1/deliveries/" + dead.ID + "/redeliver", key: "games-key", status: http.StatusNotFound},
+		{name: "unknown status", method: http.MethodGet, url: "/api/v1/deliveries?status=lost", key: "shop-key", status: http.StatusBadRequest},
+		{name: "anonymous list", method: http.MethodGet, url: "/api/v1/deliveries", status: http.StatusUnauthorized},
+		{name: "anonymous delivery", method: http.MethodGet, url: "/api/v1/deliveries/" + dead.ID, status: http.StatusUnauthorized},
+		{name: "anonymous redeliver", method: http.MethodPost, url: "/api/v1/deliveries/" + dead.ID + "/redeliver", status: http.StatusUnauthorized},
+		{name: "get redeliver", method: http.MethodGet, url: "/api/v1/deliveries/" + dead.ID + "/redeliver", key: "shop-key", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := do(tt.method, tt.url, tt.key)
+		require.Equal(t, tt.status, rec.Code, "%s: %s", tt.name, rec.Body.String())
+	}
+
+	rec = do(http.MethodGet, "/api/v1/deliveries", "games-key")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"deliveries":[]}`, rec.Body.String())
+}
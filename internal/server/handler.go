@@ -8,40 +8,129 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/fedoseev-vitaliy/payments/internal/catalog"
 	"github.com/fedoseev-vitaliy/payments/internal/controller"
+	"github.com/fedoseev-vitaliy/payments/internal/fallback"
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
 	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/apay"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/gpay"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
 )
 
+// fallbackNoProviders fallback reason when there are no providers eligible for client platform
+const fallbackNoProviders = "no_providers"
+
+// response types to distinguish payment urls from app store urls fallback
 const (
-	appleAppURL   = "http://apple.store.com/myApp"
-	androidAppURL = "http://google.store.com/myApp"
+	responseTypePaymentURLs = "payment_urls"
+	responseTypeAppURLs     = "app_urls"
 )
 
 type Controller interface {
-	GetPaymentsURL(ctx context.Context, productID string) (*controller.PaymentsURLs, error)
+	GetPaymentsURL(ctx context.Context, req *providers.PaymentRequest, platform providers.Platform) (controller.PaymentsURLs, error)
+	CollectPaymentsURLs(ctx context.Context, req *providers.PaymentRequest, platform providers.Platform) (controller.PaymentsResults, error)
 }
 
 type Handler struct {
-	l *logrus.Logger
-	c Controller
+	l        *logrus.Logger
+	c        Controller
+	partial  bool
+	m        *metrics.Metrics
+	stores   *fallback.Config
+	products *catalog.Catalog
 }
 
+// Response payment urls by provider name.
+// GooglePayURL and ApplePayURL kept for clients which don't support urls yet
 type Response struct {
-	GooglePayURL string `json:"g_url"`
-	ApplePayURL  string `json:"a_url"`
+	// Type is always "payment_urls"
+	Type string `json:"type"`
+	// Platform client platform providers are chosen for. Empty if platform is unknown
+	Platform     string            `json:"platform,omitempty"`
+	GooglePayURL string            `json:"g_url,omitempty"`
+	ApplePayURL  string            `json:"a_url,omitempty"`
+	URLs         map[string]string `json:"urls"`
+	// Errors failed providers details. Returned in partial responses mode only
+	Errors map[string]ProviderErrorResponse `json:"errors,omitempty"`
 }
 
+// AppURLResponse app store urls returned when providers failed
 type AppURLResponse struct {
-	AppleAppURL  string `json:"apple_url"`
-	GoogleAppURL string `json:"google_url"`
+	// Type is always "app_urls"
+	Type string `json:"type"`
+	// Platform client platform. Only store url relevant for platform is returned
+	Platform     string `json:"platform,omitempty"`
+	AppleAppURL  string `json:"apple_url,omitempty"`
+	GoogleAppURL string `json:"google_url,omitempty"`
+	// Errors failed providers details. Returned in partial responses mode only
+	Errors map[string]ProviderErrorResponse `json:"errors,omitempty"`
+}
+
+// ProviderErrorResponse provider failure details
+type ProviderErrorResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
-func NewHandler(l *logrus.Logger, c Controller) *Handler {
-	return &Handler{l: l, c: c}
+// paymentsRequest payments urls request parameters
+type paymentsRequest struct {
+	payment  *providers.PaymentRequest
+	platform providers.Platform
+	// stores app store urls of requested app and locale to fallback to
+	stores fallback.URLs
+}
+
+// newAppURLResponse construct app store urls response with store urls relevant for platform
+func newAppURLResponse(pr *paymentsRequest, errs map[string]ProviderErrorResponse) *AppURLResponse {
+	res := &AppURLResponse{
+		Type:     responseTypeAppURLs,
+		Platform: string(pr.platform),
+		Errors:   errs,
+	}
+	if pr.platform != providers.PlatformAndroid {
+		res.AppleAppURL = pr.stores.AppleURL
+	}
+	if pr.platform != providers.PlatformIOS {
+		res.GoogleAppURL = pr.stores.GoogleURL
+	}
+	return res
+}
+
+// NewHandler construct payments handler of catalog products.
+// In partial mode urls of succeeded providers are returned even if other providers failed.
+// Store urls are returned when providers failed.
+// Request tenant partial responses feature and store urls take precedence over handler ones
+func NewHandler(l *logrus.Logger, c Controller, partial bool, m *metrics.Metrics, stores *fallback.Config, products *catalog.Catalog) *Handler {
+	return &Handler{l: l, c: c, partial: partial, m: m, stores: stores, products: products}
+}
+
+// partialResponses check that partial responses are enabled for request tenant
+func (h *Handler) partialResponses(r *http.Request) bool {
+	if t, ok := tenant.FromContext(r.Context()); ok {
+		return t.Enabled(tenant.FeaturePartialResponses)
+	}
+	return h.partial
+}
+
+// storeURLs return store urls of app and locale requested by app and locale query params.
+// Accept-Language header is used if locale isn't set
+func (h *Handler) storeURLs(r *http.Request) (fallback.URLs, error) {
+	q := r.URL.Query()
+	locales := fallback.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if l := q.Get("locale"); l != "" {
+		locales = append([]string{l}, locales...)
+	}
+
+	stores := h.stores
+	if t, ok := tenant.FromContext(r.Context()); ok && t.StoreURLs != nil {
+		stores = t.StoreURLs
+	}
+	return stores.Lookup(q.Get("app"), locales)
 }
 
 func (h *Handler) GetPaymentsURLs(w http.ResponseWriter, r *http.Request) {
@@ -57,9 +146,7 @@ func (h *Handler) GetPaymentsURLs(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	pid := r.URL.Query().Get("productID")
-	// this stuff for testing purpose
-	switch pid {
-	case "":
+	if pid == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode(&ErrorResponse{
 			Error: "orderID query params is missing",
@@ -67,49 +154,153 @@ func (h *Handler) GetPaymentsURLs(w http.ResponseWriter, r *http.Request) {
 			h.l.Error(err.Error())
 		}
 		return
-	case "panic":
-		panic("panic test")
-	case "fatal":
-		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	product, err := h.products.Product(pid)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
 		if err := json.NewEncoder(w).Encode(&ErrorResponse{
-			Error: "test 500 error",
+			Error: err.Error(),
+		}); err != nil {
+			h.l.Error(err.Error())
+		}
+		return
+	}
+
+	platform, err := requestPlatform(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(&ErrorResponse{
+			Error: err.Error(),
+		}); err != nil {
+			h.l.Error(err.Error())
+		}
+		return
+	}
+
+	stores, err := h.storeURLs(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(&ErrorResponse{
+			Error: err.Error(),
 		}); err != nil {
 			h.l.Error(err.Error())
 		}
 		return
-	default:
 	}
 
-	pus, err := h.c.GetPaymentsURL(r.Context(), pid)
+	pr := &paymentsRequest{payment: product.PaymentRequest(), platform: platform, stores: stores}
+	if h.partialResponses(r) {
+		h.writePartialPaymentsURLs(w, r, pr)
+		return
+	}
+
+	pus, err := h.c.GetPaymentsURL(r.Context(), pr.payment, platform)
 	switch errors.Cause(err) {
 	case nil:
 		if err := json.NewEncoder(w).Encode(&Response{
-			ApplePayURL:  pus.APayURL,
-			GooglePayURL: pus.GPayURL,
+			Type:         responseTypePaymentURLs,
+			Platform:     string(platform),
+			ApplePayURL:  pus[apay.Name],
+			GooglePayURL: pus[gpay.Name],
+			URLs:         pus,
 		}); err != nil {
 			h.l.Error(err.Error())
 		}
 		return
 	case providers.ErrInternalProvider:
-		if err := json.NewEncoder(w).Encode(&AppURLResponse{
-			AppleAppURL:  appleAppURL,
-			GoogleAppURL: androidAppURL,
+		h.m.Fallbacks.Inc(providers.ErrorClass(err))
+		if err := json.NewEncoder(w).Encode(newAppURLResponse(pr, nil)); err != nil {
+			h.l.Error(err.Error())
+		}
+		return
+	case providers.ErrNotOK, providers.ErrCircuitOpen, providers.ErrRateLimited:
+		h.m.Fallbacks.Inc(providers.ErrorClass(err))
+		if err := json.NewEncoder(w).Encode(newAppURLResponse(pr, nil)); err != nil {
+			h.l.Error(err.Error())
+		}
+		return
+	case controller.ErrNoProviders:
+		h.m.Fallbacks.Inc(fallbackNoProviders)
+		if err := json.NewEncoder(w).Encode(newAppURLResponse(pr, nil)); err != nil {
+			h.l.Error(err.Error())
+		}
+		return
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(&ErrorResponse{
+			Error: err.Error(),
 		}); err != nil {
 			h.l.Error(err.Error())
 		}
+	}
+}
+
+// writePartialPaymentsURLs write urls of succeeded providers along with failed providers details.
+// Fallback to app urls only when every provider failed
+func (h *Handler) writePartialPaymentsURLs(w http.ResponseWriter, r *http.Request, pr *paymentsRequest) {
+	res, err := h.c.CollectPaymentsURLs(r.Context(), pr.payment, pr.platform)
+	if errors.Cause(err) == controller.ErrNoProviders {
+		h.m.Fallbacks.Inc(fallbackNoProviders)
+		if err := json.NewEncoder(w).Encode(newAppURLResponse(pr, nil)); err != nil {
+			h.l.Error(err.Error())
+		}
 		return
-	case providers.ErrNotOK:
-		if err := json.NewEncoder(w).Encode(&AppURLResponse{
-			AppleAppURL:  appleAppURL,
-			GoogleAppURL: androidAppURL,
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		if err := json.NewEncoder(w).Encode(&ErrorResponse{
+			Error: err.Error(),
 		}); err != nil {
 			h.l.Error(err.Error())
 		}
 		return
+	}
+
+	pus := res.URLs()
+	perrs := make(map[string]ProviderErrorResponse)
+	var (
+		unknownErr error
+		reason     string
+	)
+	for name, err := range res.Errors() {
+		status := providers.ErrorClass(err)
+		if status == providers.ClassUnknownError && unknownErr == nil {
+			unknownErr = err
+		}
+		perrs[name] = ProviderErrorResponse{Status: status, Error: err.Error()}
+
+		// fallback reason is failed providers error class if all of them failed the same way
+		switch reason {
+		case "":
+			reason = status
+		case status:
+		default:
+			reason = "mixed"
+		}
+	}
+
+	switch {
+	case len(pus) != 0:
+		if err := json.NewEncoder(w).Encode(&Response{
+			Type:         responseTypePaymentURLs,
+			Platform:     string(pr.platform),
+			ApplePayURL:  pus[apay.Name],
+			GooglePayURL: pus[gpay.Name],
+			URLs:         pus,
+			Errors:       perrs,
+		}); err != nil {
+			h.l.Error(err.Error())
+		}
+	case unknownErr == nil:
+		h.m.Fallbacks.Inc(reason)
+		if err := json.NewEncoder(w).Encode(newAppURLResponse(pr, perrs)); err != nil {
+			h.l.Error(err.Error())
+		}
 	default:
 		w.WriteHeader(http.StatusInternalServerError)
 		if err := json.NewEncoder(w).Encode(&ErrorResponse{
-			Error: err.Error(),
+			Error: unknownErr.Error(),
 		}); err != nil {
 			h.l.Error(err.Error())
 		}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/catalog"
+	"github.com/fedoseev-vitaliy/payments/internal/controller"
+	"github.com/fedoseev-vitaliy/payments/internal/fallback"
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+// newTestCatalog construct catalog of products 1, 2 and 3 and unavailable product 4
+func newTestCatalog(t *testing.T) *catalog.Catalog {
+	c, err := catalog.New([]*catalog.Product{
+		{ID: "1", Title: "Coins", Price: 999, Currency: "USD", Available: true},
+		{ID: "2", Title: "Gems", Price: 1999, Currency: "USD", Available: true},
+		{ID: "3", Title: "Lifetime license", Price: 4999, Currency: "EUR", Available: true},
+		{ID: "4", Title: "Retired pack", Price: 99, Currency: "USD"},
+	})
+	require.NoError(t, err)
+	return c
+}
+
+// productPayment return mock argument matching payment requests of product
+func productPayment(productID string) interface{} {
+	return mock.MatchedBy(func(req *providers.PaymentRequest) bool {
+		return req.ProductID == productID
+	})
+}
+
+func TestHandler_GetPaymentsURLsStoreURLs(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	pMock.On("GetPayURL", mock.Anything, mock.Anything).Return("", errors.Wrap(providers.ErrNotOK, "bad product"))
+
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", pMock))
+	stores := &fallback.Config{
+		DefaultApp: "shop",
+		Apps: map[string]*fallback.App{
+			"shop": {
+				URLs:    fallback.URLs{AppleURL: "https://apps.apple.com/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop"},
+				Locales: map[string]fallback.URLs{"de": {AppleURL: "https://apps.apple.com/de/app/id1"}},
+			},
+			"games": {URLs: fallback.URLs{AppleURL: "https://apps.apple.com/app/id2"}},
+		},
+	}
+
+	for _, partial := range []bool{false, true} {
+		h := NewHandler(newTestLogger(), controller.New(reg), partial, metrics.New(), stores, newTestCatalog(t))
+
+		tests := []struct {
+			name   string
+			url    string
+			lang   string
+			status int
+			want   fallback.URLs
+		}{
+			{
+				name:   "default app",
+				url:    "/api/v1/payments/urls?productID=1",
+				status: http.StatusOK,
+				want:   fallback.URLs{AppleURL: "https://apps.apple.com/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop"},
+			},
+			{
+				name:   "app",
+				url:    "/api/v1/payments/urls?productID=1&app=games",
+				lang:   "de",
+				status: http.StatusOK,
+				want:   fallback.URLs{AppleURL: "https://apps.apple.com/app/id2"},
+			},
+			{
+				name:   "accept language",
+				url:    "/api/v1/payments/urls?productID=1",
+				lang:   "fr;q=0.5, de-DE",
+				status: http.StatusOK,
+				want:   fallback.URLs{AppleURL: "https://apps.apple.com/de/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop"},
+			},
+			{
+				name:   "locale param",
+				url:    "/api/v1/payments/urls?productID=1&locale=de",
+				lang:   "fr",
+				status: http.StatusOK,
+				want:   fallback.URLs{AppleURL: "https://apps.apple.com/de/app/id1", GoogleURL: "https://play.google.com/store/apps/details?id=shop"},
+			},
+			{
+				name:   "unknown app",
+				url:    "/api/v1/payments/urls?productID=1&app=unknown",
+				status: http.StatusBadRequest,
+			},
+		}
+		for _, tt := range tests {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.Header.Set("Accept-Language", tt.lang)
+			rec := httptest.NewRecorder()
+			h.GetPaymentsURLs(rec, req)
+
+			require.Equal(t, tt.status, rec.Code, tt.name)
+			if tt.status != http.StatusOK {
+				continue
+			}
+
+			res := &AppURLResponse{}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(res), tt.name)
+			require.Equal(t, tt.want, fallback.URLs{AppleURL: res.AppleAppURL, GoogleURL: res.GoogleAppURL}, tt.name)
+		}
+	}
+}
+
+func TestHandler_GetPaymentsURLsPartial(t *testing.T) {
+	t.Parallel()
+
+	internal := errors.Wrap(providers.ErrInternalProvider, "googlePay status code:502")
+	rejected := errors.Wrap(providers.ErrNotOK, "applePay status code:404")
+	open := errors.WithStack(providers.ErrCircuitOpen)
+	unknown := errors.New("unexpected EOF")
+	stores := fallback.DefaultConfig()
+
+	type result struct {
+		url string
+		err error
+	}
+	tests := []struct {
+		name       string
+		apay, gpay result
+		status     int
+		want       interface{}
+	}{
+		{
+			name:   "one provider failed",
+			apay:   result{url: "http://apple.pay.com/payfor?product=1"},
+			gpay:   result{err: internal},
+			status: http.StatusOK,
+			want: &Response{
+				Type:        responseTypePaymentURLs,
+				ApplePayURL: "http://apple.pay.com/payfor?product=1",
+				URLs:        map[string]string{"apay": "http://apple.pay.com/payfor?product=1"},
+				Errors:      map[string]ProviderErrorResponse{"gpay": {Status: providers.ClassInternalError, Error: internal.Error()}},
+			},
+		},
+		{
+			name:   "all providers failed",
+			apay:   result{err: rejected},
+			gpay:   result{err: open},
+			status: http.StatusOK,
+			want: &AppURLResponse{
+				Type:         responseTypeAppURLs,
+				AppleAppURL:  fallback.DefaultAppleURL,
+				GoogleAppURL: fallback.DefaultGoogleURL,
+				Errors: map[string]ProviderErrorResponse{
+					"apay": {Status: providers.ClassNotOK, Error: rejected.Error()},
+					"gpay": {Status: providers.ClassCircuitOpen, Error: open.Error()},
+				},
+			},
+		},
+		{
+			name:   "all providers failed with unknown error",
+			apay:   result{err: rejected},
+			gpay:   result{err: unknown},
+			status: http.StatusInternalServerError,
+			want:   &ErrorResponse{Error: unknown.Error()},
+		},
+	}
+	for _, tt := range tests {
+		aMock, gMock := &mocks.Provider{}, &mocks.Provider{}
+		aMock.On("GetPayURL", mock.Anything, productPayment("1")).Return(tt.apay.url, tt.apay.err).Once()
+		gMock.On("GetPayURL", mock.Anything, productPayment("1")).Return(tt.gpay.url, tt.gpay.err).Once()
+		reg := providers.NewRegistry()
+		require.NoError(t, reg.Register("apay", aMock))
+		require.NoError(t, reg.Register("gpay", gMock))
+		h := NewHandler(newTestLogger(), controller.New(reg), true, metrics.New(), &stores, newTestCatalog(t))
+
+		rec := httptest.NewRecorder()
+		h.GetPaymentsURLs(rec, httptest.NewRequest(http.MethodGet, "/api/v1/payments/urls?productID=1", nil))
+		require.Equal(t, tt.status, rec.Code, tt.name)
+
+		want, err := json.Marshal(tt.want)
+		require.NoError(t, err)
+		require.JSONEq(t, string(want), rec.Body.String(), tt.name)
+		mock.AssertExpectationsForObjects(t, aMock, gMock)
+	}
+}
+
+func TestHandler_GetPaymentsURLsProduct(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	pMock.On("GetPayURL", mock.Anything, &providers.PaymentRequest{
+		ProductID:   "3",
+		Price:       money.New(4999, money.EUR),
+		Description: "Lifetime license",
+	}).Return("http://apple.pay.com/payfor?product=3", nil).Once()
+
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", pMock))
+	stores := fallback.DefaultConfig()
+	h := NewHandler(newTestLogger(), controller.New(reg), false, metrics.New(), &stores, newTestCatalog(t))
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		want   string
+	}{
+		{
+			name:   "catalog product price",
+			url:    "/api/v1/payments/urls?productID=3",
+			status: http.StatusOK,
+			want:   `{"type":"payment_urls","a_url":"http://apple.pay.com/payfor?product=3","urls":{"apay":"http://apple.pay.com/payfor?product=3"}}`,
+		},
+		{
+			name:   "unknown product",
+			url:    "/api/v1/payments/urls?productID=404",
+			status: http.StatusNotFound,
+			want:   `{"error":"product 404: product not found"}`,
+		},
+		{
+			name:   "unavailable product",
+			url:    "/api/v1/payments/urls?productID=4",
+			status: http.StatusNotFound,
+			want:   `{"error":"product 4: product is unavailable"}`,
+		},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.GetPaymentsURLs(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+		require.Equal(t, tt.status, rec.Code, tt.name)
+		require.JSONEq(t, tt.want, rec.Body.String(), tt.name)
+	}
+
+	mock.AssertExpectationsForObjects(t, pMock)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers/breaker"
+)
+
+// health checks statuses
+const (
+	healthStatusOK       = "ok"
+	healthStatusNotReady = "not_ready"
+	healthStatusStarting = "starting"
+	healthStatusDraining = "draining"
+)
+
+// HealthResponse health check response
+type HealthResponse struct {
+	Status string `json:"status"`
+	// Checks readiness checks results. Providers checks contain circuit breaker state
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthHandler liveness and readiness probes handler
+type HealthHandler struct {
+	l        *logrus.Logger
+	breakers []*breaker.Breaker
+
+	serving  int32
+	draining int32
+}
+
+// NewHealthHandler construct health handler
+func NewHealthHandler(l *logrus.Logger, breakers []*breaker.Breaker) *HealthHandler {
+	return &HealthHandler{l: l, breakers: breakers}
+}
+
+// Serving mark server as accepting connections
+func (hh *HealthHandler) Serving() {
+	atomic.StoreInt32(&hh.serving, 1)
+}
+
+// Drain mark server as shutting down so it isn't ready to receive traffic anymore
+func (hh *HealthHandler) Drain() {
+	atomic.StoreInt32(&hh.draining, 1)
+}
+
+// Healthz liveness probe. Always OK while process is able to handle requests
+func (hh *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&HealthResponse{Status: healthStatusOK}); err != nil {
+		hh.l.Error(err.Error())
+	}
+}
+
+// Readyz readiness probe. Server is ready if it accepts connections, isn't shutting down
+// and at least one provider circuit breaker isn't open.
+// Providers which are down separately are handled by app store urls fallback
+func (hh *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	res := &HealthResponse{
+		Status: healthStatusOK,
+		Checks: make(map[string]string, len(hh.breakers)+1),
+	}
+
+	switch {
+	case atomic.LoadInt32(&hh.draining) == 1:
+		res.Checks["server"] = healthStatusDraining
+		res.Status = healthStatusNotReady
+	case atomic.LoadInt32(&hh.serving) == 0:
+		res.Checks["server"] = healthStatusStarting
+		res.Status = healthStatusNotReady
+	default:
+		res.Checks["server"] = healthStatusOK
+	}
+
+	open := 0
+	for _, b := range hh.breakers {
+		s := b.State()
+		if s == breaker.StateOpen {
+			open++
+		}
+		res.Checks[b.Name()] = s.String()
+	}
+	if len(hh.breakers) != 0 && open == len(hh.breakers) {
+		res.Status = healthStatusNotReady
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if res.Status != healthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		hh.l.Error(err.Error())
+	}
+}
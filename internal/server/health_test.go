@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/breaker"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+func newTestLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	return l
+}
+
+func readyz(t *testing.T, hh *HealthHandler) (int, *HealthResponse) {
+	rec := httptest.NewRecorder()
+	hh.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	res := &HealthResponse{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(res))
+	return rec.Code, res
+}
+
+func TestHealthHandler_Readyz(t *testing.T) {
+	t.Parallel()
+
+	l := newTestLogger()
+	cfg := breaker.Config{FailureRate: 1, WindowSize: 1, MinRequests: 1, OpenTimeout: utils.Duration(time.Hour)}
+	aMock := &mocks.Provider{}
+	gMock := &mocks.Provider{}
+	ab := breaker.New("apay", aMock, cfg, l)
+	gb := breaker.New("gpay", gMock, cfg, l)
+
+	hh := NewHealthHandler(l, []*breaker.Breaker{ab, gb})
+
+	code, res := readyz(t, hh)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, healthStatusStarting, res.Checks["server"])
+
+	hh.Serving()
+	code, res = readyz(t, hh)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, &HealthResponse{
+		Status: healthStatusOK,
+		Checks: map[string]string{"server": "ok", "apay": "closed", "gpay": "closed"},
+	}, res)
+
+	// one provider down is handled by fallback
+	aMock.On("GetPayURL", mock.Anything, productPayment("p")).Return("", errors.New("boom")).Once()
+	_, _ = ab.GetPayURL(context.Background(), &providers.PaymentRequest{ProductID: "p"})
+	code, res = readyz(t, hh)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "open", res.Checks["apay"])
+
+	// all providers down
+	gMock.On("GetPayURL", mock.Anything, productPayment("p")).Return("", errors.New("boom")).Once()
+	_, _ = gb.GetPayURL(context.Background(), &providers.PaymentRequest{ProductID: "p"})
+	code, res = readyz(t, hh)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, healthStatusNotReady, res.Status)
+
+	t.Run("draining", func(t *testing.T) {
+		hh := NewHealthHandler(l, nil)
+		hh.Serving()
+		hh.Drain()
+
+		code, res := readyz(t, hh)
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, healthStatusDraining, res.Checks["server"])
+
+		rec := httptest.NewRecorder()
+		hh.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	mock.AssertExpectationsForObjects(t, aMock, gMock)
+}
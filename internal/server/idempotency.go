@@ -0,0 +1,213 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/idempotency"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// IdempotencyKeyHeader header of client generated key making retries of state-changing requests safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotentReplayedHeader header set on replayed responses
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLen max length of idempotency key
+const maxIdempotencyKeyLen = 255
+
+// idempotencyGuard executes state-changing requests with the same idempotency key once.
+// Keys are scoped by tenant and client credentials, see scopeKey
+type idempotencyGuard struct {
+	l     *logrus.Logger
+	store idempotency.Store
+}
+
+// newIdempotencyGuard construct guard keeping responses in store
+func newIdempotencyGuard(l *logrus.Logger, store idempotency.Store) *idempotencyGuard {
+	return &idempotencyGuard{l: l, store: store}
+}
+
+// guard wrap handler to store the first response of non-GET request with idempotency key and replay it on retries.
+// Reuse of key with different request is rejected with UnprocessableEntity,
+// retry of request which is still in flight is rejected with Conflict.
+// Server errors and responses marked by notFinal aren't stored, so retry executes request again
+func (g *idempotencyGuard) guard(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			h(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			g.writeError(w, http.StatusBadRequest, "idempotency key is too long")
+			return
+		}
+
+		body, err := readBody(r)
+		if err != nil {
+			g.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx := r.Context()
+		log := utils.Logger(ctx).WithField("idempotency_key", key)
+		skey := scopeKey(r) + "|" + key
+
+		fp := fingerprint(r, body)
+		rec, ok, err := g.store.Reserve(ctx, skey, fp)
+		if err != nil {
+			log.WithError(err).Error("failed to reserve idempotency key")
+			g.writeError(w, http.StatusInternalServerError, "failed to reserve idempotency key")
+			return
+		}
+		if !ok {
+			switch {
+			case rec.Fingerprint != fp:
+				g.writeError(w, http.StatusUnprocessableEntity, "idempotency key is already used with different request")
+			case rec.Response == nil:
+				g.writeError(w, http.StatusConflict, "request with the same idempotency key is in progress")
+			default:
+				log.Info("idempotent response replayed")
+				replay(w, rec.Response)
+			}
+			return
+		}
+
+		completed := false
+		defer func() {
+			// handler panicked or response isn't final, let client retry request
+			if !completed {
+				if err := g.store.Release(ctx, skey); err != nil {
+					log.WithError(err).Error("failed to release idempotency key")
+				}
+			}
+		}()
+
+		rw := newRecordingResponse(w)
+		h(rw, r)
+		if res := rw.response(); res.Status < http.StatusInternalServerError && !rw.notFinal {
+			if err := g.store.Complete(ctx, skey, res); err != nil {
+				log.WithError(err).Error("failed to store idempotent response")
+			}
+			completed = true
+		}
+	}
+}
+
+// scopeKey return scope of request idempotency keys. Authenticated requests are scoped by tenant and credentials,
+// anonymous ones by tenant only, so retries from changed client ip are still recognized
+func scopeKey(r *http.Request) string {
+	tenantID := ""
+	if t, ok := tenant.FromContext(r.Context()); ok {
+		tenantID = t.ID
+	}
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		return tenantID + "|key:" + id.Tenant + "/" + id.KeyID
+	}
+	return tenantID + "|anonymous"
+}
+
+// notFinal mark response of guarded handler as not final outcome of request, e.g. pending operation,
+// so it isn't replayed and retry with the same idempotency key executes request again
+func notFinal(w http.ResponseWriter) {
+	if rw, ok := w.(*recordingResponse); ok {
+		rw.notFinal = true
+	}
+}
+
+// writeError write error response with status
+func (g *idempotencyGuard) writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&ErrorResponse{
+		Error: msg,
+	}); err != nil {
+		g.l.Error(err.Error())
+	}
+}
+
+// fingerprint return hash of request method, url and body
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	_, _ = hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replay write stored response
+func replay(w http.ResponseWriter, res *idempotency.Response) {
+	for k, v := range res.Header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(res.Status)
+	_, _ = w.Write(res.Body)
+}
+
+// recordingResponse writes response through and records status, body and headers set by handler.
+// Headers set before handler, e.g. rate limit ones, aren't recorded
+type recordingResponse struct {
+	http.ResponseWriter
+
+	before   http.Header
+	status   int
+	header   http.Header
+	body     []byte
+	notFinal bool
+}
+
+// newRecordingResponse construct recorder of response written to w
+func newRecordingResponse(w http.ResponseWriter) *recordingResponse {
+	return &recordingResponse{ResponseWriter: w, before: w.Header().Clone()}
+}
+
+// WriteHeader record status and headers set by handler
+func (rw *recordingResponse) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+		rw.header = make(http.Header)
+		for k, v := range rw.Header() {
+			if !equalValues(rw.before[k], v) {
+				rw.header[k] = append([]string(nil), v...)
+			}
+		}
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write record body
+func (rw *recordingResponse) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.body = append(rw.body, b...)
+	return rw.ResponseWriter.Write(b)
+}
+
+// response return recorded response
+func (rw *recordingResponse) response() *idempotency.Response {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return &idempotency.Response{Status: rw.status, Header: rw.header, Body: rw.body}
+}
+
+// equalValues check that header values are equal
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
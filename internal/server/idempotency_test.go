@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/idempotency"
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+)
+
+func TestRouter_Idempotency(t *testing.T) {
+	t.Parallel()
+
+	apayMock := &mocks.Provider{}
+	apayMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com?product=1", nil).Twice()
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", apayMock))
+
+	resolver, err := tenant.NewResolver([]*tenant.Tenant{
+		{ID: "shop", APIKeys: []string{tenant.HashAPIKey("shop-key"), tenant.HashAPIKey("shop-key-2")}, Providers: reg},
+	}, "")
+	require.NoError(t, err)
+
+	r := newRouter(newTestLogger(), providers.NewRegistry(), NewHealthHandler(newTestLogger(), nil), Options{
+		Catalog:    newTestCatalog(t),
+		Validation: ValidationStrict,
+		Tenants:    resolver,
+	})
+
+	do := func(key, idempotencyKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payments", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(APIKeyHeader, key)
+		req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	body := `{"product_id":"1","amount":999,"currency":"USD","provider":"apay"}`
+
+	first := do("shop-key", "k1", body)
+	require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+	require.Empty(t, first.Header().Get(idempotentReplayedHeader))
+	created := &session.Session{}
+	require.NoError(t, json.Unmarshal(first.Body.Bytes(), created))
+
+	retry := do("shop-key", "k1", body)
+	require.Equal(t, http.StatusCreated, retry.Code, retry.Body.String())
+	require.Equal(t, "true", retry.Header().Get(idempotentReplayedHeader))
+	require.Equal(t, first.Header().Get("Location"), retry.Header().Get("Location"))
+	require.Equal(t, first.Body.String(), retry.Body.String(), "session isn't created twice")
+
+	rec := do("shop-key", "k1", `{"product_id":"1","amount":1999,"currency":"USD","provider":"apay"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code, rec.Body.String())
+
+	rec = do("shop-key-2", "k1", body)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	other := &session.Session{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), other))
+	require.NotEqual(t, created.ID, other.ID, "keys are scoped by client")
+
+	rec = do("shop-key", strings.Repeat("k", maxIdempotencyKeyLen+1), body)
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+
+	apayMock.AssertExpectations(t)
+}
+
+func TestIdempotencyGuard(t *testing.T) {
+	t.Parallel()
+
+	g := newIdempotencyGuard(newTestLogger(), idempotency.NewMemoryStore(0))
+	calls := 0
+	do := func(h http.HandlerFunc, key string) *httptest.ResponseRecorder {
+		calls++
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payments", strings.NewReader("{}"))
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", calls)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		g.guard(h)(rec, req)
+		return rec
+	}
+
+	var inner *httptest.ResponseRecorder
+	rec := do(func(w http.ResponseWriter, r *http.Request) {
+		inner = do(func(http.ResponseWriter, *http.Request) {
+			t.Error("in-flight request is executed again")
+		}, "k1")
+		w.WriteHeader(http.StatusAccepted)
+	}, "k1")
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, http.StatusConflict, inner.Code, inner.Body.String())
+
+	// server errors and pending responses aren't final
+	for _, status := range []int{http.StatusAccepted, http.StatusBadGateway} {
+		executed := 0
+		for i := 0; i < 2; i++ {
+			rec = do(func(w http.ResponseWriter, r *http.Request) {
+				executed++
+				if status == http.StatusAccepted {
+					notFinal(w)
+				}
+				w.WriteHeader(status)
+			}, "k"+strconv.Itoa(status))
+			require.Equal(t, status, rec.Code)
+			require.Empty(t, rec.Header().Get(idempotentReplayedHeader))
+		}
+		require.Equal(t, 2, executed, status)
+	}
+
+	require.Panics(t, func() {
+		do(func(http.ResponseWriter, *http.Request) { panic("boom") }, "k2")
+	})
+	executed := false
+	rec = do(func(w http.ResponseWriter, r *http.Request) { executed = true }, "k2")
+	require.True(t, executed, "key of panicked request is released")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = do(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "1")
+		_, _ = w.Write([]byte("ok"))
+	}, "k3")
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = do(func(http.ResponseWriter, *http.Request) {
+		t.Error("completed request is executed again")
+	}, "k3")
+	require.Equal(t, "1", rec.Header().Get("X-Test"))
+	require.Equal(t, "ok", rec.Body.String())
+	require.Equal(t, "true", rec.Header().Get(idempotentReplayedHeader), "anonymous retry from another ip is replayed")
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,30 +10,117 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
 )
 
 // loggerMiddleware is a middleware handler that does request logging
 type loggerMiddleware struct {
 	handler http.Handler
-	logger  *logrus.Logger
 }
 
 // ServeHTTP handles the request by passing it to the real
-// handler and logging the request details
+// handler and logging the request details with request scoped logger
 func (lm *loggerMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
-	lm.handler.ServeHTTP(w, r)
-	lm.logger.Infof("%s %s %v", r.Method, r.URL.Path, time.Since(start))
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		status := rec.status
+		// panic is recovered by outer middleware with InternalServer error
+		p := recover()
+		if p != nil {
+			status = http.StatusInternalServerError
+		}
+
+		entry := utils.Logger(r.Context()).WithFields(logrus.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      status,
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"remote_addr": r.RemoteAddr,
+		})
+		if pid := r.URL.Query().Get("productID"); pid != "" {
+			entry = entry.WithField("product_id", pid)
+		}
+
+		if status >= http.StatusInternalServerError {
+			entry.Error("request handled")
+		} else {
+			entry.Info("request handled")
+		}
+
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	lm.handler.ServeHTTP(rec, r)
 }
 
 // newLoggerMiddleware constructs a new Logger middleware handler
-func newLoggerMiddleware(h http.Handler, l *logrus.Logger) *loggerMiddleware {
-	return &loggerMiddleware{
+func newLoggerMiddleware(h http.Handler) *loggerMiddleware {
+	return &loggerMiddleware{handler: h}
+}
+
+// requestIDMiddleware is a middleware handler that accepts or generates request id
+// and puts it with request scoped logger to request context
+type requestIDMiddleware struct {
+	handler http.Handler
+	logger  *logrus.Logger
+}
+
+// ServeHTTP handles the request passing request id in context and echoing it in response headers
+func (rm *requestIDMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(utils.RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+
+	w.Header().Set(utils.RequestIDHeader, id)
+	ctx := utils.WithRequestID(r.Context(), id)
+	ctx = utils.WithLogger(ctx, rm.logger.WithField("request_id", id))
+
+	rm.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// newRequestIDMiddleware constructs a new requestIDMiddleware middleware handler
+func newRequestIDMiddleware(h http.Handler, l *logrus.Logger) *requestIDMiddleware {
+	return &requestIDMiddleware{
 		handler: h,
 		logger:  l,
 	}
 }
 
+// maxRequestIDLen max accepted request id length
+const maxRequestIDLen = 128
+
+// validRequestID check that client request id is safe to log and forward
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generate random request id
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
 // timerResponseMiddleware is a middleware response write to add 'X-Response-Time' to server response headers
 type timerResponseMiddleware struct {
 	http.ResponseWriter
@@ -89,7 +178,7 @@ func (pcm *panicRecoveryMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Req
 	defer func() {
 		err := recover()
 		if err != nil {
-			pcm.logger.Errorf("panic recovery:%v", err)
+			utils.Logger(r.Context()).Errorf("panic recovery:%v", err)
 
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusInternalServerError)
@@ -111,3 +200,94 @@ func newPanicRecoveryMiddleware(h http.Handler, l *logrus.Logger) *panicRecovery
 		logger:  l,
 	}
 }
+
+// statusRecorder is a middleware response writer to remember response status code
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status int
+	ok     bool
+}
+
+// WriteHeader remember status code
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if !sr.ok {
+		sr.status = statusCode
+		sr.ok = true
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write write response remembering implicit OK status code
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if !sr.ok {
+		sr.status = http.StatusOK
+		sr.ok = true
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// knownMethods http methods used as metrics labels, other methods are reported as "other"
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// metricsMiddleware is a middleware handler that collects requests metrics by route
+type metricsMiddleware struct {
+	handler http.Handler
+	mux     *http.ServeMux
+	metrics *metrics.Metrics
+}
+
+// ServeHTTP handles the request by passing it to the real
+// handler and collecting requests count, latency and in-flight requests
+func (mm *metricsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, route := mm.mux.Handler(r)
+	if route == "" {
+		route = "unmatched"
+	}
+
+	method := r.Method
+	if !knownMethods[method] {
+		method = "other"
+	}
+
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	mm.metrics.HTTPInFlight.Inc()
+	defer func() {
+		mm.metrics.HTTPInFlight.Dec()
+
+		status := rec.status
+		// panic is recovered by outer middleware with InternalServer error
+		p := recover()
+		if p != nil {
+			status = http.StatusInternalServerError
+		}
+
+		mm.metrics.HTTPRequests.Inc(route, method, strconv.Itoa(status))
+		mm.metrics.HTTPDuration.Observe(time.Since(start).Seconds(), route, method)
+
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	mm.handler.ServeHTTP(rec, r)
+}
+
+// newMetricsMiddleware constructs a new metricsMiddleware middleware handler.
+// Routes are resolved by mux patterns to keep metrics cardinality low
+func newMetricsMiddleware(h http.Handler, mux *http.ServeMux, m *metrics.Metrics) *metricsMiddleware {
+	return &metricsMiddleware{
+		handler: h,
+		mux:     mux,
+		metrics: m,
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var ctxID string
+	h := newRequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctxID = utils.RequestID(r.Context())
+		utils.Logger(r.Context()).Info("handled")
+	}), newTestLogger())
+
+	tests := []struct {
+		name     string
+		id       string
+		generate bool
+	}{
+		{name: "client id accepted", id: "f3b2c1d0-req:1"},
+		{name: "missing id generated", id: "", generate: true},
+		{name: "too long id replaced", id: strings.Repeat("a", maxRequestIDLen+1), generate: true},
+		{name: "unsafe id replaced", id: "id\nwith newline", generate: true},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/payments/urls", nil)
+		req.Header.Set(utils.RequestIDHeader, tt.id)
+
+		h.ServeHTTP(rec, req)
+
+		got := rec.Header().Get(utils.RequestIDHeader)
+		require.Equal(t, got, ctxID, tt.name)
+		if tt.generate {
+			require.Len(t, got, 32, tt.name)
+		} else {
+			require.Equal(t, tt.id, got, tt.name)
+		}
+	}
+}
@@ -0,0 +1,871 @@
+package server
+
+import (
+	"net/http"
+)
+
+// OpenAPISpec payments API OpenAPI 3 document. It's the source of truth for clients SDKs
+// and is used to validate requests and responses, so keep it in sync with handlers
+const OpenAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Payments API",
+    "description": "Payment providers urls and payment sessions of products with app store urls fallback.",
+    "version": "1.0.0"
+  },
+  "paths": {
+    "/api/v1/payments/urls": {
+      "get": {
+        "operationId": "getPaymentsURLs",
+        "summary": "Get payment providers urls of product",
+        "description": "Returns payment url of every registered provider for catalog product price. Products missing from catalog or unavailable are not found. If providers fail app store urls are returned instead. In partial responses mode urls of succeeded providers are returned along with failed providers details. Providers, store urls and partial responses mode are chosen by tenant selected by credentials or request host. Credentials are optional unless server requires authentication.",
+        "security": [{"apiKey": []}, {"hmacSignature": []}, {}],
+        "parameters": [
+          {
+            "name": "productID",
+            "in": "query",
+            "required": true,
+            "schema": {"type": "string", "minLength": 1}
+          },
+          {
+            "name": "platform",
+            "in": "query",
+            "description": "Client platform. Only providers available on platform are called. Guessed by User-Agent if missing, every provider is called if platform is unknown",
+            "required": false,
+            "schema": {"type": "string", "enum": ["ios", "android", "web"]}
+          },
+          {
+            "name": "app",
+            "in": "query",
+            "description": "App to return store urls of if providers failed. Default app is used if missing",
+            "required": false,
+            "schema": {"type": "string", "minLength": 1}
+          },
+          {
+            "name": "locale",
+            "in": "query",
+            "description": "Language tag of store urls variant, e.g. pt-BR. Accept-Language header is used if missing",
+            "required": false,
+            "schema": {"type": "string", "pattern": "^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$"}
+          },
+          {
+            "name": "Accept-Language",
+            "in": "header",
+            "required": false,
+            "schema": {"type": "string"}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "Payment urls or app store urls fallback. Only store url relevant for platform is returned",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "oneOf": [
+                    {"$ref": "#/components/schemas/PaymentURLsResponse"},
+                    {"$ref": "#/components/schemas/AppURLsResponse"}
+                  ],
+                  "discriminator": {
+                    "propertyName": "type",
+                    "mapping": {
+                      "payment_urls": "#/components/schemas/PaymentURLsResponse",
+                      "app_urls": "#/components/schemas/AppURLsResponse"
+                    }
+                  }
+                }
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/ProductNotFound"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/payments": {
+      "post": {
+        "operationId": "createPaymentSession",
+        "summary": "Create payment session of product",
+        "description": "Creates payment session of request tenant for catalog product price and gets its pay url from provider. Session moves to pending with pay url or to failed if provider failed. Session not paid in time expires. Tenant is selected the same way as for payment urls.",
+        "security": [{"apiKey": []}, {"hmacSignature": []}, {}],
+        "parameters": [
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "description": "Client generated unique key of request, e.g. UUID. The first response is stored for 24 hours by default and replayed with Idempotent-Replayed header on retries with the same key, so request is executed once. Server errors and pending responses aren't stored. Keys are scoped by tenant and api key or HMAC key, anonymous requests share tenant scope",
+            "required": false,
+            "schema": {"type": "string", "minLength": 1, "maxLength": 255}
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {"$ref": "#/components/schemas/CreateSessionRequest"}
+            }
+          }
+        },
+        "responses": {
+          "201": {
+            "description": "Created payment session",
+            "headers": {
+              "Location": {"description": "Payment session url", "schema": {"type": "string"}},
+              "Idempotent-Replayed": {"description": "Set to true if response is replayed by idempotency key", "schema": {"type": "string"}}
+            },
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/Session"}
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/ProductNotFound"},
+          "409": {"$ref": "#/components/responses/IdempotencyConflict"},
+          "422": {"$ref": "#/components/responses/IdempotencyMismatch"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/payments/{id}": {
+      "get": {
+        "operationId": "getPaymentSession",
+        "summary": "Get payment session",
+        "description": "Returns payment session of request tenant. Sessions of other tenants aren't found.",
+        "security": [{"apiKey": []}, {"hmacSignature": []}, {}],
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {"type": "string"}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "Payment session",
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/Session"}
+              }
+            }
+          },
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/payments/{id}/refunds": {
+      "post": {
+        "operationId": "refundPayment",
+        "summary": "Refund payment",
+        "description": "Refunds captured payment of request tenant session by session provider. Amount left to refund is refunded if amount is missing, partial refunds may follow each other until the whole captured amount is refunded. Refund amount is reserved while provider is called, so refunds never exceed captured amount. Refund is returned even if provider rejected it, such refund is failed and its amount may be refunded again. If provider outcome is unknown, e.g. provider timed out, refund is pending with its amount reserved and should be retried with the same Idempotency-Key, refund id is derived from it, so payment is refunded once. Succeeded refund moves session to partially_refunded or refunded status and shows up in session history and refunds. Requires tenant credentials even if auth isn't required.",
+        "security": [{"apiKey": []}, {"hmacSignature": []}],
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {"type": "string"}
+          },
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "description": "Client generated unique key of request, e.g. UUID. The first response is stored for 24 hours by default and replayed with Idempotent-Replayed header on retries with the same key, so payment is refunded once. Required, refund id is derived from it, so pending refund is finished by retry with the same key. Server errors and pending responses aren't stored. Keys are scoped by tenant and api key or HMAC key, anonymous requests share tenant scope",
+            "required": true,
+            "schema": {"type": "string", "minLength": 1, "maxLength": 255}
+          }
+        ],
+        "requestBody": {
+          "required": false,
+          "content": {
+            "application/json": {
+              "schema": {"$ref": "#/components/schemas/CreateRefundRequest"}
+            }
+          }
+        },
+        "responses": {
+          "201": {
+            "description": "Succeeded or failed refund",
+            "headers": {
+              "Location": {"description": "Payment session url", "schema": {"type": "string"}},
+              "Idempotent-Replayed": {"description": "Set to true if response is replayed by idempotency key", "schema": {"type": "string"}}
+            },
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/Refund"}
+              }
+            }
+          },
+          "202": {
+            "description": "Pending refund, provider outcome is unknown. Retry request with the same idempotency key",
+            "headers": {
+              "Location": {"description": "Payment session url", "schema": {"type": "string"}}
+            },
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/Refund"}
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {
+            "description": "Payment isn't captured or there is no amount left to refund, or request with the same idempotency key is in progress",
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/ErrorResponse"}
+              }
+            }
+          },
+          "422": {
+            "description": "Refund exceeds amount left to refund, or idempotency key is already used with different request",
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/ErrorResponse"}
+              }
+            }
+          },
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/webhooks/{provider}": {
+      "post": {
+        "operationId": "receiveProviderWebhook",
+        "summary": "Receive payment provider webhook",
+        "description": "Payment outcome reported by provider. Body and signature headers are in provider format: apay signs webhooks with X-APay-Signature header, gpay with X-GPay-Timestamp and X-GPay-Signature headers. Event moves payment session referenced by it to authorized, captured or failed status. Events signed outside of allowed window, 5 minutes by default, and replayed events are rejected.",
+        "parameters": [
+          {
+            "name": "provider",
+            "in": "path",
+            "required": true,
+            "schema": {"type": "string", "enum": ["apay", "gpay"]}
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {"type": "object"}
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "Event is processed",
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/WebhookResponse"}
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/deliveries": {
+      "get": {
+        "operationId": "listDeliveries",
+        "summary": "List merchant webhooks deliveries",
+        "description": "Returns request tenant webhooks deliveries from the newest with every attempt response status code. Available if merchants webhooks are enabled. Requires tenant credentials even if auth isn't required.",
+        "security": [{"apiKey": []}, {"hmacSignature": []}],
+        "parameters": [
+          {
+            "name": "status",
+            "in": "query",
+            "required": false,
+            "schema": {"$ref": "#/components/schemas/DeliveryStatus"}
+          },
+          {
+            "name": "limit",
+            "in": "query",
+            "description": "Max number of deliveries, 100 by default",
+            "required": false,
+            "schema": {"type": "integer", "minimum": 1, "maximum": 1000}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "Deliveries log",
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/DeliveriesResponse"}
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"}
+        }
+      }
+    },
+    "/api/v1/deliveries/{id}": {
+      "get": {
+        "operationId": "getDelivery",
+        "summary": "Get merchant webhook delivery",
+        "security": [{"apiKey": []}, {"hmacSignature": []}],
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {"type": "string"}
+          }
+        ],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Delivery"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "429": {"$ref": "#/components/responses/RateLimited"}
+        }
+      }
+    },
+    "/api/v1/deliveries/{id}/redeliver": {
+      "post": {
+        "operationId": "redeliver",
+        "summary": "Redeliver merchant webhook",
+        "description": "Delivers event of delivery again by new delivery to current subscription url, e.g. after delivery is dead. Requires tenant credentials even if auth isn't required.",
+        "security": [{"apiKey": []}, {"hmacSignature": []}],
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {"type": "string"}
+          },
+          {
+            "name": "Idempotency-Key",
+            "in": "header",
+            "description": "Client generated unique key of request, e.g. UUID. The first response is stored for 24 hours by default and replayed with Idempotent-Replayed header on retries with the same key, so request is executed once. Server errors and pending responses aren't stored. Keys are scoped by tenant and api key or HMAC key, anonymous requests share tenant scope",
+            "required": false,
+            "schema": {"type": "string", "minLength": 1, "maxLength": 255}
+          }
+        ],
+        "responses": {
+          "202": {"$ref": "#/components/responses/Delivery"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "409": {"$ref": "#/components/responses/IdempotencyConflict"},
+          "422": {"$ref": "#/components/responses/IdempotencyMismatch"},
+          "429": {"$ref": "#/components/responses/RateLimited"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/providers/status": {
+      "get": {
+        "operationId": "getProvidersStatus",
+        "summary": "Get providers circuit breakers status",
+        "responses": {
+          "200": {
+            "description": "Circuit breakers status by provider name",
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/StatusResponse"}
+              }
+            }
+          }
+        }
+      }
+    },
+    "/api/v1/openapi.json": {
+      "get": {
+        "operationId": "getOpenAPISpec",
+        "summary": "Get this document",
+        "responses": {
+          "200": {
+            "description": "OpenAPI document",
+            "content": {
+              "application/json": {
+                "schema": {"type": "object"}
+              }
+            }
+          }
+        }
+      }
+    },
+    "/api/v1/admin/faults": {
+      "get": {
+        "operationId": "getFaults",
+        "summary": "Get faults injection config",
+        "description": "Available only if server is started with admin token.",
+        "security": [{"adminToken": []}],
+        "responses": {
+          "200": {"$ref": "#/components/responses/Faults"},
+          "401": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "put": {
+        "operationId": "putFaults",
+        "summary": "Replace faults injection config",
+        "description": "Available only if server is started with admin token. Never enable faults in production.",
+        "security": [{"adminToken": []}],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {"$ref": "#/components/schemas/FaultsConfig"}
+            }
+          }
+        },
+        "responses": {
+          "200": {"$ref": "#/components/responses/Faults"},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/api/v1/admin/ledger/trial-balance": {
+      "get": {
+        "operationId": "getTrialBalance",
+        "summary": "Get ledger trial balance",
+        "description": "Debit and credit turnovers of every ledger account by currency. Available only if server is started with admin token.",
+        "security": [{"adminToken": []}],
+        "parameters": [
+          {
+            "name": "as_of",
+            "in": "query",
+            "description": "Only transactions posted not after it are summed. Now if missing",
+            "required": false,
+            "schema": {"type": "string", "format": "date-time"}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "Trial balance",
+            "content": {
+              "application/json": {
+                "schema": {"$ref": "#/components/schemas/TrialBalance"}
+              }
+            }
+          },
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "500": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/healthz": {
+      "get": {
+        "operationId": "healthz",
+        "summary": "Liveness probe",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Health"}
+        }
+      }
+    },
+    "/readyz": {
+      "get": {
+        "operationId": "readyz",
+        "summary": "Readiness probe",
+        "responses": {
+          "200": {"$ref": "#/components/responses/Health"},
+          "503": {"$ref": "#/components/responses/Health"}
+        }
+      }
+    },
+    "/metrics": {
+      "get": {
+        "operationId": "metrics",
+        "summary": "Prometheus metrics",
+        "responses": {
+          "200": {
+            "description": "Metrics in Prometheus text exposition format",
+            "content": {
+              "text/plain": {
+                "schema": {"type": "string"}
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "adminToken": {"type": "http", "scheme": "bearer"},
+      "apiKey": {"type": "apiKey", "in": "header", "name": "X-API-Key", "description": "Tenant api key. Tenant is selected by request host if missing"},
+      "hmacSignature": {"type": "apiKey", "in": "header", "name": "X-Signature", "description": "Hex encoded HMAC-SHA256 of method, path, raw query, X-Signature-Timestamp unix time, X-Signature-Nonce and hex encoded SHA256 of body joined with new lines, signed with secret of X-Signature-Key-ID key. Timestamp should be within allowed window of server time, 5 minutes by default, and nonce should be unique"}
+    },
+    "responses": {
+      "Faults": {
+        "description": "Faults injection config",
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/FaultsConfig"}
+          }
+        }
+      },
+      "Error": {
+        "description": "Request failed",
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/ErrorResponse"}
+          }
+        }
+      },
+      "IdempotencyConflict": {
+        "description": "Request with the same idempotency key is in progress, retry it later",
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/ErrorResponse"}
+          }
+        }
+      },
+      "IdempotencyMismatch": {
+        "description": "Idempotency key is already used with different request",
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/ErrorResponse"}
+          }
+        }
+      },
+      "ProductNotFound": {
+        "description": "Product is missing from catalog or isn't available",
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/ErrorResponse"}
+          }
+        }
+      },
+      "RateLimited": {
+        "description": "Client or tenant rate limit exceeded",
+        "headers": {
+          "Retry-After": {"description": "Seconds until request is allowed", "schema": {"type": "integer"}},
+          "RateLimit-Limit": {"description": "Requests burst of the most restrictive limit", "schema": {"type": "integer"}},
+          "RateLimit-Remaining": {"description": "Requests left", "schema": {"type": "integer"}},
+          "RateLimit-Reset": {"description": "Seconds until limit is fully restored", "schema": {"type": "integer"}}
+        },
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/ErrorResponse"}
+          }
+        }
+      },
+      "Delivery": {
+        "description": "Merchant webhook delivery",
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/Delivery"}
+          }
+        }
+      },
+      "Health": {
+        "description": "Health check result",
+        "content": {
+          "application/json": {
+            "schema": {"$ref": "#/components/schemas/HealthResponse"}
+          }
+        }
+      }
+    },
+    "schemas": {
+      "PaymentURLsResponse": {
+        "type": "object",
+        "required": ["type", "urls"],
+        "additionalProperties": false,
+        "properties": {
+          "type": {"type": "string", "enum": ["payment_urls"]},
+          "platform": {"$ref": "#/components/schemas/Platform"},
+          "urls": {
+            "description": "Payment urls by provider name",
+            "type": "object",
+            "additionalProperties": {"type": "string", "format": "uri"}
+          },
+          "errors": {
+            "description": "Failed providers details. Returned in partial responses mode only",
+            "type": "object",
+            "additionalProperties": {"$ref": "#/components/schemas/ProviderError"}
+          },
+          "a_url": {"type": "string", "format": "uri", "deprecated": true, "description": "Use urls.apay"},
+          "g_url": {"type": "string", "format": "uri", "deprecated": true, "description": "Use urls.gpay"}
+        }
+      },
+      "AppURLsResponse": {
+        "type": "object",
+        "required": ["type"],
+        "additionalProperties": false,
+        "properties": {
+          "type": {"type": "string", "enum": ["app_urls"]},
+          "platform": {"$ref": "#/components/schemas/Platform"},
+          "apple_url": {"type": "string", "format": "uri"},
+          "google_url": {"type": "string", "format": "uri"},
+          "errors": {
+            "description": "Failed providers details. Returned in partial responses mode only",
+            "type": "object",
+            "additionalProperties": {"$ref": "#/components/schemas/ProviderError"}
+          }
+        }
+      },
+      "Platform": {
+        "description": "Client platform. Missing if platform is unknown",
+        "type": "string",
+        "enum": ["ios", "android", "web"]
+      },
+      "ProviderError": {
+        "type": "object",
+        "required": ["status", "error"],
+        "additionalProperties": false,
+        "properties": {
+          "status": {"type": "string", "enum": ["internal_error", "not_ok", "circuit_open", "rate_limited", "unknown_error"]},
+          "error": {"type": "string"}
+        }
+      },
+      "CreateSessionRequest": {
+        "type": "object",
+        "required": ["product_id", "provider"],
+        "additionalProperties": false,
+        "properties": {
+          "product_id": {"type": "string", "minLength": 1},
+          "amount": {"type": "integer", "minimum": 1, "description": "Amount in currency minor units, e.g. cents. Product price is used if missing, otherwise it should match it"},
+          "currency": {"type": "string", "pattern": "^[A-Z]{3}$", "example": "USD", "description": "Product currency is used if missing, otherwise it should match it"},
+          "provider": {"type": "string", "minLength": 1, "example": "apay"}
+        }
+      },
+      "Session": {
+        "type": "object",
+        "required": ["id", "tenant", "product_id", "amount", "currency", "provider", "status", "created_at", "updated_at", "expires_at", "history"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "string"},
+          "tenant": {"type": "string"},
+          "product_id": {"type": "string"},
+          "amount": {"type": "integer", "minimum": 1},
+          "currency": {"type": "string"},
+          "provider": {"type": "string"},
+          "status": {"$ref": "#/components/schemas/SessionStatus"},
+          "pay_url": {"type": "string", "format": "uri", "description": "Provider pay url client is redirected to. Missing until session is pending"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"},
+          "expires_at": {"type": "string", "format": "date-time"},
+          "history": {"type": "array", "items": {"$ref": "#/components/schemas/SessionTransition"}},
+          "refunds": {"type": "array", "items": {"$ref": "#/components/schemas/Refund"}}
+        }
+      },
+      "SessionStatus": {
+        "description": "Payment session status. Session moves created -> pending -> authorized -> captured, captured payment may be refunded partially or fully. Failed, expired and refunded sessions are final",
+        "type": "string",
+        "enum": ["created", "pending", "authorized", "captured", "failed", "expired", "partially_refunded", "refunded"]
+      },
+      "SessionTransition": {
+        "type": "object",
+        "required": ["from", "to", "at"],
+        "additionalProperties": false,
+        "properties": {
+          "from": {"$ref": "#/components/schemas/SessionStatus"},
+          "to": {"$ref": "#/components/schemas/SessionStatus"},
+          "at": {"type": "string", "format": "date-time"},
+          "reason": {"type": "string"},
+          "event": {"type": "string", "description": "Id of provider webhook event caused transition"},
+          "refund": {"type": "string", "description": "Id of refund caused transition"}
+        }
+      },
+      "CreateRefundRequest": {
+        "type": "object",
+        "additionalProperties": false,
+        "properties": {
+          "amount": {"type": "integer", "minimum": 1, "description": "Amount in currency minor units, e.g. cents. Amount left to refund is refunded if missing"},
+          "currency": {"type": "string", "pattern": "^[A-Z]{3}$", "example": "USD", "description": "Payment currency is used if missing, otherwise it should match it"},
+          "reason": {"type": "string", "maxLength": 500}
+        }
+      },
+      "TrialBalance": {
+        "type": "object",
+        "required": ["as_of", "accounts", "totals", "balanced"],
+        "additionalProperties": false,
+        "properties": {
+          "as_of": {"type": "string", "format": "date-time"},
+          "accounts": {
+            "type": "array",
+            "description": "Accounts balances sorted by account and currency",
+            "items": {"$ref": "#/components/schemas/LedgerBalance"}
+          },
+          "totals": {
+            "type": "array",
+            "description": "Turnovers of all accounts by currency, account is empty",
+            "items": {"$ref": "#/components/schemas/LedgerBalance"}
+          },
+          "balanced": {"type": "boolean", "description": "Total debits equal total credits in every currency"}
+        }
+      },
+      "LedgerBalance": {
+        "type": "object",
+        "required": ["account", "currency", "debit", "credit"],
+        "additionalProperties": false,
+        "properties": {
+          "account": {"type": "string", "example": "merchant:shop:receivable"},
+          "currency": {"type": "string", "example": "USD"},
+          "debit": {"type": "integer", "minimum": 0, "description": "Sum of debit entries in currency minor units"},
+          "credit": {"type": "integer", "minimum": 0, "description": "Sum of credit entries in currency minor units"}
+        }
+      },
+      "Refund": {
+        "type": "object",
+        "required": ["id", "amount", "currency", "status", "created_at", "updated_at"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "string"},
+          "amount": {"type": "integer", "minimum": 1},
+          "currency": {"type": "string"},
+          "reason": {"type": "string"},
+          "status": {"$ref": "#/components/schemas/RefundStatus"},
+          "provider_refund_id": {"type": "string", "description": "Refund id returned by provider"},
+          "error": {"type": "string", "description": "Provider error class of failed refund or of the last attempt of pending one", "example": "not_ok"},
+          "created_at": {"type": "string", "format": "date-time"},
+          "updated_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "RefundStatus": {
+        "description": "Refund status. Refund is pending while provider is called or if provider outcome is unknown, failed refund is rejected by provider and doesn't reserve its amount",
+        "type": "string",
+        "enum": ["pending", "succeeded", "failed"]
+      },
+      "WebhookResponse": {
+        "type": "object",
+        "required": ["session_id", "status"],
+        "additionalProperties": false,
+        "properties": {
+          "session_id": {"type": "string"},
+          "status": {"$ref": "#/components/schemas/SessionStatus"}
+        }
+      },
+      "DeliveriesResponse": {
+        "type": "object",
+        "required": ["deliveries"],
+        "additionalProperties": false,
+        "properties": {
+          "deliveries": {"type": "array", "items": {"$ref": "#/components/schemas/Delivery"}}
+        }
+      },
+      "Delivery": {
+        "description": "Delivery of payment session event to merchant subscription. Event is posted as {\"id\", \"type\", \"created_at\", \"data\": <Session>} signed with subscription secret in X-Payments-Signature header",
+        "type": "object",
+        "required": ["id", "tenant", "subscription_id", "url", "event_id", "event_type", "status", "attempts", "created_at"],
+        "additionalProperties": false,
+        "properties": {
+          "id": {"type": "string"},
+          "tenant": {"type": "string"},
+          "subscription_id": {"type": "string"},
+          "url": {"type": "string", "format": "uri"},
+          "event_id": {"type": "string"},
+          "event_type": {"type": "string", "example": "payment.captured"},
+          "status": {"$ref": "#/components/schemas/DeliveryStatus"},
+          "attempts": {"type": "array", "items": {"$ref": "#/components/schemas/DeliveryAttempt"}},
+          "next_attempt_at": {"type": "string", "format": "date-time"},
+          "redelivery_of": {"type": "string", "description": "Id of delivery redelivered by this one"},
+          "created_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "DeliveryStatus": {
+        "description": "Delivery status. Failed delivery is retried with exponential backoff and is dead once attempts are exhausted",
+        "type": "string",
+        "enum": ["pending", "succeeded", "dead"]
+      },
+      "DeliveryAttempt": {
+        "type": "object",
+        "required": ["at", "duration_ms"],
+        "additionalProperties": false,
+        "properties": {
+          "at": {"type": "string", "format": "date-time"},
+          "status_code": {"type": "integer", "description": "Merchant response status code. Missing if request failed"},
+          "error": {"type": "string"},
+          "duration_ms": {"type": "number", "minimum": 0}
+        }
+      },
+      "ErrorResponse": {
+        "type": "object",
+        "required": ["error"],
+        "additionalProperties": false,
+        "properties": {
+          "error": {"type": "string"}
+        }
+      },
+      "StatusResponse": {
+        "type": "object",
+        "required": ["providers"],
+        "additionalProperties": false,
+        "properties": {
+          "providers": {
+            "type": "object",
+            "additionalProperties": {"$ref": "#/components/schemas/ProviderStatus"}
+          }
+        }
+      },
+      "ProviderStatus": {
+        "type": "object",
+        "required": ["state", "requests", "failures"],
+        "additionalProperties": false,
+        "properties": {
+          "state": {"type": "string", "enum": ["closed", "open", "half_open"]},
+          "requests": {"type": "integer", "minimum": 0},
+          "failures": {"type": "integer", "minimum": 0},
+          "opened_at": {"type": "string", "format": "date-time"}
+        }
+      },
+      "FaultsConfig": {
+        "type": "object",
+        "required": ["enabled", "rules"],
+        "additionalProperties": false,
+        "properties": {
+          "enabled": {"type": "boolean"},
+          "rules": {"type": "array", "items": {"$ref": "#/components/schemas/FaultRule"}}
+        }
+      },
+      "FaultRule": {
+        "description": "Fault to inject into route or provider requests. Either route or provider should be set",
+        "type": "object",
+        "required": ["kind", "probability"],
+        "additionalProperties": false,
+        "properties": {
+          "route": {"type": "string", "example": "/api/v1/payments/urls"},
+          "provider": {"type": "string", "example": "apay"},
+          "kind": {"type": "string", "enum": ["latency", "panic", "status", "malformed"]},
+          "probability": {"type": "number", "minimum": 0, "maximum": 1},
+          "latency": {"type": "string", "description": "Delay of latency fault", "example": "500ms"},
+          "status": {"type": "integer", "minimum": 100, "maximum": 599}
+        }
+      },
+      "HealthResponse": {
+        "type": "object",
+        "required": ["status"],
+        "additionalProperties": false,
+        "properties": {
+          "status": {"type": "string", "enum": ["ok", "not_ready"]},
+          "checks": {
+            "description": "Readiness checks results. Providers checks contain circuit breaker state",
+            "type": "object",
+            "additionalProperties": {"type": "string"}
+          }
+        }
+      }
+    }
+  }
+}
+`
+
+// GetOpenAPISpec return payments API OpenAPI document
+func GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(OpenAPISpec))
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+// requestPlatform return client platform from platform query param or guess it by User-Agent header
+func requestPlatform(r *http.Request) (providers.Platform, error) {
+	if p := r.URL.Query().Get("platform"); p != "" {
+		pl, err := providers.ParsePlatform(strings.ToLower(p))
+		if err != nil {
+			return providers.PlatformAny, errors.WithStack(err)
+		}
+		return pl, nil
+	}
+
+	return userAgentPlatform(r.UserAgent()), nil
+}
+
+// iosWords User-Agent words of iOS devices and system
+var iosWords = map[string]bool{"iphone": true, "ipad": true, "ipod": true, "ios": true}
+
+// userAgentPlatform guess platform by User-Agent. PlatformAny is returned if platform is unknown,
+// e.g. for server to server calls. Platforms are matched by whole words, so "kiosk" isn't iOS,
+// and HTTP client libraries like okhttp are used by servers too, so they aren't platforms alone
+func userAgentPlatform(ua string) providers.Platform {
+	ua = strings.ToLower(ua)
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(ua, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		words[w] = true
+	}
+	ios := false
+	for w := range iosWords {
+		ios = ios || words[w]
+	}
+
+	switch {
+	// android browsers user agents contain Mozilla and Linux too, so android goes first
+	case words["android"]:
+		return providers.PlatformAndroid
+	// iPadOS Safari has "CPU OS", native apps have CFNetwork and Darwin
+	case ios, strings.Contains(ua, "cpu os "), strings.Contains(ua, "cfnetwork/") && strings.Contains(ua, "darwin/"):
+		return providers.PlatformIOS
+	case strings.HasPrefix(ua, "mozilla/"):
+		return providers.PlatformWeb
+	default:
+		return providers.PlatformAny
+	}
+}
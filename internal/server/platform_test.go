@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/controller"
+	"github.com/fedoseev-vitaliy/payments/internal/fallback"
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+func TestUserAgentPlatform(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		ua   string
+		want providers.Platform
+	}{
+		{ua: "Mozilla/5.0 (iPhone; CPU iPhone OS 14_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", want: providers.PlatformIOS},
+		{ua: "MyApp/1.2 CFNetwork/1206 Darwin/20.1.0", want: providers.PlatformIOS},
+		{ua: "Mozilla/5.0 (Linux; Android 10; SM-G973F) AppleWebKit/537.36 Chrome/86.0 Mobile Safari/537.36", want: providers.PlatformAndroid},
+		{ua: "okhttp/4.9.0", want: providers.PlatformAny},
+		{ua: "MyApp/1.2 (Linux; Android 11) okhttp/4.9.0", want: providers.PlatformAndroid},
+		{ua: "Mozilla/5.0 (iPad; CPU OS 14_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", want: providers.PlatformIOS},
+		{ua: "MyApp/1.2 (iOS 14.2; Scale/3.00)", want: providers.PlatformIOS},
+		{ua: "Mozilla/5.0 (X11; Linux x86_64; Kiosk) AppleWebKit/537.36 Chrome/86.0 Safari/537.36", want: providers.PlatformWeb},
+		{ua: "bios-updater/1.0", want: providers.PlatformAny},
+		{ua: "curiosity-bot/2.1", want: providers.PlatformAny},
+		{ua: "CFNetwork/1206", want: providers.PlatformAny},
+		{ua: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 Safari/605.1.15", want: providers.PlatformWeb},
+		{ua: "curl/7.64.1", want: providers.PlatformAny},
+		{ua: "", want: providers.PlatformAny},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, userAgentPlatform(tt.ua), tt.ua)
+	}
+}
+
+func TestHandler_GetPaymentsURLsPlatform(t *testing.T) {
+	t.Parallel()
+
+	aMock := &mocks.Provider{}
+	aMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com/payfor?product=1", nil).Once()
+	aMock.On("GetPayURL", mock.Anything, productPayment("2")).Return("", errors.Wrap(providers.ErrNotOK, "bad product")).Once()
+
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", aMock, providers.PlatformIOS))
+	require.NoError(t, reg.Register("gpay", &mocks.Provider{}, providers.PlatformAndroid))
+	stores := fallback.DefaultConfig()
+	h := NewHandler(newTestLogger(), controller.New(reg), false, metrics.New(), &stores, newTestCatalog(t))
+
+	tests := []struct {
+		name   string
+		url    string
+		ua     string
+		status int
+		want   interface{}
+	}{
+		{
+			name:   "explicit platform",
+			url:    "/api/v1/payments/urls?productID=1&platform=ios",
+			ua:     "okhttp/4.9.0",
+			status: http.StatusOK,
+			want: &Response{
+				Type:        responseTypePaymentURLs,
+				Platform:    "ios",
+				ApplePayURL: "http://apple.pay.com/payfor?product=1",
+				URLs:        map[string]string{"apay": "http://apple.pay.com/payfor?product=1"},
+			},
+		},
+		{
+			name:   "platform store url",
+			url:    "/api/v1/payments/urls?productID=2",
+			ua:     "MyApp/1.2 CFNetwork/1206 Darwin/20.1.0",
+			status: http.StatusOK,
+			want:   &AppURLResponse{Type: responseTypeAppURLs, Platform: "ios", AppleAppURL: fallback.DefaultAppleURL},
+		},
+		{
+			name:   "no eligible providers",
+			url:    "/api/v1/payments/urls?productID=3&platform=web",
+			status: http.StatusOK,
+			want:   &AppURLResponse{Type: responseTypeAppURLs, Platform: "web", AppleAppURL: fallback.DefaultAppleURL, GoogleAppURL: fallback.DefaultGoogleURL},
+		},
+		{
+			name:   "unknown platform",
+			url:    "/api/v1/payments/urls?productID=1&platform=symbian",
+			status: http.StatusBadRequest,
+			want:   &ErrorResponse{Error: `unknown platform "symbian"`},
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		req.Header.Set("User-Agent", tt.ua)
+		rec := httptest.NewRecorder()
+		h.GetPaymentsURLs(rec, req)
+
+		require.Equal(t, tt.status, rec.Code, tt.name)
+		want, err := json.Marshal(tt.want)
+		require.NoError(t, err)
+		require.JSONEq(t, string(want), rec.Body.String(), tt.name)
+	}
+
+	mock.AssertExpectationsForObjects(t, aMock)
+}
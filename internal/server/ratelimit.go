@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/ratelimit"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// rate limit headers
+const (
+	retryAfterHeader         = "Retry-After"
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+)
+
+// forwardedForHeader header proxies append client ip to
+const forwardedForHeader = "X-Forwarded-For"
+
+// rateLimiter limits requests rate per client and per tenant.
+// Client is api key or HMAC key of authenticated request, otherwise client ip
+type rateLimiter struct {
+	l       *logrus.Logger
+	m       *metrics.Metrics
+	clients *ratelimit.Limiter
+	trusted []*net.IPNet
+	now     func() time.Time
+
+	mu      sync.Mutex
+	tenants map[string]*ratelimit.Bucket
+}
+
+// newRateLimiter construct rate limiter with client limit. Client limit is disabled if it's empty.
+// X-Forwarded-For header is used to find client ip of requests from trusted proxies only
+func newRateLimiter(l *logrus.Logger, m *metrics.Metrics, client ratelimit.Config, trusted []*net.IPNet) *rateLimiter {
+	rl := &rateLimiter{
+		l:       l,
+		m:       m,
+		trusted: trusted,
+		now:     time.Now,
+		tenants: make(map[string]*ratelimit.Bucket),
+	}
+	if client.Enabled() {
+		rl.clients = ratelimit.NewLimiter(client)
+	}
+	return rl
+}
+
+// limit wrap handler to reject requests exceeding client or tenant rate limit with TooManyRequests.
+// RateLimit headers of the most restrictive limit are set on every response
+func (rl *rateLimiter) limit(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			res     ratelimit.Result
+			limited bool
+		)
+		if rl.clients != nil {
+			res, limited = rl.clients.Allow(clientKey(r, rl.trusted)), true
+			if !res.Allowed {
+				rl.reject(w, r, "client", res)
+				return
+			}
+		}
+
+		if t, ok := tenant.FromContext(r.Context()); ok && t.RateLimit.Enabled() {
+			tres := rl.tenantBucket(t).Take(rl.now())
+			if !tres.Allowed {
+				rl.reject(w, r, "tenant", tres)
+				return
+			}
+			if !limited || tres.Remaining < res.Remaining {
+				res, limited = tres, true
+			}
+		}
+
+		if limited {
+			setRateLimitHeaders(w, res)
+		}
+		h(w, r)
+	}
+}
+
+// reject write TooManyRequests response
+func (rl *rateLimiter) reject(w http.ResponseWriter, r *http.Request, limiter string, res ratelimit.Result) {
+	name := ""
+	if t, ok := tenant.FromContext(r.Context()); ok {
+		name = t.ID
+	}
+	rl.m.RateLimited.Inc(limiter, name)
+	utils.Logger(r.Context()).WithField("limiter", limiter).Warn("rate limit exceeded")
+
+	setRateLimitHeaders(w, res)
+	w.Header().Set(retryAfterHeader, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	if err := json.NewEncoder(w).Encode(&ErrorResponse{
+		Error: "rate limit exceeded",
+	}); err != nil {
+		rl.l.Error(err.Error())
+	}
+}
+
+// tenantBucket return tenant token bucket
+func (rl *rateLimiter) tenantBucket(t *tenant.Tenant) *ratelimit.Bucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b, ok := rl.tenants[t.ID]
+	if !ok {
+		b = ratelimit.NewBucket(t.RateLimit)
+		rl.tenants[t.ID] = b
+	}
+	return b
+}
+
+// clientKey return key of request credentials or client ip
+func clientKey(r *http.Request, trusted []*net.IPNet) string {
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		return "key:" + id.Tenant + "/" + id.KeyID
+	}
+	return "ip:" + clientIP(r, trusted)
+}
+
+// setRateLimitHeaders set RateLimit headers of limit check result
+func setRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	w.Header().Set(rateLimitLimitHeader, strconv.Itoa(res.Limit))
+	w.Header().Set(rateLimitRemainingHeader, strconv.Itoa(res.Remaining))
+	w.Header().Set(rateLimitResetHeader, strconv.Itoa(ceilSeconds(res.Reset)))
+}
+
+// ceilSeconds return duration in whole seconds rounded up
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// clientIP return request remote ip. If request comes from trusted proxy
+// X-Forwarded-For hops are walked from the nearest one and the first untrusted hop is client ip
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrusted(ip, trusted) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values(forwardedForHeader), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hip == nil {
+			// malformed hop can't be trusted, the last trusted proxy is the client
+			break
+		}
+		host = hip.String()
+		if !isTrusted(hip, trusted) {
+			break
+		}
+	}
+	return host
+}
+
+// isTrusted check that ip belongs to trusted networks
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/ratelimit"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{name: "direct", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted proxy", remote: "203.0.113.7:5000", xff: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.0.0.1:5000", xff: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "proxies chain", remote: "10.0.0.1:5000", xff: []string{"192.0.2.1, 198.51.100.1, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "multiple headers", remote: "10.0.0.1:5000", xff: []string{"192.0.2.1", "10.0.0.3"}, want: "192.0.2.1"},
+		{name: "spoofed hop", remote: "10.0.0.1:5000", xff: []string{"garbage, 198.51.100.1"}, want: "198.51.100.1"},
+		{name: "malformed hop", remote: "10.0.0.1:5000", xff: []string{"198.51.100.1, garbage"}, want: "10.0.0.1"},
+		{name: "no header", remote: "10.0.0.1:5000", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		for _, v := range tt.xff {
+			req.Header.Add(forwardedForHeader, v)
+		}
+		require.Equal(t, tt.want, clientIP(req, trusted), tt.name)
+	}
+}
+
+func TestRouter_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	pMock := &mocks.Provider{}
+	pMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com/payfor?product=1", nil)
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", pMock))
+
+	resolver, err := tenant.NewResolver([]*tenant.Tenant{
+		{ID: "shop", Hosts: []string{"shop.example.com"}, RateLimit: ratelimit.Config{RPS: 0.001, Burst: 3}, Providers: reg},
+		{ID: "games", Hosts: []string{"games.example.com"}, APIKeys: []string{tenant.HashAPIKey("games-key")}, Providers: reg},
+	}, "")
+	require.NoError(t, err)
+
+	m := metrics.New()
+	r := newRouter(newTestLogger(), reg, NewHealthHandler(newTestLogger(), nil), Options{
+		Catalog:         newTestCatalog(t),
+		Validation:      ValidationStrict,
+		Metrics:         m,
+		Tenants:         resolver,
+		ClientRateLimit: ratelimit.Config{RPS: 0.001, Burst: 2},
+	})
+
+	do := func(host, ip, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/payments/urls?productID=1", nil)
+		req.Host = host
+		req.RemoteAddr = ip + ":5000"
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// client limit
+	rec := do("shop.example.com", "192.0.2.1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "2", rec.Header().Get(rateLimitLimitHeader))
+	require.Equal(t, "1", rec.Header().Get(rateLimitRemainingHeader))
+	require.Equal(t, http.StatusOK, do("shop.example.com", "192.0.2.1", "").Code)
+
+	rec = do("shop.example.com", "192.0.2.1", "")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code, rec.Body.String())
+	require.Equal(t, "0", rec.Header().Get(rateLimitRemainingHeader))
+	retryAfter, err := strconv.Atoi(rec.Header().Get(retryAfterHeader))
+	require.NoError(t, err)
+	require.True(t, retryAfter > 0)
+	require.JSONEq(t, `{"error":"rate limit exceeded"}`, rec.Body.String())
+
+	// tenant limit is shared by tenant clients and reported if it's the most restrictive
+	rec = do("shop.example.com", "192.0.2.2", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "3", rec.Header().Get(rateLimitLimitHeader))
+	require.Equal(t, "0", rec.Header().Get(rateLimitRemainingHeader))
+	require.Equal(t, http.StatusTooManyRequests, do("shop.example.com", "192.0.2.3", "").Code)
+
+	// api key is a client regardless of ip, tenant without limit
+	require.Equal(t, http.StatusOK, do("", "192.0.2.1", "games-key").Code)
+	require.Equal(t, http.StatusOK, do("", "192.0.2.4", "games-key").Code)
+	require.Equal(t, http.StatusTooManyRequests, do("", "192.0.2.5", "games-key").Code)
+
+	require.EqualValues(t, 2, m.RateLimited.Value("client", "shop")+m.RateLimited.Value("client", "games"))
+	require.EqualValues(t, 1, m.RateLimited.Value("tenant", "shop"))
+}
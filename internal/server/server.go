@@ -1,43 +1,235 @@
 package server
 
 import (
+	"net"
 	"net/http"
-	"net/url"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/fedoseev-vitaliy/payments/internal/catalog"
 	"github.com/fedoseev-vitaliy/payments/internal/controller"
-	"github.com/fedoseev-vitaliy/payments/internal/providers/apay"
-	"github.com/fedoseev-vitaliy/payments/internal/providers/gpay"
-	"github.com/fedoseev-vitaliy/payments/internal/utils"
+	"github.com/fedoseev-vitaliy/payments/internal/fallback"
+	"github.com/fedoseev-vitaliy/payments/internal/faults"
+	"github.com/fedoseev-vitaliy/payments/internal/idempotency"
+	"github.com/fedoseev-vitaliy/payments/internal/ledger"
+	"github.com/fedoseev-vitaliy/payments/internal/metrics"
+	"github.com/fedoseev-vitaliy/payments/internal/notify"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/breaker"
+	"github.com/fedoseev-vitaliy/payments/internal/ratelimit"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
 )
 
 // newRouter construct router
-func newRouter(l *logrus.Logger, aPayURL *url.URL, gPayURL *url.URL) http.Handler {
+func newRouter(l *logrus.Logger, reg *providers.Registry, hh *HealthHandler, opts Options) http.Handler {
 	mux := http.NewServeMux()
 
-	cli := utils.NewClient(time.Second * 5)
+	c := controller.New(reg)
+	m := opts.Metrics
+	if m == nil {
+		m = metrics.New()
+	}
+
+	stores := opts.StoreURLs
+	if stores == nil {
+		def := fallback.DefaultConfig()
+		stores = &def
+	}
+
+	products := opts.Catalog
+	if products == nil {
+		products, _ = catalog.New(nil)
+	}
 
-	ap := apay.New(cli, aPayURL)
-	gp := gpay.New(cli, gPayURL)
-	c := controller.New(ap, gp)
-	h := NewHandler(l, c)
+	h := NewHandler(l, c, opts.PartialResponses, m, stores, products)
 
-	mux.HandleFunc("/api/v1/payments/urls", h.GetPaymentsURLs)
+	sh := NewStatusHandler(l, opts.Breakers)
 
-	return newPanicRecoveryMiddleware(newLoggerMiddleware(newHeaderMiddleware(mux), l), l)
+	tenants := opts.Tenants
+	if tenants == nil {
+		tenants = defaultTenants(reg, stores, opts.PartialResponses)
+	}
+
+	sessions := opts.Sessions
+	if sessions == nil {
+		sessions = session.NewService(session.NewMemoryRepository(), 0)
+	}
+	ph := NewSessionsHandler(l, c, sessions, products)
+	wh := NewWebhooksHandler(l, opts.Webhooks, sessions, opts.WebhookMaxSkew)
+
+	idem := opts.Idempotency
+	if idem == nil {
+		idem = idempotency.NewMemoryStore(0)
+	}
+	ig := newIdempotencyGuard(l, idem)
+
+	rl := newRateLimiter(l, m, opts.ClientRateLimit, opts.TrustedProxies)
+	// protected authenticates tenant requests, limits their rate and makes retries of state-changing requests safe
+	protected := func(h http.HandlerFunc) http.HandlerFunc {
+		return requireAuth(requireTenant(rl.limit(ig.guard(h)), l), l, opts.AuthRequired)
+	}
+	// merchant is protected but always requires credentials, so back-office operations aren't available
+	// to anonymous clients of default tenant, e.g. mobile apps which know payment session id
+	merchant := func(h http.HandlerFunc) http.HandlerFunc {
+		return requireAuth(requireTenant(rl.limit(ig.guard(h)), l), l, true)
+	}
+
+	mux.HandleFunc("/api/v1/payments/urls", protected(h.GetPaymentsURLs))
+	mux.HandleFunc(sessionsPath, protected(ph.Create))
+	getSession, refund := protected(ph.Get), merchant(ph.Refund)
+	mux.HandleFunc(sessionsPath+"/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, refundsSuffix) {
+			refund(w, r)
+			return
+		}
+		getSession(w, r)
+	})
+	mux.HandleFunc(webhooksPath, wh.Receive)
+	if opts.Deliveries != nil {
+		dh := NewDeliveriesHandler(l, opts.Deliveries)
+		mux.HandleFunc(deliveriesPath, merchant(dh.List))
+		mux.HandleFunc(deliveriesPath+"/", merchant(dh.Delivery))
+	}
+	mux.HandleFunc("/api/v1/providers/status", sh.GetProvidersStatus)
+	mux.HandleFunc("/api/v1/openapi.json", GetOpenAPISpec)
+	mux.Handle("/metrics", m)
+	mux.HandleFunc("/healthz", hh.Healthz)
+	mux.HandleFunc("/readyz", hh.Readyz)
+	if opts.AdminToken != "" {
+		ah := NewAdminHandler(l, opts.AdminToken, opts.Faults, opts.Ledger)
+		if opts.Faults != nil {
+			mux.HandleFunc("/api/v1/admin/faults", ah.Faults)
+		}
+		if opts.Ledger != nil {
+			mux.HandleFunc("/api/v1/admin/ledger/trial-balance", ah.TrialBalance)
+		}
+	}
+
+	var r http.Handler = mux
+	if opts.Validation == ValidationLog || opts.Validation == ValidationStrict {
+		r = newValidationMiddleware(r, l, opts.Validation == ValidationStrict)
+	}
+	if opts.Faults != nil {
+		r = opts.Faults.Middleware(r)
+	}
+	r = newHeaderMiddleware(r)
+	r = newMetricsMiddleware(r, mux, m)
+	r = newLoggerMiddleware(r)
+	r = newPanicRecoveryMiddleware(r, l)
+	r = newTenantMiddleware(r, tenants)
+	r = newAuthMiddleware(r, tenants, opts.AuthMaxSkew)
+	r = newRequestIDMiddleware(r, l)
+
+	return r
+}
+
+// defaultTenants construct resolver serving every request by the only default tenant
+func defaultTenants(reg *providers.Registry, stores *fallback.Config, partial bool) *tenant.Resolver {
+	t := &tenant.Tenant{
+		ID:        tenant.DefaultID,
+		StoreURLs: stores,
+		Features:  map[string]bool{tenant.FeaturePartialResponses: partial},
+		Providers: reg,
+	}
+
+	// default tenant is always valid
+	r, _ := tenant.NewResolver([]*tenant.Tenant{t}, t.ID)
+	return r
+}
+
+// Options server options
+type Options struct {
+	// PartialResponses return urls of succeeded providers even if other providers failed
+	PartialResponses bool
+	// Breakers providers circuit breakers to report status
+	Breakers []*breaker.Breaker
+	// Metrics service metrics. Providers calls metrics are collected if providers are instrumented with the same metrics
+	Metrics *metrics.Metrics
+	// Validation requests and responses validation against OpenAPISpec. Off if empty
+	Validation ValidationMode
+	// StoreURLs apps store urls to fallback to. fallback.DefaultConfig is used if nil
+	StoreURLs *fallback.Config
+	// Catalog products payments are requested for. Requests of other products are rejected with NotFound.
+	// Every product is unknown if nil
+	Catalog *catalog.Catalog
+	// Faults injector of route faults. Admin endpoint to configure it is registered if AdminToken is set
+	Faults *faults.Injector
+	// AdminToken bearer token of admin endpoints. Admin endpoints are disabled if empty
+	AdminToken string
+	// Tenants resolver of requests tenants. The only default tenant with registry providers,
+	// StoreURLs and PartialResponses is used if nil
+	Tenants *tenant.Resolver
+	// AuthRequired reject payments requests without tenant api key or HMAC signature.
+	// Requests with invalid credentials are always rejected
+	AuthRequired bool
+	// AuthMaxSkew max difference between signed request timestamp and server time. DefaultAuthMaxSkew is used if 0
+	AuthMaxSkew time.Duration
+	// ClientRateLimit payments requests rate limit per api key, HMAC key or client ip. Unlimited if empty.
+	// Tenants rate limits are applied in addition to it
+	ClientRateLimit ratelimit.Config
+	// TrustedProxies networks of proxies whose X-Forwarded-For header is trusted to find client ip
+	TrustedProxies []*net.IPNet
+	// Sessions payment sessions service. Sessions are kept in memory if nil
+	Sessions *session.Service
+	// Webhooks verifiers of payment providers webhooks by provider name. Webhooks of other providers are rejected
+	Webhooks map[string]providers.WebhookVerifier
+	// WebhookMaxSkew max difference between webhook signature timestamp and server time. DefaultWebhookMaxSkew is used if 0
+	WebhookMaxSkew time.Duration
+	// Deliveries merchants webhooks dispatcher. Deliveries log endpoints are registered if it's set.
+	// Sessions should notify it of status changes
+	Deliveries *notify.Dispatcher
+	// Idempotency storage of responses of requests with idempotency keys. Responses are kept in memory for
+	// idempotency.DefaultTTL if nil
+	Idempotency idempotency.Store
+	// Ledger book of payments money movements. Admin endpoint of its trial balance is registered if AdminToken is set.
+	// Sessions should notify its recorder of status changes
+	Ledger *ledger.Ledger
+}
+
+// Server http server which reports its readiness
+type Server struct {
+	*http.Server
+
+	health *HealthHandler
 }
 
 // NewServer construct server with handler
-func NewServer(l *logrus.Logger, addr string, aPayURL *url.URL, gPayURL *url.URL) *http.Server {
-	r := newRouter(l, aPayURL, gPayURL)
+func NewServer(l *logrus.Logger, addr string, reg *providers.Registry, opts Options) *Server {
+	hh := NewHealthHandler(l, opts.Breakers)
+	r := newRouter(l, reg, hh, opts)
 
-	return &http.Server{
-		Addr:         addr,
-		Handler:      r,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
+	return &Server{
+		Server: &http.Server{
+			Addr:         addr,
+			Handler:      r,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  15 * time.Second,
+		},
+		health: hh,
 	}
 }
+
+// ListenAndServe listen on server address and become ready once listener is bound
+func (s *Server) ListenAndServe() error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.health.Serving()
+	return s.Serve(ln)
+}
+
+// Drain mark server as not ready so load balancers stop sending traffic before Shutdown
+func (s *Server) Drain() {
+	s.health.Drain()
+}
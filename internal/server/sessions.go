@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/catalog"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+)
+
+// sessionsPath payment sessions route, session is addressed by id under it
+const sessionsPath = "/api/v1/payments"
+
+// refundsSuffix suffix of session path to refund its payment
+const refundsSuffix = "/refunds"
+
+// ProviderResolver find request tenant provider by name
+type ProviderResolver interface {
+	Provider(ctx context.Context, name string) (providers.Provider, bool)
+}
+
+// SessionsHandler payment sessions handler
+type SessionsHandler struct {
+	l         *logrus.Logger
+	providers ProviderResolver
+	sessions  *session.Service
+	products  *catalog.Catalog
+}
+
+// CreateSessionRequest payment session parameters
+type CreateSessionRequest struct {
+	ProductID string `json:"product_id"`
+	// Amount in currency minor units, e.g. cents. Product price is used if 0, otherwise it should match it
+	Amount int64 `json:"amount"`
+	// Currency product currency is used if empty, otherwise it should match it
+	Currency string `json:"currency"`
+	Provider string `json:"provider"`
+}
+
+// CreateRefundRequest payment refund parameters
+type CreateRefundRequest struct {
+	// Amount in currency minor units, e.g. cents. Amount left to refund is refunded if 0
+	Amount int64 `json:"amount"`
+	// Currency payment currency is used if empty, otherwise it should match it
+	Currency string `json:"currency"`
+	Reason   string `json:"reason"`
+}
+
+// NewSessionsHandler construct payment sessions handler of catalog products
+func NewSessionsHandler(l *logrus.Logger, p ProviderResolver, s *session.Service, products *catalog.Catalog) *SessionsHandler {
+	return &SessionsHandler{l: l, providers: p, sessions: s, products: products}
+}
+
+// Create create payment session of request tenant and get provider pay url
+func (h *SessionsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusForbidden, "Only POST method supported")
+		return
+	}
+
+	req := &CreateSessionRequest{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		h.writeError(w, http.StatusBadRequest, errors.Wrap(err, "invalid payment session request").Error())
+		return
+	}
+
+	product, err := h.products.Product(req.ProductID)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if (req.Amount != 0 && req.Amount != product.Price) || (req.Currency != "" && req.Currency != product.Currency) {
+		h.writeError(w, http.StatusBadRequest, "amount and currency should match product "+product.ID+" price")
+		return
+	}
+
+	t, _ := tenant.FromContext(r.Context())
+	cr := session.CreateRequest{
+		Tenant:      t.ID,
+		ProductID:   product.ID,
+		Price:       product.Money(),
+		Provider:    req.Provider,
+		Description: product.Title,
+	}
+	if err := cr.Validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p, ok := h.providers.Provider(r.Context(), req.Provider)
+	if !ok {
+		h.writeError(w, http.StatusBadRequest, "unknown provider "+req.Provider)
+		return
+	}
+
+	ps, err := h.sessions.Create(r.Context(), cr, p)
+	if err != nil {
+		h.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", sessionsPath+"/"+ps.ID)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(ps); err != nil {
+		h.l.Error(err.Error())
+	}
+}
+
+// Get return payment session of request tenant by id
+func (h *SessionsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusForbidden, "Only GET method supported")
+		return
+	}
+
+	ps, ok := h.session(w, r, strings.TrimPrefix(r.URL.Path, sessionsPath+"/"))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ps); err != nil {
+		h.l.Error(err.Error())
+	}
+}
+
+// Refund refund payment of request tenant session by session provider, fully or partially.
+// Refund is returned even if provider failed to refund, such refund is failed, or provider outcome
+// is unknown, such refund is pending and is retried by request with the same idempotency key.
+// Idempotency key is required, refund id is derived from it. It's a merchant operation,
+// request should be authenticated by tenant credentials
+func (h *SessionsHandler) Refund(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusForbidden, "Only POST method supported")
+		return
+	}
+	// refund with unknown outcome is finished by retry with the same key only
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		h.writeError(w, http.StatusBadRequest, IdempotencyKeyHeader+" header is required")
+		return
+	}
+
+	req := &CreateRefundRequest{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	// empty body refunds amount left to refund
+	if err := dec.Decode(req); err != nil && err != io.EOF {
+		h.writeError(w, http.StatusBadRequest, errors.Wrap(err, "invalid refund request").Error())
+		return
+	}
+	if req.Amount < 0 {
+		h.writeError(w, http.StatusBadRequest, "amount should be positive")
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, sessionsPath+"/"), refundsSuffix)
+	ps, ok := h.session(w, r, id)
+	if !ok {
+		return
+	}
+
+	p, ok := h.providers.Provider(r.Context(), ps.Provider)
+	if !ok {
+		h.writeError(w, http.StatusInternalServerError, "unknown provider "+ps.Provider)
+		return
+	}
+
+	// refund id is derived from idempotency key, so retry of refund with unknown outcome is refunded once
+	_, rf, err := h.sessions.Refund(r.Context(), id, session.RefundRequest{
+		ID:       session.RefundIDFor(id, key),
+		Amount:   req.Amount,
+		Currency: req.Currency,
+		Reason:   req.Reason,
+	}, p)
+	switch errors.Cause(err) {
+	case nil:
+	case session.ErrNotRefundable:
+		h.writeError(w, http.StatusConflict, err.Error())
+		return
+	case session.ErrRefundExceeded:
+		h.writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	case money.ErrCurrencyMismatch:
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		h.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := http.StatusCreated
+	if rf.Status == session.RefundPending {
+		// provider outcome is unknown, client should retry with the same idempotency key
+		status = http.StatusAccepted
+		notFinal(w)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", sessionsPath+"/"+id)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(rf); err != nil {
+		h.l.Error(err.Error())
+	}
+}
+
+// session return request tenant session by id. Error response is written if there is no one
+func (h *SessionsHandler) session(w http.ResponseWriter, r *http.Request, id string) (*session.Session, bool) {
+	ps, err := h.sessions.Get(r.Context(), id)
+	t, _ := tenant.FromContext(r.Context())
+	switch {
+	case errors.Cause(err) == session.ErrNotFound, err == nil && ps.Tenant != t.ID:
+		h.writeError(w, http.StatusNotFound, session.ErrNotFound.Error())
+		return nil, false
+	case err != nil:
+		h.writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return ps, true
+}
+
+// writeError write error response with status
+func (h *SessionsHandler) writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&ErrorResponse{
+		Error: msg,
+	}); err != nil {
+		h.l.Error(err.Error())
+	}
+}
@@ -0,0 +1,329 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+)
+
+func TestRouter_Sessions(t *testing.T) {
+	t.Parallel()
+
+	apayMock := &mocks.Provider{}
+	apayMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com?product=1", nil).Twice()
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", apayMock))
+
+	resolver, err := tenant.NewResolver([]*tenant.Tenant{
+		{ID: "shop", APIKeys: []string{tenant.HashAPIKey("shop-key")}, Providers: reg},
+		{ID: "games", APIKeys: []string{tenant.HashAPIKey("games-key")}, Providers: providers.NewRegistry()},
+	}, "")
+	require.NoError(t, err)
+
+	r := newRouter(newTestLogger(), providers.NewRegistry(), NewHealthHandler(newTestLogger(), nil), Options{
+		Catalog:    newTestCatalog(t),
+		Validation: ValidationStrict,
+		Tenants:    resolver,
+	})
+
+	do := func(method, url, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/v1/payments", "shop-key", `{"product_id":"1","amount":999,"currency":"USD","provider":"apay"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	created := &session.Session{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), created))
+	require.Equal(t, "shop", created.Tenant)
+	require.Equal(t, session.StatusPending, created.Status)
+	require.Equal(t, "http://apple.pay.com?product=1", created.PayURL)
+	require.Equal(t, "/api/v1/payments/"+created.ID, rec.Header().Get("Location"))
+
+	rec = do(http.MethodGet, "/api/v1/payments/"+created.ID, "shop-key", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	got := &session.Session{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), got))
+	require.Equal(t, created, got)
+
+	rec = do(http.MethodPost, "/api/v1/payments", "shop-key", `{"product_id":"1","provider":"apay"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	got = &session.Session{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), got))
+	require.Equal(t, int64(999), got.Amount, "product price is used")
+	require.Equal(t, "USD", got.Currency)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		key    string
+		body   string
+		status int
+		want   *ErrorResponse
+	}{
+		{
+			name:   "session of other tenant",
+			method: http.MethodGet,
+			url:    "/api/v1/payments/" + created.ID,
+			key:    "games-key",
+			status: http.StatusNotFound,
+			want:   &ErrorResponse{Error: "payment session not found"},
+		},
+		{
+			name:   "unknown session",
+			method: http.MethodGet,
+			url:    "/api/v1/payments/pay_unknown",
+			key:    "shop-key",
+			status: http.StatusNotFound,
+			want:   &ErrorResponse{Error: "payment session not found"},
+		},
+		{
+			name:   "tenant provider isn't configured",
+			method: http.MethodPost,
+			url:    "/api/v1/payments",
+			key:    "games-key",
+			body:   `{"product_id":"1","amount":999,"currency":"USD","provider":"apay"}`,
+			status: http.StatusBadRequest,
+			want:   &ErrorResponse{Error: "unknown provider apay"},
+		},
+		{
+			name:   "unknown product",
+			method: http.MethodPost,
+			url:    "/api/v1/payments",
+			key:    "shop-key",
+			body:   `{"product_id":"404","provider":"apay"}`,
+			status: http.StatusNotFound,
+			want:   &ErrorResponse{Error: "product 404: product not found"},
+		},
+		{
+			name:   "unavailable product",
+			method: http.MethodPost,
+			url:    "/api/v1/payments",
+			key:    "shop-key",
+			body:   `{"product_id":"4","provider":"apay"}`,
+			status: http.StatusNotFound,
+			want:   &ErrorResponse{Error: "product 4: product is unavailable"},
+		},
+		{
+			name:   "amount doesn't match product price",
+			method: http.MethodPost,
+			url:    "/api/v1/payments",
+			key:    "shop-key",
+			body:   `{"product_id":"1","amount":1,"currency":"USD","provider":"apay"}`,
+			status: http.StatusBadRequest,
+			want:   &ErrorResponse{Error: "amount and currency should match product 1 price"},
+		},
+		{
+			name:   "invalid currency",
+			method: http.MethodPost,
+			url:    "/api/v1/payments",
+			key:    "shop-key",
+			body:   `{"product_id":"1","amount":999,"currency":"usd","provider":"apay"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unauthenticated",
+			method: http.MethodPost,
+			url:    "/api/v1/payments",
+			key:    "guess",
+			body:   `{"product_id":"1","amount":999,"currency":"USD","provider":"apay"}`,
+			status: http.StatusUnauthorized,
+			want:   &ErrorResponse{Error: "invalid api key"},
+		},
+	}
+	for _, tt := range tests {
+		rec := do(tt.method, tt.url, tt.key, tt.body)
+		require.Equal(t, tt.status, rec.Code, "%s: %s", tt.name, rec.Body.String())
+		if tt.want == nil {
+			continue
+		}
+		want, err := json.Marshal(tt.want)
+		require.NoError(t, err)
+		require.JSONEq(t, string(want), rec.Body.String(), tt.name)
+	}
+
+	mock.AssertExpectationsForObjects(t, apayMock)
+}
+
+func TestRouter_Refunds(t *testing.T) {
+	t.Parallel()
+
+	apayMock := &mocks.RefundProvider{}
+	apayMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com?product=1", nil)
+	apayMock.On("Refund", mock.Anything, mock.AnythingOfType("*providers.RefundRequest")).Return("are_1", nil).Twice()
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", apayMock))
+
+	resolver, err := tenant.NewResolver([]*tenant.Tenant{
+		{ID: "shop", APIKeys: []string{tenant.HashAPIKey("shop-key")}, Providers: reg},
+		{ID: "games", APIKeys: []string{tenant.HashAPIKey("games-key")}, Providers: reg},
+	}, "shop")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	sessions := session.NewService(session.NewMemoryRepository(), 0)
+	ps, err := sessions.Create(ctx, session.CreateRequest{
+		Tenant: "shop", ProductID: "1", Price: money.New(999, money.USD), Provider: "apay",
+	}, apayMock)
+	require.NoError(t, err)
+
+	r := newRouter(newTestLogger(), providers.NewRegistry(), NewHealthHandler(newTestLogger(), nil), Options{
+		Catalog:    newTestCatalog(t),
+		Validation: ValidationStrict,
+		Tenants:    resolver,
+		Sessions:   sessions,
+	})
+
+	do := func(key, idempotencyKey, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/"+ps.ID+"/refunds", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		if idempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("shop-key", "r0", `{"amount":100}`)
+	require.Equal(t, http.StatusConflict, rec.Code, "pending payment: %s", rec.Body.String())
+	_, err = sessions.Transition(ctx, ps.ID, session.StatusCaptured, "")
+	require.NoError(t, err)
+
+	rec = do("shop-key", "r1", `{"amount":300,"currency":"USD","reason":"damaged"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	require.Equal(t, "/api/v1/payments/"+ps.ID, rec.Header().Get("Location"))
+	refund := &session.Refund{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), refund))
+	require.Equal(t, session.RefundSucceeded, refund.Status)
+	require.Equal(t, int64(300), refund.Amount)
+	require.Equal(t, session.RefundIDFor(ps.ID, "r1"), refund.ID, "refund id is derived from idempotency key")
+
+	retry := do("shop-key", "r1", `{"amount":300,"currency":"USD","reason":"damaged"}`)
+	require.Equal(t, http.StatusCreated, retry.Code, retry.Body.String())
+	require.Equal(t, rec.Body.String(), retry.Body.String(), "payment isn't refunded twice")
+
+	tests := []struct {
+		name           string
+		key            string
+		idempotencyKey string
+		body           string
+		status         int
+	}{
+		{name: "exceeds captured amount", key: "shop-key", idempotencyKey: "r2", body: `{"amount":700}`, status: http.StatusUnprocessableEntity},
+		{name: "currency mismatch", key: "shop-key", idempotencyKey: "r3", body: `{"amount":100,"currency":"EUR"}`, status: http.StatusBadRequest},
+		{name: "negative amount", key: "shop-key", idempotencyKey: "r4", body: `{"amount":-1}`, status: http.StatusBadRequest},
+		{name: "missing idempotency key", key: "shop-key", body: `{"amount":100}`, status: http.StatusBadRequest},
+		{name: "session of other tenant", key: "games-key", idempotencyKey: "r5", body: `{"amount":100}`, status: http.StatusNotFound},
+		// default tenant serves anonymous payments requests, but not refunds
+		{name: "anonymous", idempotencyKey: "r6", body: `{"amount":100}`, status: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		rec := do(tt.key, tt.idempotencyKey, tt.body)
+		require.Equal(t, tt.status, rec.Code, "%s: %s", tt.name, rec.Body.String())
+	}
+
+	rec = do("shop-key", "r7", "")
+	require.Equal(t, http.StatusCreated, rec.Code, "amount left is refunded: %s", rec.Body.String())
+	rec = do("shop-key", "r8", "")
+	require.Equal(t, http.StatusConflict, rec.Code, "refunded payment: %s", rec.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/payments/"+ps.ID, nil)
+	req.Header.Set(APIKeyHeader, "shop-key")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	got := &session.Session{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), got))
+	require.Equal(t, session.StatusRefunded, got.Status)
+	require.Len(t, got.Refunds, 2)
+	require.Equal(t, session.StatusPartiallyRefunded, got.History[len(got.History)-2].To)
+	require.Equal(t, refund.ID, got.History[len(got.History)-2].Refund)
+
+	apayMock.AssertExpectations(t)
+}
+
+func TestRouter_RefundPending(t *testing.T) {
+	t.Parallel()
+
+	apayMock := &mocks.RefundProvider{}
+	apayMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com?product=1", nil)
+	apayMock.On("Refund", mock.Anything, mock.AnythingOfType("*providers.RefundRequest")).
+		Return("", errors.Wrap(providers.ErrInternalProvider, "timeout")).Once()
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", apayMock))
+
+	resolver, err := tenant.NewResolver([]*tenant.Tenant{
+		{ID: "shop", APIKeys: []string{tenant.HashAPIKey("shop-key")}, Providers: reg},
+	}, "")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	sessions := session.NewService(session.NewMemoryRepository(), 0)
+	ps, err := sessions.Create(ctx, session.CreateRequest{
+		Tenant: "shop", ProductID: "1", Price: money.New(999, money.USD), Provider: "apay",
+	}, apayMock)
+	require.NoError(t, err)
+	_, err = sessions.Transition(ctx, ps.ID, session.StatusCaptured, "")
+	require.NoError(t, err)
+
+	r := newRouter(newTestLogger(), providers.NewRegistry(), NewHealthHandler(newTestLogger(), nil), Options{
+		Catalog:    newTestCatalog(t),
+		Validation: ValidationStrict,
+		Tenants:    resolver,
+		Sessions:   sessions,
+	})
+
+	do := func(idempotencyKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/"+ps.ID+"/refunds", strings.NewReader(`{"amount":300}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(APIKeyHeader, "shop-key")
+		if idempotencyKey != "" {
+			req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// refund without key couldn't be retried if it stays pending, so it isn't created
+	rec := do("")
+	require.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	got, err := sessions.Get(ctx, ps.ID)
+	require.NoError(t, err)
+	require.Empty(t, got.Refunds)
+	require.Equal(t, int64(999), got.Refundable())
+
+	rec = do("r1")
+	require.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	refund := &session.Refund{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), refund))
+	require.Equal(t, session.RefundPending, refund.Status)
+	require.Equal(t, providers.ClassInternalError, refund.Error)
+
+	got, err = sessions.Get(ctx, ps.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(699), got.Refundable(), "pending refund amount is reserved")
+	apayMock.AssertExpectations(t)
+}
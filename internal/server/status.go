@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers/breaker"
+)
+
+// StatusResponse providers circuit breakers status by provider name
+type StatusResponse struct {
+	Providers map[string]breaker.Status `json:"providers"`
+}
+
+// StatusHandler providers status handler
+type StatusHandler struct {
+	l        *logrus.Logger
+	breakers []*breaker.Breaker
+}
+
+// NewStatusHandler construct providers status handler
+func NewStatusHandler(l *logrus.Logger, breakers []*breaker.Breaker) *StatusHandler {
+	return &StatusHandler{l: l, breakers: breakers}
+}
+
+// GetProvidersStatus return providers circuit breakers status
+func (sh *StatusHandler) GetProvidersStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusForbidden)
+		if err := json.NewEncoder(w).Encode(&ErrorResponse{
+			Error: "Only GET method supported",
+		}); err != nil {
+			sh.l.Error(err.Error())
+		}
+		return
+	}
+
+	res := &StatusResponse{Providers: make(map[string]breaker.Status, len(sh.breakers))}
+	for _, b := range sh.breakers {
+		res.Providers[b.Name()] = b.Status()
+	}
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		sh.l.Error(err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// tenantMiddleware is a middleware handler that resolves request tenant
+// and puts it to request context with tenant field added to request scoped logger
+type tenantMiddleware struct {
+	handler  http.Handler
+	resolver *tenant.Resolver
+}
+
+// ServeHTTP handles the request passing resolved tenant in context.
+// Authenticated request tenant is the one its credentials belong to.
+// Request is passed without tenant if it matches no one, routes requiring tenant reject it
+func (tm *tenantMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		t   *tenant.Tenant
+		err error
+	)
+	if id, ok := IdentityFromContext(r.Context()); ok {
+		if t, ok = tm.resolver.Get(id.Tenant); !ok {
+			err = errors.Wrapf(tenant.ErrUnknownTenant, "identity tenant %s", id.Tenant)
+		}
+	} else {
+		t, err = tm.resolver.Resolve(r)
+	}
+	if err != nil {
+		utils.Logger(r.Context()).WithError(err).Debug("tenant isn't resolved")
+		tm.handler.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := tenant.WithTenant(r.Context(), t)
+	ctx = utils.WithLogger(ctx, utils.Logger(ctx).WithField("tenant", t.ID))
+	tm.handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// newTenantMiddleware constructs a new tenantMiddleware middleware handler
+func newTenantMiddleware(h http.Handler, r *tenant.Resolver) *tenantMiddleware {
+	return &tenantMiddleware{handler: h, resolver: r}
+}
+
+// requireTenant wrap handler to reject requests without tenant with Forbidden
+func requireTenant(h http.HandlerFunc, l *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := tenant.FromContext(r.Context()); ok {
+			h(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		if err := json.NewEncoder(w).Encode(&ErrorResponse{
+			Error: "unknown tenant",
+		}); err != nil {
+			l.Error(err.Error())
+		}
+	}
+}
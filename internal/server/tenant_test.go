@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/fallback"
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/tenant"
+)
+
+func TestRouter_Tenants(t *testing.T) {
+	t.Parallel()
+
+	shopMock := &mocks.Provider{}
+	shopMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com/shop?product=1", nil).Once()
+	shopReg := providers.NewRegistry()
+	require.NoError(t, shopReg.Register("apay", shopMock))
+
+	gamesReg := providers.NewRegistry()
+	require.NoError(t, gamesReg.Register("apay", &mocks.Provider{}, providers.PlatformIOS))
+
+	gamesStores := &fallback.Config{
+		DefaultApp: "games",
+		Apps:       map[string]*fallback.App{"games": {URLs: fallback.URLs{GoogleURL: "https://play.google.com/store/apps/details?id=games"}}},
+	}
+	resolver, err := tenant.NewResolver([]*tenant.Tenant{
+		{ID: "shop", APIKeys: []string{tenant.HashAPIKey("shop-key")}, Providers: shopReg},
+		{ID: "games", Hosts: []string{"games.example.com"}, StoreURLs: gamesStores, Providers: gamesReg},
+	}, "")
+	require.NoError(t, err)
+
+	r := newRouter(newTestLogger(), providers.NewRegistry(), NewHealthHandler(newTestLogger(), nil), Options{
+		Catalog:    newTestCatalog(t),
+		Validation: ValidationStrict,
+		Tenants:    resolver,
+	})
+
+	tests := []struct {
+		name   string
+		host   string
+		key    string
+		url    string
+		status int
+		want   interface{}
+	}{
+		{
+			name:   "api key tenant providers",
+			host:   "games.example.com",
+			key:    "shop-key",
+			url:    "/api/v1/payments/urls?productID=1",
+			status: http.StatusOK,
+			want: &Response{
+				Type:        responseTypePaymentURLs,
+				ApplePayURL: "http://apple.pay.com/shop?product=1",
+				URLs:        map[string]string{"apay": "http://apple.pay.com/shop?product=1"},
+			},
+		},
+		{
+			name:   "host tenant store urls",
+			host:   "games.example.com",
+			url:    "/api/v1/payments/urls?productID=1&platform=android",
+			status: http.StatusOK,
+			want:   &AppURLResponse{Type: responseTypeAppURLs, Platform: "android", GoogleAppURL: "https://play.google.com/store/apps/details?id=games"},
+		},
+		{
+			name:   "invalid api key",
+			host:   "games.example.com",
+			key:    "guess",
+			url:    "/api/v1/payments/urls?productID=1",
+			status: http.StatusUnauthorized,
+			want:   &ErrorResponse{Error: "invalid api key"},
+		},
+		{
+			name:   "unknown tenant",
+			host:   "localhost",
+			url:    "/api/v1/payments/urls?productID=1",
+			status: http.StatusForbidden,
+			want:   &ErrorResponse{Error: "unknown tenant"},
+		},
+		{
+			name:   "tenant isn't required",
+			host:   "localhost",
+			url:    "/healthz",
+			status: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		req.Host = tt.host
+		if tt.key != "" {
+			req.Header.Set(APIKeyHeader, tt.key)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		require.Equal(t, tt.status, rec.Code, "%s: %s", tt.name, rec.Body.String())
+		if tt.want == nil {
+			continue
+		}
+		want, err := json.Marshal(tt.want)
+		require.NoError(t, err)
+		require.JSONEq(t, string(want), rec.Body.String(), tt.name)
+	}
+
+	mock.AssertExpectationsForObjects(t, shopMock)
+}
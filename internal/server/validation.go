@@ -0,0 +1,620 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// ValidationMode requests and responses validation against OpenAPISpec mode
+type ValidationMode string
+
+const (
+	// ValidationOff requests and responses aren't validated
+	ValidationOff ValidationMode = "off"
+	// ValidationLog spec violations are logged only
+	ValidationLog ValidationMode = "log"
+	// ValidationStrict invalid requests are rejected with BadRequest
+	// and invalid responses are replaced with InternalServer error. Intended for tests
+	ValidationStrict ValidationMode = "strict"
+)
+
+// Valid check that validation mode is known
+func (vm ValidationMode) Valid() bool {
+	switch vm {
+	case ValidationOff, ValidationLog, ValidationStrict:
+		return true
+	default:
+		return false
+	}
+}
+
+// apiSpec parsed OpenAPISpec subset used for validation
+type apiSpec struct {
+	Paths      map[string]map[string]*apiOperation `json:"paths"`
+	Components struct {
+		Responses map[string]*apiResponse `json:"responses"`
+		Schemas   map[string]*apiSchema   `json:"schemas"`
+	} `json:"components"`
+}
+
+// apiOperation path operation
+type apiOperation struct {
+	Parameters  []*apiParameter         `json:"parameters"`
+	RequestBody *apiRequestBody         `json:"requestBody"`
+	Responses   map[string]*apiResponse `json:"responses"`
+}
+
+// apiRequestBody operation request body
+type apiRequestBody struct {
+	Required bool          `json:"required"`
+	Content  apiMediaTypes `json:"content"`
+}
+
+// apiParameter operation parameter
+type apiParameter struct {
+	Name     string     `json:"name"`
+	In       string     `json:"in"`
+	Required bool       `json:"required"`
+	Schema   *apiSchema `json:"schema"`
+}
+
+// apiResponse operation response
+type apiResponse struct {
+	Ref     string        `json:"$ref"`
+	Content apiMediaTypes `json:"content"`
+}
+
+// apiMediaTypes request or response body schemas by media type
+type apiMediaTypes map[string]struct {
+	Schema *apiSchema `json:"schema"`
+}
+
+// apiSchema json schema subset of OpenAPI
+type apiSchema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Enum                 []interface{}         `json:"enum"`
+	MinLength            *int                  `json:"minLength"`
+	MaxLength            *int                  `json:"maxLength"`
+	Pattern              string                `json:"pattern"`
+	Minimum              *float64              `json:"minimum"`
+	Maximum              *float64              `json:"maximum"`
+	Required             []string              `json:"required"`
+	Properties           map[string]*apiSchema `json:"properties"`
+	AdditionalProperties *additionalProperties `json:"additionalProperties"`
+	Items                *apiSchema            `json:"items"`
+	OneOf                []*apiSchema          `json:"oneOf"`
+	Nullable             bool                  `json:"nullable"`
+	Discriminator        *struct {
+		PropertyName string            `json:"propertyName"`
+		Mapping      map[string]string `json:"mapping"`
+	} `json:"discriminator"`
+
+	pattern *regexp.Regexp
+}
+
+// UnmarshalJSON decode schema compiling its pattern
+func (s *apiSchema) UnmarshalJSON(b []byte) error {
+	type schema apiSchema
+	if err := json.Unmarshal(b, (*schema)(s)); err != nil {
+		return err
+	}
+
+	if s.Pattern != "" {
+		p, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid schema pattern %q", s.Pattern)
+		}
+		s.pattern = p
+	}
+	return nil
+}
+
+// additionalProperties either boolean or schema of object additional properties
+type additionalProperties struct {
+	denied bool
+	schema *apiSchema
+}
+
+// UnmarshalJSON decode boolean or schema
+func (ap *additionalProperties) UnmarshalJSON(b []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(b, &allowed); err == nil {
+		ap.denied = !allowed
+		return nil
+	}
+
+	ap.schema = &apiSchema{}
+	return json.Unmarshal(b, ap.schema)
+}
+
+// spec payments API spec. OpenAPISpec is a constant so it's checked once on start
+var spec = mustLoadAPISpec(OpenAPISpec)
+
+// mustLoadAPISpec parse OpenAPI document or panic
+func mustLoadAPISpec(doc string) *apiSpec {
+	s := &apiSpec{}
+	if err := json.Unmarshal([]byte(doc), s); err != nil {
+		panic(errors.Wrap(err, "invalid OpenAPI spec"))
+	}
+	return s
+}
+
+// operation find operation by request method and path. Path templates like /items/{id} are supported
+func (s *apiSpec) operation(method, path string) *apiOperation {
+	if ops, ok := s.Paths[path]; ok {
+		return ops[strings.ToLower(method)]
+	}
+
+	for tmpl, ops := range s.Paths {
+		if matchPath(tmpl, path) {
+			return ops[strings.ToLower(method)]
+		}
+	}
+	return nil
+}
+
+// matchPath check that path matches template
+func matchPath(tmpl, path string) bool {
+	ts := strings.Split(strings.Trim(tmpl, "/"), "/")
+	ps := strings.Split(strings.Trim(path, "/"), "/")
+	if len(ts) != len(ps) {
+		return false
+	}
+
+	for i := range ts {
+		if strings.HasPrefix(ts[i], "{") && strings.HasSuffix(ts[i], "}") {
+			if ps[i] == "" {
+				return false
+			}
+			continue
+		}
+		if ts[i] != ps[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// validateRequest check request query and header parameters and json body.
+// Unknown query parameters are violations too. Request body is restored to be read by handler
+func (s *apiSpec) validateRequest(op *apiOperation, r *http.Request) error {
+	q := r.URL.Query()
+	known := make(map[string]bool, len(op.Parameters))
+	for _, p := range op.Parameters {
+		var (
+			v  string
+			ok bool
+		)
+		switch p.In {
+		case "query":
+			known[p.Name] = true
+			if vs, exists := q[p.Name]; exists && len(vs) != 0 {
+				v, ok = vs[0], true
+			}
+		case "header":
+			v = r.Header.Get(p.Name)
+			ok = v != ""
+		default:
+			continue
+		}
+
+		if !ok {
+			if p.Required {
+				return errors.Errorf("%s parameter %s is required", p.In, p.Name)
+			}
+			continue
+		}
+
+		if err := s.validateParameter(p, v); err != nil {
+			return errors.Wrapf(err, "%s parameter %s", p.In, p.Name)
+		}
+	}
+
+	unknown := make([]string, 0)
+	for name := range q {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("unknown query parameters: %s", strings.Join(unknown, ", "))
+	}
+
+	if op.RequestBody == nil {
+		return nil
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read request body")
+	}
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			return errors.New("request body is required")
+		}
+		return nil
+	}
+
+	return s.validateBody(op.RequestBody.Content, r.Header, body, "request body")
+}
+
+// validateParameter convert raw parameter value to schema type and validate it
+func (s *apiSpec) validateParameter(p *apiParameter, raw string) error {
+	sch := s.resolveSchema(p.Schema)
+	if sch == nil {
+		return nil
+	}
+
+	var v interface{} = raw
+	switch sch.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return errors.Errorf("should be %s", sch.Type)
+		}
+		v = json.Number(raw)
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("should be boolean")
+		}
+		v = b
+	}
+
+	return s.validateValue(sch, v, "value")
+}
+
+// validateResponse check that response status is documented and body matches its schema
+func (s *apiSpec) validateResponse(op *apiOperation, status int, h http.Header, body []byte) error {
+	res, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if res, ok = op.Responses["default"]; !ok {
+			return errors.Errorf("undocumented response status %d", status)
+		}
+	}
+	res = s.resolveResponse(res)
+	if res == nil || len(res.Content) == 0 {
+		return nil
+	}
+
+	return s.validateBody(res.Content, h, body, "body")
+}
+
+// validateBody check that body content type is documented and json body matches its schema
+func (s *apiSpec) validateBody(content apiMediaTypes, h http.Header, body []byte, path string) error {
+	ct, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return errors.Wrapf(err, "%s: invalid content type %q", path, h.Get("Content-Type"))
+	}
+	mt, ok := content[ct]
+	if !ok {
+		return errors.Errorf("%s: undocumented content type %q", path, ct)
+	}
+	if ct != "application/json" || mt.Schema == nil {
+		return nil
+	}
+
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return errors.Wrapf(err, "%s: invalid json", path)
+	}
+
+	return s.validateValue(mt.Schema, v, path)
+}
+
+// resolveResponse follow response reference
+func (s *apiSpec) resolveResponse(res *apiResponse) *apiResponse {
+	if res == nil || res.Ref == "" {
+		return res
+	}
+	return s.Components.Responses[strings.TrimPrefix(res.Ref, "#/components/responses/")]
+}
+
+// resolveSchema follow schema reference
+func (s *apiSpec) resolveSchema(sch *apiSchema) *apiSchema {
+	if sch == nil || sch.Ref == "" {
+		return sch
+	}
+	return s.Components.Schemas[strings.TrimPrefix(sch.Ref, "#/components/schemas/")]
+}
+
+// validateValue check decoded json value against schema. path is used in errors to point to invalid value
+func (s *apiSpec) validateValue(sch *apiSchema, v interface{}, path string) error {
+	sch = s.resolveSchema(sch)
+	if sch == nil {
+		return errors.Errorf("%s: unresolved schema reference", path)
+	}
+
+	if v == nil {
+		if sch.Nullable {
+			return nil
+		}
+		return errors.Errorf("%s: should not be null", path)
+	}
+
+	if len(sch.OneOf) != 0 {
+		return s.validateOneOf(sch, v, path)
+	}
+
+	if len(sch.Enum) != 0 && !inEnum(sch.Enum, v) {
+		return errors.Errorf("%s: %v isn't one of %v", path, v, sch.Enum)
+	}
+
+	switch sch.Type {
+	case "":
+		return nil
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return errors.Errorf("%s: should be string", path)
+		}
+		return validateString(sch, str, path)
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return errors.Errorf("%s: should be %s", path, sch.Type)
+		}
+		return validateNumber(sch, n, path)
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return errors.Errorf("%s: should be boolean", path)
+		}
+		return nil
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return errors.Errorf("%s: should be array", path)
+		}
+		if sch.Items == nil {
+			return nil
+		}
+		for i, item := range items {
+			if err := s.validateValue(sch.Items, item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("%s: should be object", path)
+		}
+		return s.validateObject(sch, obj, path)
+	default:
+		return errors.Errorf("%s: unsupported schema type %q", path, sch.Type)
+	}
+}
+
+// validateOneOf check that value matches exactly one schema. Discriminator picks schema if any
+func (s *apiSpec) validateOneOf(sch *apiSchema, v interface{}, path string) error {
+	if d := sch.Discriminator; d != nil {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return errors.Errorf("%s: should be object", path)
+		}
+		kind, _ := obj[d.PropertyName].(string)
+		ref, ok := d.Mapping[kind]
+		if !ok {
+			return errors.Errorf("%s.%s: unknown discriminator value %q", path, d.PropertyName, kind)
+		}
+		return s.validateValue(&apiSchema{Ref: ref}, v, path)
+	}
+
+	matched := 0
+	for _, one := range sch.OneOf {
+		if s.validateValue(one, v, path) == nil {
+			matched++
+		}
+	}
+	if matched != 1 {
+		return errors.Errorf("%s: should match exactly one schema, matched %d", path, matched)
+	}
+	return nil
+}
+
+// validateObject check required, declared and additional properties
+func (s *apiSpec) validateObject(sch *apiSchema, obj map[string]interface{}, path string) error {
+	for _, name := range sch.Required {
+		if _, ok := obj[name]; !ok {
+			return errors.Errorf("%s.%s: is required", path, name)
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := path + "." + name
+		if ps, ok := sch.Properties[name]; ok {
+			if err := s.validateValue(ps, obj[name], p); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ap := sch.AdditionalProperties
+		switch {
+		case ap == nil:
+		case ap.denied:
+			return errors.Errorf("%s: unknown property", p)
+		case ap.schema != nil:
+			if err := s.validateValue(ap.schema, obj[name], p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateString check string length, pattern and format
+func validateString(sch *apiSchema, v, path string) error {
+	if sch.MinLength != nil && len(v) < *sch.MinLength {
+		return errors.Errorf("%s: should be at least %d characters", path, *sch.MinLength)
+	}
+	if sch.MaxLength != nil && len(v) > *sch.MaxLength {
+		return errors.Errorf("%s: should be at most %d characters", path, *sch.MaxLength)
+	}
+	if sch.pattern != nil && !sch.pattern.MatchString(v) {
+		return errors.Errorf("%s: should match %s", path, sch.Pattern)
+	}
+
+	switch sch.Format {
+	case "uri":
+		u, err := url.Parse(v)
+		if err != nil || u.Scheme == "" {
+			return errors.Errorf("%s: should be absolute uri", path)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			return errors.Errorf("%s: should be RFC3339 date-time", path)
+		}
+	}
+	return nil
+}
+
+// validateNumber check number type and bounds
+func validateNumber(sch *apiSchema, v json.Number, path string) error {
+	if sch.Type == "integer" {
+		if _, err := v.Int64(); err != nil {
+			return errors.Errorf("%s: should be integer", path)
+		}
+	}
+
+	f, err := v.Float64()
+	if err != nil {
+		return errors.Errorf("%s: should be number", path)
+	}
+	if sch.Minimum != nil && f < *sch.Minimum {
+		return errors.Errorf("%s: should be at least %v", path, *sch.Minimum)
+	}
+	if sch.Maximum != nil && f > *sch.Maximum {
+		return errors.Errorf("%s: should be at most %v", path, *sch.Maximum)
+	}
+	return nil
+}
+
+// inEnum check that value is one of enum values. Numbers are compared by their string form
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if e == v {
+			return true
+		}
+		if n, ok := v.(json.Number); ok {
+			if f, ok := e.(float64); ok && strconv.FormatFloat(f, 'f', -1, 64) == n.String() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bufferedResponse is a middleware response writer to hold response until it's validated
+type bufferedResponse struct {
+	http.ResponseWriter
+
+	status int
+	ok     bool
+	body   bytes.Buffer
+}
+
+// WriteHeader remember status code
+func (br *bufferedResponse) WriteHeader(statusCode int) {
+	if !br.ok {
+		br.status = statusCode
+		br.ok = true
+	}
+}
+
+// Write buffer response body
+func (br *bufferedResponse) Write(b []byte) (int, error) {
+	br.ok = true
+	return br.body.Write(b)
+}
+
+// validationMiddleware is a middleware handler that validates requests and responses against OpenAPISpec
+type validationMiddleware struct {
+	handler http.Handler
+	logger  *logrus.Logger
+	strict  bool
+}
+
+// ServeHTTP validate request, pass it to the real handler and validate its response.
+// Spec violations are logged and in strict mode replace handler response with error
+func (vm *validationMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	op := spec.operation(r.Method, r.URL.Path)
+	if op == nil {
+		vm.handler.ServeHTTP(w, r)
+		return
+	}
+
+	l := utils.Logger(r.Context())
+	if err := spec.validateRequest(op, r); err != nil {
+		l.WithError(err).Warn("request doesn't match api spec")
+		// body isn't restored for handler if it's too large
+		if errors.Cause(err) == errBodyTooLarge {
+			vm.writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if vm.strict {
+			vm.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	br := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+	vm.handler.ServeHTTP(br, r)
+
+	if err := spec.validateResponse(op, br.status, w.Header(), br.body.Bytes()); err != nil {
+		l.WithError(err).Error("response doesn't match api spec")
+		if vm.strict {
+			vm.writeError(w, http.StatusInternalServerError, "response doesn't match api spec: "+err.Error())
+			return
+		}
+	}
+
+	w.WriteHeader(br.status)
+	if _, err := w.Write(br.body.Bytes()); err != nil {
+		vm.logger.Error(err.Error())
+	}
+}
+
+// writeError write error response
+func (vm *validationMiddleware) writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&ErrorResponse{
+		Error: msg,
+	}); err != nil {
+		vm.logger.Error(err.Error())
+	}
+}
+
+// newValidationMiddleware constructs a new validationMiddleware middleware handler
+func newValidationMiddleware(h http.Handler, l *logrus.Logger, strict bool) *validationMiddleware {
+	return &validationMiddleware{
+		handler: h,
+		logger:  l,
+		strict:  strict,
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/breaker"
+)
+
+func TestValidationMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		body   string
+		strict bool
+		want   int
+	}{
+		{
+			name:   "valid",
+			url:    "/api/v1/payments/urls?productID=1",
+			status: http.StatusOK,
+			body:   `{"type":"payment_urls","urls":{"apay":"http://apple.pay.com/payfor?product=1"}}`,
+			strict: true,
+			want:   http.StatusOK,
+		},
+		{
+			name:   "missing query param",
+			url:    "/api/v1/payments/urls",
+			strict: true,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "unknown query param",
+			url:    "/api/v1/payments/urls?productID=1&orderID=2",
+			strict: true,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "unknown discriminator",
+			url:    "/api/v1/payments/urls?productID=1",
+			status: http.StatusOK,
+			body:   `{"urls":{}}`,
+			strict: true,
+			want:   http.StatusInternalServerError,
+		},
+		{
+			name:   "invalid url",
+			url:    "/api/v1/payments/urls?productID=1",
+			status: http.StatusOK,
+			body:   `{"type":"app_urls","apple_url":"store","google_url":"http://google.store.com/myApp"}`,
+			strict: true,
+			want:   http.StatusInternalServerError,
+		},
+		{
+			name:   "undocumented status",
+			url:    "/api/v1/payments/urls?productID=1",
+			status: http.StatusTeapot,
+			body:   `{"error":"teapot"}`,
+			strict: true,
+			want:   http.StatusInternalServerError,
+		},
+		{
+			name:   "violations are logged only",
+			url:    "/api/v1/payments/urls?orderID=2",
+			status: http.StatusTeapot,
+			body:   `{"error":"teapot"}`,
+			want:   http.StatusTeapot,
+		},
+		{
+			name:   "unknown path",
+			url:    "/unknown",
+			status: http.StatusNotFound,
+			body:   "404 page not found",
+			strict: true,
+			want:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		h := newValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(tt.status)
+			_, _ = w.Write([]byte(tt.body))
+		}), newTestLogger(), tt.strict)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		require.Equal(t, tt.want, rec.Code, tt.name)
+		if tt.want == tt.status {
+			require.Equal(t, tt.body, rec.Body.String(), tt.name)
+		}
+	}
+}
+
+func TestValidationMiddleware_BodyTooLarge(t *testing.T) {
+	t.Parallel()
+
+	called := false
+	h := newValidationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}), newTestLogger(), false)
+
+	// unauthenticated route isn't buffered over limit even if violations are logged only
+	body := `{"event_id":"` + strings.Repeat("a", maxSignedBodySize) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/apay", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	require.False(t, called)
+}
+
+// TestRouter_OpenAPISpec check that every endpoint conforms to OpenAPISpec
+func TestRouter_OpenAPISpec(t *testing.T) {
+	t.Parallel()
+
+	aMock := &mocks.Provider{}
+	gMock := &mocks.Provider{}
+	aMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com/payfor?product=1", nil)
+	gMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://google.pay.com/payfor?product=1", nil)
+	aMock.On("GetPayURL", mock.Anything, productPayment("2")).Return("", errors.Wrap(providers.ErrNotOK, "bad product"))
+	gMock.On("GetPayURL", mock.Anything, productPayment("2")).Return("http://google.pay.com/payfor?product=2", nil)
+	aMock.On("GetPayURL", mock.Anything, productPayment("3")).Return("", errors.New("boom"))
+	gMock.On("GetPayURL", mock.Anything, productPayment("3")).Return("", errors.New("boom"))
+
+	reg := providers.NewRegistry()
+	require.NoError(t, reg.Register("apay", aMock))
+	require.NoError(t, reg.Register("gpay", gMock))
+	ab := breaker.New("apay", aMock, breaker.Config{}, newTestLogger())
+
+	for _, partial := range []bool{false, true} {
+		hh := NewHealthHandler(newTestLogger(), []*breaker.Breaker{ab})
+		r := newRouter(newTestLogger(), reg, hh, Options{
+			Catalog:          newTestCatalog(t),
+			PartialResponses: partial,
+			Breakers:         []*breaker.Breaker{ab},
+			Validation:       ValidationStrict,
+		})
+
+		tests := []struct {
+			url  string
+			want int
+		}{
+			{url: "/api/v1/payments/urls?productID=1", want: http.StatusOK},
+			{url: "/api/v1/payments/urls?productID=2", want: http.StatusOK},
+			{url: "/api/v1/payments/urls?productID=1&platform=ios", want: http.StatusOK},
+			{url: "/api/v1/payments/urls?productID=3", want: http.StatusInternalServerError},
+			{url: "/api/v1/payments/urls?productID=", want: http.StatusBadRequest},
+			{url: "/api/v1/providers/status", want: http.StatusOK},
+			{url: "/api/v1/openapi.json", want: http.StatusOK},
+			{url: "/healthz", want: http.StatusOK},
+			{url: "/readyz", want: http.StatusServiceUnavailable},
+			{url: "/metrics", want: http.StatusOK},
+		}
+		for _, tt := range tests {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			require.Equal(t, tt.want, rec.Code, "%s partial=%v: %s", tt.url, partial, rec.Body.String())
+
+			if tt.want == http.StatusInternalServerError {
+				res := &ErrorResponse{}
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(res))
+				require.NotContains(t, res.Error, "api spec", tt.url)
+			}
+		}
+	}
+}
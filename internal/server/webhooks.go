@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// webhooksPath payment providers webhooks route, provider name follows it
+const webhooksPath = "/api/v1/webhooks/"
+
+// DefaultWebhookMaxSkew default max difference between webhook signature timestamp and server time
+const DefaultWebhookMaxSkew = 5 * time.Minute
+
+// errors returned to provider when webhook is rejected
+var (
+	errWebhookExpired  = errors.New("webhook timestamp is outside of allowed window")
+	errWebhookReplayed = errors.New("webhook event is already processed")
+)
+
+// WebhooksHandler payment providers webhooks handler
+type WebhooksHandler struct {
+	l         *logrus.Logger
+	verifiers map[string]providers.WebhookVerifier
+	sessions  *session.Service
+	events    *nonceCache
+	maxSkew   time.Duration
+	now       func() time.Time
+}
+
+// WebhookResponse processed webhook result
+type WebhookResponse struct {
+	SessionID string         `json:"session_id"`
+	Status    session.Status `json:"status"`
+}
+
+// NewWebhooksHandler construct handler of webhooks of providers with verifiers.
+// Webhooks signature timestamps may differ from server time by maxSkew, DefaultWebhookMaxSkew is used if 0
+func NewWebhooksHandler(l *logrus.Logger, verifiers map[string]providers.WebhookVerifier, s *session.Service, maxSkew time.Duration) *WebhooksHandler {
+	if maxSkew <= 0 {
+		maxSkew = DefaultWebhookMaxSkew
+	}
+	return &WebhooksHandler{
+		l:         l,
+		verifiers: verifiers,
+		sessions:  s,
+		events:    newNonceCache(),
+		maxSkew:   maxSkew,
+		now:       time.Now,
+	}
+}
+
+// Receive verify provider webhook and move payment session to reported status.
+// Events are processed once, replayed events and events signed outside of allowed window are rejected
+func (h *WebhooksHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusForbidden, "Only POST method supported")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, webhooksPath)
+	v, ok := h.verifiers[name]
+	if !ok {
+		h.writeError(w, http.StatusNotFound, "unknown provider "+name)
+		return
+	}
+
+	l := utils.Logger(r.Context()).WithField("provider", name)
+	body, err := readBody(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ev, err := v.ParseWebhook(r, body)
+	switch {
+	case errors.Is(err, providers.ErrInvalidWebhookSignature):
+		l.WithError(err).Warn("webhook rejected")
+		h.writeError(w, http.StatusUnauthorized, providers.ErrInvalidWebhookSignature.Error())
+		return
+	case err != nil:
+		l.WithError(err).Warn("webhook rejected")
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := h.now()
+	if ev.Timestamp.Before(now.Add(-h.maxSkew)) || ev.Timestamp.After(now.Add(h.maxSkew)) {
+		l.WithField("event_id", ev.ID).Warn("webhook rejected: " + errWebhookExpired.Error())
+		h.writeError(w, http.StatusUnauthorized, errWebhookExpired.Error())
+		return
+	}
+
+	// events older than window are rejected, so event id is kept while its timestamp is inside
+	key := name + ":" + ev.ID
+	if !h.events.add(key, now, ev.Timestamp.Add(h.maxSkew)) {
+		l.WithField("event_id", ev.ID).Warn("webhook rejected: " + errWebhookReplayed.Error())
+		h.writeError(w, http.StatusConflict, errWebhookReplayed.Error())
+		return
+	}
+
+	ps, err := h.sessions.ApplyEvent(r.Context(), ev)
+	if err != nil {
+		switch errors.Cause(err) {
+		case session.ErrInvalidTransition:
+			h.writeError(w, http.StatusConflict, err.Error())
+		case session.ErrNotFound:
+			h.events.remove(key)
+			h.writeError(w, http.StatusNotFound, session.ErrNotFound.Error())
+		default:
+			// event isn't applied, let provider retry it
+			h.events.remove(key)
+			h.writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&WebhookResponse{
+		SessionID: ps.ID,
+		Status:    ps.Status,
+	}); err != nil {
+		h.l.Error(err.Error())
+	}
+}
+
+// writeError write error response with status
+func (h *WebhooksHandler) writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&ErrorResponse{
+		Error: msg,
+	}); err != nil {
+		h.l.Error(err.Error())
+	}
+}
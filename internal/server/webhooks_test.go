@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/apay"
+	"github.com/fedoseev-vitaliy/payments/internal/providers/gpay"
+	"github.com/fedoseev-vitaliy/payments/internal/session"
+)
+
+func TestRouter_Webhooks(t *testing.T) {
+	t.Parallel()
+
+	apayMock := &mocks.Provider{}
+	apayMock.On("GetPayURL", mock.Anything, productPayment("1")).Return("http://apple.pay.com?product=1", nil)
+	sessions := session.NewService(session.NewMemoryRepository(), 0)
+	ps, err := sessions.Create(context.Background(), session.CreateRequest{
+		Tenant: "default", ProductID: "1", Price: money.New(999, money.USD), Provider: "apay",
+	}, apayMock)
+	require.NoError(t, err)
+
+	r := newRouter(newTestLogger(), providers.NewRegistry(), NewHealthHandler(newTestLogger(), nil), Options{
+		Catalog:    newTestCatalog(t),
+		Validation: ValidationStrict,
+		Sessions:   sessions,
+		Webhooks: map[string]providers.WebhookVerifier{
+			"apay": apay.NewWebhookVerifier("apay-secret"),
+			"gpay": gpay.NewWebhookVerifier("gpay-secret"),
+		},
+	})
+
+	apayHooks := &apay.MockAPay{WebhookSecret: "apay-secret"}
+	gpayHooks := &gpay.MockGPay{WebhookSecret: "gpay-secret"}
+	now := time.Now()
+	tests := []struct {
+		name    string
+		webhook func() (*http.Request, error)
+		status  int
+		want    interface{}
+	}{
+		{
+			name: "authorized",
+			webhook: func() (*http.Request, error) {
+				return apayHooks.NewWebhook("/api/v1/webhooks/apay", &providers.Event{ID: "evt_1", Type: providers.EventAuthorized, SessionID: ps.ID, Timestamp: now})
+			},
+			status: http.StatusOK,
+			want:   &WebhookResponse{SessionID: ps.ID, Status: session.StatusAuthorized},
+		},
+		{
+			name: "replayed",
+			webhook: func() (*http.Request, error) {
+				return apayHooks.NewWebhook("/api/v1/webhooks/apay", &providers.Event{ID: "evt_1", Type: providers.EventAuthorized, SessionID: ps.ID, Timestamp: now})
+			},
+			status: http.StatusConflict,
+			want:   &ErrorResponse{Error: "webhook event is already processed"},
+		},
+		{
+			name: "expired",
+			webhook: func() (*http.Request, error) {
+				return apayHooks.NewWebhook("/api/v1/webhooks/apay", &providers.Event{ID: "evt_2", Type: providers.EventCaptured, SessionID: ps.ID, Timestamp: now.Add(-10 * time.Minute)})
+			},
+			status: http.StatusUnauthorized,
+			want:   &ErrorResponse{Error: "webhook timestamp is outside of allowed window"},
+		},
+		{
+			name: "signed by other provider secret",
+			webhook: func() (*http.Request, error) {
+				return (&apay.MockAPay{WebhookSecret: "gpay-secret"}).NewWebhook("/api/v1/webhooks/apay", &providers.Event{ID: "evt_3", Type: providers.EventCaptured, SessionID: ps.ID, Timestamp: now})
+			},
+			status: http.StatusUnauthorized,
+			want:   &ErrorResponse{Error: "invalid webhook signature"},
+		},
+		{
+			name: "session of other provider",
+			webhook: func() (*http.Request, error) {
+				return gpayHooks.NewWebhook("/api/v1/webhooks/gpay", &providers.Event{ID: "evt_4", Type: providers.EventCaptured, SessionID: ps.ID, Timestamp: now})
+			},
+			status: http.StatusNotFound,
+			want:   &ErrorResponse{Error: "payment session not found"},
+		},
+		{
+			name: "captured",
+			webhook: func() (*http.Request, error) {
+				return apayHooks.NewWebhook("/api/v1/webhooks/apay", &providers.Event{ID: "evt_5", Type: providers.EventCaptured, SessionID: ps.ID, Timestamp: now})
+			},
+			status: http.StatusOK,
+			want:   &WebhookResponse{SessionID: ps.ID, Status: session.StatusCaptured},
+		},
+		{
+			name: "final session",
+			webhook: func() (*http.Request, error) {
+				return apayHooks.NewWebhook("/api/v1/webhooks/apay", &providers.Event{ID: "evt_6", Type: providers.EventFailed, SessionID: ps.ID, Timestamp: now})
+			},
+			status: http.StatusConflict,
+		},
+		{
+			name: "unknown provider",
+			webhook: func() (*http.Request, error) {
+				return apayHooks.NewWebhook("/api/v1/webhooks/paypal", &providers.Event{ID: "evt_7", Type: providers.EventFailed, SessionID: ps.ID, Timestamp: now})
+			},
+			status: http.StatusNotFound,
+			want:   &ErrorResponse{Error: "unknown provider paypal"},
+		},
+	}
+	for _, tt := range tests {
+		req, err := tt.webhook()
+		require.NoError(t, err, tt.name)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+
+		require.Equal(t, tt.status, rec.Code, "%s: %s", tt.name, rec.Body.String())
+		if tt.want == nil {
+			continue
+		}
+		want, err := json.Marshal(tt.want)
+		require.NoError(t, err)
+		require.JSONEq(t, string(want), rec.Body.String(), tt.name)
+	}
+
+	got, err := sessions.Get(context.Background(), ps.ID)
+	require.NoError(t, err)
+	require.Equal(t, session.StatusCaptured, got.Status)
+	require.Equal(t, "evt_5", got.History[len(got.History)-1].Event)
+}
@@ -0,0 +1,169 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxRecordSize max size of session snapshot line
+const maxRecordSize = 1 << 20
+
+// FileRepository payment sessions storage persisted to append-only file of JSON lines.
+// Every change appends session snapshot, sessions are kept in memory and file is compacted to the latest snapshots on open
+type FileRepository struct {
+	path string
+
+	mu  sync.Mutex
+	mem *MemoryRepository
+	f   *os.File
+}
+
+// OpenFileRepository load sessions from file creating it if there is no one.
+// Truncated last line left by crash is dropped
+func OpenFileRepository(path string) (*FileRepository, error) {
+	r := &FileRepository{path: path, mem: NewMemoryRepository()}
+	if err := r.load(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := r.compact(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	r.f = f
+	return r, nil
+}
+
+// load read sessions snapshots, the latest snapshot of session wins
+func (r *FileRepository) load() error {
+	f, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxRecordSize)
+	var broken error
+	for line := 1; sc.Scan(); line++ {
+		if broken != nil {
+			return broken
+		}
+
+		s := &Session{}
+		if err := json.Unmarshal(sc.Bytes(), s); err != nil {
+			// only the last line may be broken by interrupted write
+			broken = errors.Wrapf(err, "%s:%d", r.path, line)
+			continue
+		}
+		r.mem.sessions[s.ID] = s
+	}
+	return errors.WithStack(sc.Err())
+}
+
+// compact rewrite file with the latest sessions snapshots
+func (r *FileRepository) compact() error {
+	sessions := make([]*Session, 0, len(r.mem.sessions))
+	for _, s := range r.mem.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	tmp := r.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, s := range sessions {
+		if err := enc.Encode(s); err != nil {
+			f.Close()
+			return errors.WithStack(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return errors.WithStack(err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(os.Rename(tmp, r.path))
+}
+
+// append write session snapshot to file
+func (r *FileRepository) append(s *Session) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := r.f.Write(append(b, '\n')); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(r.f.Sync())
+}
+
+// Create store session once its snapshot is written to file
+func (r *FileRepository) Create(ctx context.Context, s *Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.mem.Get(ctx, s.ID); err == nil {
+		return errors.Wrapf(ErrExists, "session %s", s.ID)
+	}
+	if err := r.append(s); err != nil {
+		return errors.WithStack(err)
+	}
+	return r.mem.Create(ctx, s)
+}
+
+// Get return stored session
+func (r *FileRepository) Get(ctx context.Context, id string) (*Session, error) {
+	return r.mem.Get(ctx, id)
+}
+
+// Update apply update to stored session and store result once its snapshot is written to file
+func (r *FileRepository) Update(ctx context.Context, id string, update func(s *Session) error) (*Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.mem.Update(ctx, id, func(s *Session) error {
+		if err := update(s); err != nil {
+			return err
+		}
+		return r.append(s)
+	})
+}
+
+// Close close file
+func (r *FileRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return errors.WithStack(r.f.Close())
+}
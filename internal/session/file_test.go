@@ -0,0 +1,90 @@
+package session
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRepository(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "sessions")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sessions.jsonl")
+
+	ctx := context.Background()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	r, err := OpenFileRepository(path)
+	require.NoError(t, err)
+
+	s := &Session{ID: "pay_1", Tenant: "shop", Status: StatusCreated, CreatedAt: now, History: []Transition{}}
+	require.NoError(t, r.Create(ctx, s))
+	require.Equal(t, ErrExists, errors.Cause(r.Create(ctx, s)))
+	_, err = r.Update(ctx, "pay_1", func(s *Session) error {
+		s.PayURL = "http://apple.pay.com?product=1"
+		return s.Transition(StatusPending, now, "")
+	})
+	require.NoError(t, err)
+	_, err = r.Update(ctx, "pay_1", func(s *Session) error {
+		return s.Transition(StatusCaptured, now, "")
+	})
+	require.NoError(t, err)
+
+	// failed update isn't stored
+	_, err = r.Update(ctx, "pay_1", func(s *Session) error {
+		return s.Transition(StatusPending, now, "")
+	})
+	require.Equal(t, ErrInvalidTransition, errors.Cause(err))
+	require.NoError(t, r.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 3, strings.Count(string(b), "\n"))
+
+	// interrupted write leaves broken last line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"id":"pay_2","sta`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	r, err = OpenFileRepository(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	got, err := r.Get(ctx, "pay_1")
+	require.NoError(t, err)
+	require.Equal(t, StatusCaptured, got.Status)
+	require.Equal(t, "http://apple.pay.com?product=1", got.PayURL)
+	require.Len(t, got.History, 2)
+
+	_, err = r.Get(ctx, "pay_2")
+	require.Equal(t, ErrNotFound, errors.Cause(err))
+
+	// file is compacted to the latest snapshots
+	b, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(b), "\n"))
+}
+
+func TestOpenFileRepository_Broken(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "sessions")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sessions.jsonl")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("{broken\n{\"id\":\"pay_1\"}\n"), 0o600))
+	_, err = OpenFileRepository(path)
+	require.Error(t, err)
+}
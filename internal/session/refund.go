@@ -0,0 +1,111 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RefundStatus payment refund status
+type RefundStatus string
+
+// refund statuses
+const (
+	// RefundPending refund amount is reserved, provider isn't answered yet or its outcome is unknown,
+	// e.g. provider timed out. Refund is retried by its id
+	RefundPending RefundStatus = "pending"
+	// RefundSucceeded provider refunded payment, final
+	RefundSucceeded RefundStatus = "succeeded"
+	// RefundFailed provider rejected refund or wasn't called, refund amount is released, final
+	RefundFailed RefundStatus = "failed"
+)
+
+// refundTransitions allowed refund status transitions
+var refundTransitions = map[RefundStatus][]RefundStatus{
+	RefundPending: {RefundSucceeded, RefundFailed},
+}
+
+var (
+	// ErrNotRefundable returned when session payment isn't captured or is refunded already
+	ErrNotRefundable = errors.New("payment isn't refundable")
+	// ErrRefundExceeded returned when refunds total would exceed captured amount
+	ErrRefundExceeded = errors.New("refund exceeds captured amount")
+)
+
+// CanTransition check that refund status can move to another one
+func (s RefundStatus) CanTransition(to RefundStatus) bool {
+	for _, st := range refundTransitions[s] {
+		if st == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Refund refund of session payment
+type Refund struct {
+	ID string `json:"id"`
+	// Amount in currency minor units, e.g. cents
+	Amount   int64        `json:"amount"`
+	Currency string       `json:"currency"`
+	Reason   string       `json:"reason,omitempty"`
+	Status   RefundStatus `json:"status"`
+	// ProviderRefundID refund id returned by provider
+	ProviderRefundID string `json:"provider_refund_id,omitempty"`
+	// Error why refund failed, provider error class
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RefundIDFor return refund id derived from session id and client idempotency key,
+// so retries of refund request refund payment once
+func RefundIDFor(sessionID, key string) string {
+	sum := sha256.Sum256([]byte(sessionID + "\n" + key))
+	return "re_" + hex.EncodeToString(sum[:16])
+}
+
+// Transition move refund to status at now
+func (r *Refund) Transition(to RefundStatus, now time.Time) error {
+	if !r.Status.CanTransition(to) {
+		return errors.Wrapf(ErrInvalidTransition, "refund %s to %s", r.Status, to)
+	}
+
+	r.Status = to
+	r.UpdatedAt = now
+	return nil
+}
+
+// Refundable return session amount which isn't refunded or reserved by pending refunds yet
+func (s *Session) Refundable() int64 {
+	left := s.Amount
+	for _, r := range s.Refunds {
+		if r.Status != RefundFailed {
+			left -= r.Amount
+		}
+	}
+	return left
+}
+
+// Refunded return session amount refunded by succeeded refunds
+func (s *Session) Refunded() int64 {
+	var total int64
+	for _, r := range s.Refunds {
+		if r.Status == RefundSucceeded {
+			total += r.Amount
+		}
+	}
+	return total
+}
+
+// Refund return session refund by id
+func (s *Session) Refund(id string) (*Refund, bool) {
+	for _, r := range s.Refunds {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,60 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefund_Transition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		from RefundStatus
+		to   RefundStatus
+		err  error
+	}{
+		{name: "pending to succeeded", from: RefundPending, to: RefundSucceeded},
+		{name: "pending to failed", from: RefundPending, to: RefundFailed},
+		{name: "succeeded is final", from: RefundSucceeded, to: RefundFailed, err: ErrInvalidTransition},
+		{name: "failed is final", from: RefundFailed, to: RefundSucceeded, err: ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		r := &Refund{Status: tt.from}
+
+		err := r.Transition(tt.to, now)
+		require.Equal(t, tt.err, errors.Cause(err), tt.name)
+		if tt.err != nil {
+			require.Equal(t, tt.from, r.Status, tt.name)
+			continue
+		}
+		require.Equal(t, tt.to, r.Status, tt.name)
+		require.Equal(t, now, r.UpdatedAt, tt.name)
+	}
+}
+
+func TestSession_Refundable(t *testing.T) {
+	t.Parallel()
+
+	s := &Session{Amount: 1000, Refunds: []*Refund{
+		{ID: "re_1", Amount: 100, Status: RefundSucceeded},
+		{ID: "re_2", Amount: 200, Status: RefundPending},
+		{ID: "re_3", Amount: 400, Status: RefundFailed},
+	}}
+	require.Equal(t, int64(700), s.Refundable(), "pending refunds reserve amount")
+	require.Equal(t, int64(100), s.Refunded())
+
+	c := s.Clone()
+	c.Refunds[1].Status = RefundSucceeded
+	require.Equal(t, RefundPending, s.Refunds[1].Status, "refunds are copied")
+
+	r, ok := s.Refund("re_3")
+	require.True(t, ok)
+	require.Equal(t, int64(400), r.Amount)
+	_, ok = s.Refund("re_4")
+	require.False(t, ok)
+}
@@ -0,0 +1,71 @@
+package session
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Repository payment sessions storage
+type Repository interface {
+	// Create store new session. ErrExists is returned if session id is taken
+	Create(ctx context.Context, s *Session) error
+	// Get return session by id. ErrNotFound is returned if there is no one
+	Get(ctx context.Context, id string) (*Session, error)
+	// Update apply update to stored session atomically and store result unless update failed
+	Update(ctx context.Context, id string, update func(s *Session) error) (*Session, error)
+}
+
+// MemoryRepository in-memory payment sessions storage. Sessions are lost on restart
+type MemoryRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewMemoryRepository construct empty in-memory repository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{sessions: make(map[string]*Session)}
+}
+
+// Create store copy of session
+func (r *MemoryRepository) Create(_ context.Context, s *Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[s.ID]; ok {
+		return errors.Wrapf(ErrExists, "session %s", s.ID)
+	}
+	r.sessions[s.ID] = s.Clone()
+	return nil
+}
+
+// Get return copy of stored session
+func (r *MemoryRepository) Get(_ context.Context, id string) (*Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "session %s", id)
+	}
+	return s.Clone(), nil
+}
+
+// Update apply update to copy of stored session and store it if update succeeded
+func (r *MemoryRepository) Update(_ context.Context, id string, update func(s *Session) error) (*Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFound, "session %s", id)
+	}
+
+	c := s.Clone()
+	if err := update(c); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	r.sessions[id] = c
+	return c.Clone(), nil
+}
@@ -0,0 +1,360 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/utils"
+)
+
+// DefaultTTL default time to complete payment session
+const DefaultTTL = 15 * time.Minute
+
+// expiredReason transition reason of sessions not completed in time
+const expiredReason = "not completed in time"
+
+// eventStatuses session statuses providers events move sessions to
+var eventStatuses = map[providers.EventType]Status{
+	providers.EventAuthorized: StatusAuthorized,
+	providers.EventCaptured:   StatusCaptured,
+	providers.EventFailed:     StatusFailed,
+}
+
+// CreateRequest new payment session parameters
+type CreateRequest struct {
+	Tenant    string
+	ProductID string
+	Price     money.Money
+	Provider  string
+	// Description product description passed to provider
+	Description string
+}
+
+// Validate check session parameters
+func (r *CreateRequest) Validate() error {
+	switch {
+	case r.ProductID == "":
+		return errors.New("product id is required")
+	case r.Price.Amount() <= 0:
+		return errors.New("amount should be positive")
+	case !r.Price.Currency().Valid():
+		return errors.Wrapf(money.ErrUnknownCurrency, "%q", r.Price.Currency())
+	case r.Provider == "":
+		return errors.New("provider is required")
+	}
+	return nil
+}
+
+// RefundRequest session payment refund parameters
+type RefundRequest struct {
+	// ID refund id, required. Refund with the same id is refunded once, its pending refund is retried by provider
+	// with the same id, see RefundIDFor
+	ID string
+	// Amount in currency minor units, e.g. cents. Amount left to refund is refunded if 0
+	Amount int64
+	// Currency session currency is used if empty, otherwise it should match it
+	Currency string
+	Reason   string
+}
+
+// Listener is notified of session status changes with changed session
+type Listener func(ctx context.Context, s *Session)
+
+// Service payment sessions lifecycle
+type Service struct {
+	repo      Repository
+	ttl       time.Duration
+	now       func() time.Time
+	listeners []Listener
+}
+
+// NewService construct payment sessions service. Sessions not completed in ttl expire, DefaultTTL is used if 0
+func NewService(repo Repository, ttl time.Duration) *Service {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Service{repo: repo, ttl: ttl, now: time.Now}
+}
+
+// OnTransition register listener of sessions status changes. Listeners are called synchronously
+// after change is stored, so they should not block. Register listeners before service is used
+func (s *Service) OnTransition(l Listener) {
+	s.listeners = append(s.listeners, l)
+}
+
+// notify call listeners with changed session
+func (s *Service) notify(ctx context.Context, ps *Session) {
+	for _, l := range s.listeners {
+		l(ctx, ps.Clone())
+	}
+}
+
+// Create store new session and get pay url of product from provider.
+// Session moves to pending with pay url or fails if provider failed
+func (s *Service) Create(ctx context.Context, req CreateRequest, p providers.Provider) (*Session, error) {
+	if err := req.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	id, err := NewID()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	now := s.now().UTC()
+	ps := &Session{
+		ID:        id,
+		Tenant:    req.Tenant,
+		ProductID: req.ProductID,
+		Amount:    req.Price.Amount(),
+		Currency:  string(req.Price.Currency()),
+		Provider:  req.Provider,
+		Status:    StatusCreated,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+		History:   []Transition{},
+	}
+	if err := s.repo.Create(ctx, ps); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	l := utils.Logger(ctx).WithField("session_id", id)
+	u, perr := p.GetPayURL(ctx, &providers.PaymentRequest{
+		ProductID:   req.ProductID,
+		Price:       req.Price,
+		Description: req.Description,
+		Reference:   id,
+	})
+	ps, err = s.repo.Update(ctx, id, func(ps *Session) error {
+		if perr != nil {
+			return ps.Transition(StatusFailed, s.now().UTC(), providers.ErrorClass(perr))
+		}
+
+		ps.PayURL = u
+		return ps.Transition(StatusPending, s.now().UTC(), "")
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if perr != nil {
+		l.WithError(perr).Warn("payment session failed")
+	} else {
+		l.Info("payment session created")
+	}
+	s.notify(ctx, ps)
+	return ps, nil
+}
+
+// Get return session by id. Session not completed in time is expired
+func (s *Service) Get(ctx context.Context, id string) (*Session, error) {
+	ps, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !ps.Expired(s.now()) {
+		return ps, nil
+	}
+
+	expired := false
+	ps, err = s.repo.Update(ctx, id, func(ps *Session) error {
+		now := s.now().UTC()
+		// session may be completed concurrently
+		if !ps.Expired(now) {
+			return nil
+		}
+		expired = true
+		return ps.Transition(StatusExpired, now, expiredReason)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if expired {
+		s.notify(ctx, ps)
+	}
+	return ps, nil
+}
+
+// Transition move session to status. ErrInvalidTransition is returned if session can't move to status
+func (s *Service) Transition(ctx context.Context, id string, to Status, reason string) (*Session, error) {
+	ps, err := s.repo.Update(ctx, id, func(ps *Session) error {
+		return ps.Transition(to, s.now().UTC(), reason)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	utils.Logger(ctx).WithFields(logrus.Fields{
+		"session_id": id,
+		"status":     to,
+	}).Info("payment session status changed")
+	s.notify(ctx, ps)
+	return ps, nil
+}
+
+// ApplyEvent move session to status reported by provider event. ErrNotFound is returned
+// if session doesn't exist or is paid by another provider
+func (s *Service) ApplyEvent(ctx context.Context, ev *providers.Event) (*Session, error) {
+	to, ok := eventStatuses[ev.Type]
+	if !ok {
+		return nil, errors.Errorf("unknown event type %q", ev.Type)
+	}
+
+	ps, err := s.repo.Update(ctx, ev.SessionID, func(ps *Session) error {
+		if ps.Provider != ev.Provider {
+			return errors.Wrapf(ErrNotFound, "session %s of provider %s", ps.ID, ev.Provider)
+		}
+		if err := ps.Transition(to, s.now().UTC(), ev.Reason); err != nil {
+			return err
+		}
+		ps.History[len(ps.History)-1].Event = ev.ID
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	utils.Logger(ctx).WithFields(logrus.Fields{
+		"session_id": ev.SessionID,
+		"status":     to,
+		"event_id":   ev.ID,
+	}).Info("payment session status changed by provider event")
+	s.notify(ctx, ps)
+	return ps, nil
+}
+
+// Refund refund captured session payment by provider. Refund amount is reserved before provider is called,
+// so refunds total never exceeds captured amount. Session moves to partially refunded or refunded once
+// provider refunded payment, refund rejected by provider releases its amount. Refund stays pending with
+// amount reserved if provider outcome is unknown, e.g. provider timed out, request with its id retries it.
+// Finished refund with request id is returned as is. ErrNotRefundable or ErrRefundExceeded
+// is returned if payment can't be refunded by amount
+func (s *Service) Refund(ctx context.Context, id string, req RefundRequest, p providers.Provider) (*Session, *Refund, error) {
+	if req.Amount < 0 {
+		return nil, nil, errors.New("amount should be positive")
+	}
+	// pending refund is finished by retry with its id only, so refund without id may stay pending forever
+	if req.ID == "" {
+		return nil, nil, errors.New("refund id is required")
+	}
+
+	rid := req.ID
+
+	var retry *Refund
+	ps, err := s.repo.Update(ctx, id, func(ps *Session) error {
+		if rf, ok := ps.Refund(rid); ok {
+			retry = rf
+			return nil
+		}
+		if ps.Status != StatusCaptured && ps.Status != StatusPartiallyRefunded {
+			return errors.Wrapf(ErrNotRefundable, "session %s is %s", ps.ID, ps.Status)
+		}
+		if req.Currency != "" && req.Currency != ps.Currency {
+			return errors.Wrapf(money.ErrCurrencyMismatch, "refund in %s of payment in %s", req.Currency, ps.Currency)
+		}
+
+		left := ps.Refundable()
+		amount := req.Amount
+		if amount == 0 {
+			amount = left
+		}
+		switch {
+		case left == 0:
+			return errors.Wrapf(ErrNotRefundable, "session %s has no amount left to refund", ps.ID)
+		case amount > left:
+			return errors.Wrapf(ErrRefundExceeded, "refund of %d with %d left to refund", amount, left)
+		}
+
+		now := s.now().UTC()
+		ps.Refunds = append(ps.Refunds, &Refund{
+			ID:        rid,
+			Amount:    amount,
+			Currency:  ps.Currency,
+			Reason:    req.Reason,
+			Status:    RefundPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if retry != nil && retry.Status != RefundPending {
+		return ps, retry, nil
+	}
+
+	rf, _ := ps.Refund(rid)
+	raced := false
+	l := utils.Logger(ctx).WithFields(logrus.Fields{"session_id": id, "refund_id": rid})
+	pid, perr := providers.Refund(ctx, p, &providers.RefundRequest{
+		ID:        rid,
+		Reference: id,
+		Amount:    money.New(rf.Amount, money.Currency(rf.Currency)),
+		Reason:    rf.Reason,
+	})
+	ps, err = s.repo.Update(ctx, id, func(ps *Session) error {
+		rf, ok := ps.Refund(rid)
+		if !ok {
+			return errors.Errorf("refund %s of session %s not found", rid, ps.ID)
+		}
+		// concurrent retry finished refund already
+		if rf.Status != RefundPending {
+			raced = true
+			return nil
+		}
+
+		now := s.now().UTC()
+		switch {
+		case perr != nil && providers.NotExecuted(perr):
+			rf.Error = providers.ErrorClass(perr)
+			return rf.Transition(RefundFailed, now)
+		case perr != nil:
+			// provider may have refunded payment, amount stays reserved until refund is retried
+			rf.Error = providers.ErrorClass(perr)
+			rf.UpdatedAt = now
+			return nil
+		}
+
+		rf.ProviderRefundID = pid
+		rf.Error = ""
+		if err := rf.Transition(RefundSucceeded, now); err != nil {
+			return err
+		}
+		to := StatusPartiallyRefunded
+		if ps.Refunded() == ps.Amount {
+			to = StatusRefunded
+		}
+		if err := ps.Transition(to, now, rf.Reason); err != nil {
+			return err
+		}
+		ps.History[len(ps.History)-1].Refund = rid
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	rf, _ = ps.Refund(rid)
+	switch {
+	case raced:
+		return ps, rf, nil
+	case perr != nil && rf.Status == RefundPending:
+		l.WithError(perr).Warn("payment refund outcome is unknown, refund is pending")
+		return ps, rf, nil
+	case perr != nil:
+		l.WithError(perr).Warn("payment refund failed")
+		return ps, rf, nil
+	}
+
+	l.WithField("status", ps.Status).Info("payment refunded")
+	s.notify(ctx, ps)
+	return ps, rf, nil
+}
@@ -0,0 +1,238 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/mocks"
+	"github.com/fedoseev-vitaliy/payments/internal/money"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+)
+
+func TestService_Create(t *testing.T) {
+	t.Parallel()
+
+	req := CreateRequest{Tenant: "shop", ProductID: "1", Price: money.New(999, money.USD), Provider: "apay", Description: "Coins"}
+	tests := []struct {
+		name   string
+		url    string
+		err    error
+		status Status
+		reason string
+	}{
+		{name: "pending", url: "http://apple.pay.com?product=1", status: StatusPending},
+		{name: "provider failed", err: providers.ErrNotOK, status: StatusFailed, reason: providers.ClassNotOK},
+	}
+	for _, tt := range tests {
+		var payment *providers.PaymentRequest
+		p := &mocks.Provider{}
+		p.On("GetPayURL", mock.Anything, mock.AnythingOfType("*providers.PaymentRequest")).
+			Run(func(args mock.Arguments) { payment = args.Get(1).(*providers.PaymentRequest) }).
+			Return(tt.url, tt.err).Once()
+		s := NewService(NewMemoryRepository(), 0)
+
+		got, err := s.Create(context.Background(), req, p)
+		require.NoError(t, err, tt.name)
+		require.Equal(t, &providers.PaymentRequest{
+			ProductID:   "1",
+			Price:       money.New(999, money.USD),
+			Description: "Coins",
+			Reference:   got.ID,
+		}, payment, tt.name)
+		require.Equal(t, tt.status, got.Status, tt.name)
+		require.Equal(t, tt.url, got.PayURL, tt.name)
+		require.Equal(t, got.CreatedAt.Add(DefaultTTL), got.ExpiresAt, tt.name)
+		require.Len(t, got.History, 1, tt.name)
+		require.Equal(t, tt.reason, got.History[0].Reason, tt.name)
+
+		stored, err := s.Get(context.Background(), got.ID)
+		require.NoError(t, err, tt.name)
+		require.Equal(t, got, stored, tt.name)
+		p.AssertExpectations(t)
+	}
+
+	_, err := NewService(NewMemoryRepository(), 0).Create(context.Background(), CreateRequest{ProductID: "1", Price: money.New(1, "usd"), Provider: "apay"}, &mocks.Provider{})
+	require.Error(t, err)
+}
+
+func TestService_Expiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewService(NewMemoryRepository(), time.Minute)
+	s.now = func() time.Time { return now }
+	var changes []Status
+	s.OnTransition(func(_ context.Context, ps *Session) {
+		changes = append(changes, ps.Status)
+	})
+
+	p := &mocks.Provider{}
+	p.On("GetPayURL", mock.Anything, mock.Anything).Return("http://apple.pay.com?product=1", nil)
+	ctx := context.Background()
+	req := CreateRequest{Tenant: "shop", ProductID: "1", Price: money.New(999, money.USD), Provider: "apay"}
+
+	expiring, err := s.Create(ctx, req, p)
+	require.NoError(t, err)
+	authorized, err := s.Create(ctx, req, p)
+	require.NoError(t, err)
+	_, err = s.Transition(ctx, authorized.ID, StatusAuthorized, "")
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	got, err := s.Get(ctx, expiring.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusExpired, got.Status)
+	require.Equal(t, expiredReason, got.History[len(got.History)-1].Reason)
+
+	got, err = s.Get(ctx, authorized.ID)
+	require.NoError(t, err)
+	require.Equal(t, StatusAuthorized, got.Status)
+
+	_, err = s.Transition(ctx, expiring.ID, StatusCaptured, "")
+	require.Equal(t, ErrInvalidTransition, errors.Cause(err))
+	require.Equal(t, []Status{StatusPending, StatusPending, StatusAuthorized, StatusExpired}, changes)
+}
+
+func TestService_Refund(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewService(NewMemoryRepository(), 0)
+	var changes []Status
+	s.OnTransition(func(_ context.Context, ps *Session) {
+		changes = append(changes, ps.Status)
+	})
+
+	p := &mocks.RefundProvider{}
+	p.On("GetPayURL", mock.Anything, mock.Anything).Return("http://apple.pay.com?product=1", nil)
+	ps, err := s.Create(ctx, CreateRequest{Tenant: "shop", ProductID: "1", Price: money.New(999, money.USD), Provider: "apay"}, p)
+	require.NoError(t, err)
+
+	_, _, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1", Amount: 100}, p)
+	require.Equal(t, ErrNotRefundable, errors.Cause(err), "pending payment")
+	_, err = s.Transition(ctx, ps.ID, StatusCaptured, "")
+	require.NoError(t, err)
+
+	_, _, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1", Amount: 1000}, p)
+	require.Equal(t, ErrRefundExceeded, errors.Cause(err))
+	_, _, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1", Amount: 100, Currency: "EUR"}, p)
+	require.Equal(t, money.ErrCurrencyMismatch, errors.Cause(err))
+	_, _, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1", Amount: -1}, p)
+	require.Error(t, err)
+	_, _, err = s.Refund(ctx, ps.ID, RefundRequest{Amount: 100}, p)
+	require.Error(t, err, "refund id is required")
+	_, _, err = s.Refund(ctx, "pay_missing", RefundRequest{ID: "re_1"}, p)
+	require.Equal(t, ErrNotFound, errors.Cause(err))
+
+	var refund *providers.RefundRequest
+	p.On("Refund", mock.Anything, mock.AnythingOfType("*providers.RefundRequest")).
+		Run(func(args mock.Arguments) { refund = args.Get(1).(*providers.RefundRequest) }).
+		Return("are_1", nil).Once()
+	got, rf, err := s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1", Amount: 300, Reason: "damaged"}, p)
+	require.NoError(t, err)
+	require.Equal(t, &providers.RefundRequest{ID: rf.ID, Reference: ps.ID, Amount: money.New(300, money.USD), Reason: "damaged"}, refund)
+	require.Equal(t, RefundSucceeded, rf.Status)
+	require.Equal(t, "are_1", rf.ProviderRefundID)
+	require.Equal(t, StatusPartiallyRefunded, got.Status)
+	last := got.History[len(got.History)-1]
+	require.Equal(t, rf.ID, last.Refund)
+	require.Equal(t, "damaged", last.Reason)
+
+	p.On("Refund", mock.Anything, mock.Anything).Return("", providers.ErrNotOK).Once()
+	got, rf, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_2", Amount: 699}, p)
+	require.NoError(t, err)
+	require.Equal(t, RefundFailed, rf.Status)
+	require.Equal(t, providers.ClassNotOK, rf.Error)
+	require.Equal(t, StatusPartiallyRefunded, got.Status)
+	require.Equal(t, int64(699), got.Refundable(), "failed refund amount is released")
+
+	p.On("Refund", mock.Anything, mock.Anything).Return("are_2", nil).Once()
+	got, rf, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_3"}, p)
+	require.NoError(t, err)
+	require.Equal(t, int64(699), rf.Amount, "amount left is refunded")
+	require.Equal(t, StatusRefunded, got.Status)
+	require.Equal(t, int64(999), got.Refunded())
+	require.Len(t, got.Refunds, 3)
+
+	_, _, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_4"}, p)
+	require.Equal(t, ErrNotRefundable, errors.Cause(err), "refunded payment")
+
+	stored, err := s.Get(ctx, ps.ID)
+	require.NoError(t, err)
+	require.Equal(t, got, stored)
+	require.Equal(t, []Status{StatusPending, StatusCaptured, StatusPartiallyRefunded, StatusRefunded}, changes, "failed refund isn't notified")
+	p.AssertExpectations(t)
+}
+
+func TestService_RefundUnknownOutcome(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewService(NewMemoryRepository(), 0)
+	var changes []Status
+	s.OnTransition(func(_ context.Context, ps *Session) {
+		changes = append(changes, ps.Status)
+	})
+
+	p := &mocks.RefundProvider{}
+	p.On("GetPayURL", mock.Anything, mock.Anything).Return("http://apple.pay.com?product=1", nil)
+	ps, err := s.Create(ctx, CreateRequest{Tenant: "shop", ProductID: "1", Price: money.New(999, money.USD), Provider: "apay"}, p)
+	require.NoError(t, err)
+	_, err = s.Transition(ctx, ps.ID, StatusCaptured, "")
+	require.NoError(t, err)
+
+	// provider timed out, it may have refunded payment
+	var ids []string
+	p.On("Refund", mock.Anything, mock.AnythingOfType("*providers.RefundRequest")).
+		Run(func(args mock.Arguments) { ids = append(ids, args.Get(1).(*providers.RefundRequest).ID) }).
+		Return("", errors.Wrap(providers.ErrInternalProvider, "timeout")).Once()
+	got, rf, err := s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1", Amount: 300}, p)
+	require.NoError(t, err)
+	require.Equal(t, "re_1", rf.ID)
+	require.Equal(t, RefundPending, rf.Status)
+	require.Equal(t, providers.ClassInternalError, rf.Error)
+	require.Equal(t, int64(699), got.Refundable(), "pending refund amount is reserved")
+
+	// retry refunds by provider with the same id
+	p.On("Refund", mock.Anything, mock.AnythingOfType("*providers.RefundRequest")).
+		Run(func(args mock.Arguments) { ids = append(ids, args.Get(1).(*providers.RefundRequest).ID) }).
+		Return("are_1", nil).Once()
+	got, rf, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1", Amount: 300}, p)
+	require.NoError(t, err)
+	require.Equal(t, RefundSucceeded, rf.Status)
+	require.Empty(t, rf.Error)
+	require.Equal(t, StatusPartiallyRefunded, got.Status)
+	require.Equal(t, []string{"re_1", "re_1"}, ids)
+
+	// finished refund isn't refunded again
+	got, rf, err = s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1", Amount: 300}, p)
+	require.NoError(t, err)
+	require.Equal(t, RefundSucceeded, rf.Status)
+	require.Len(t, got.Refunds, 1)
+	require.Equal(t, []Status{StatusPending, StatusCaptured, StatusPartiallyRefunded}, changes)
+	p.AssertExpectations(t)
+}
+
+func TestService_RefundNotSupported(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewService(NewMemoryRepository(), 0)
+	p := &mocks.Provider{}
+	p.On("GetPayURL", mock.Anything, mock.Anything).Return("http://apple.pay.com?product=1", nil)
+	ps, err := s.Create(ctx, CreateRequest{Tenant: "shop", ProductID: "1", Price: money.New(999, money.USD), Provider: "apay"}, p)
+	require.NoError(t, err)
+	_, err = s.Transition(ctx, ps.ID, StatusCaptured, "")
+	require.NoError(t, err)
+
+	got, rf, err := s.Refund(ctx, ps.ID, RefundRequest{ID: "re_1"}, p)
+	require.NoError(t, err)
+	require.Equal(t, RefundFailed, rf.Status)
+	require.Equal(t, providers.ClassNotSupported, rf.Error)
+	require.Equal(t, StatusCaptured, got.Status)
+}
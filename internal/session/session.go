@@ -0,0 +1,138 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status payment session status
+type Status string
+
+// payment session statuses
+const (
+	// StatusCreated session is stored, provider isn't called yet
+	StatusCreated Status = "created"
+	// StatusPending client got provider pay url and is paying
+	StatusPending Status = "pending"
+	// StatusAuthorized provider authorized payment
+	StatusAuthorized Status = "authorized"
+	// StatusCaptured payment is captured, it may be refunded
+	StatusCaptured Status = "captured"
+	// StatusFailed provider call or payment failed, final
+	StatusFailed Status = "failed"
+	// StatusExpired session isn't paid in time, final
+	StatusExpired Status = "expired"
+	// StatusPartiallyRefunded part of captured amount is refunded, the rest may be refunded
+	StatusPartiallyRefunded Status = "partially_refunded"
+	// StatusRefunded the whole captured amount is refunded, final
+	StatusRefunded Status = "refunded"
+)
+
+// transitions allowed session status transitions
+var transitions = map[Status][]Status{
+	StatusCreated:    {StatusPending, StatusFailed, StatusExpired},
+	StatusPending:    {StatusAuthorized, StatusCaptured, StatusFailed, StatusExpired},
+	StatusAuthorized: {StatusCaptured, StatusFailed, StatusExpired},
+	// every partial refund is a transition, so refunds show up in history
+	StatusCaptured:          {StatusPartiallyRefunded, StatusRefunded},
+	StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+}
+
+var (
+	// ErrNotFound returned when session doesn't exist
+	ErrNotFound = errors.New("payment session not found")
+	// ErrExists returned when session with the same id is already stored
+	ErrExists = errors.New("payment session already exists")
+	// ErrInvalidTransition returned when session can't move to status from its current one
+	ErrInvalidTransition = errors.New("invalid payment session status transition")
+)
+
+// Final check that session can't change status anymore
+func (s Status) Final() bool {
+	return len(transitions[s]) == 0
+}
+
+// CanTransition check that status can move to another one
+func (s Status) CanTransition(to Status) bool {
+	for _, st := range transitions[s] {
+		if st == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition session status change
+type Transition struct {
+	From Status    `json:"from"`
+	To   Status    `json:"to"`
+	At   time.Time `json:"at"`
+	// Reason why status changed, e.g. provider error
+	Reason string `json:"reason,omitempty"`
+	// Event id of provider event caused transition
+	Event string `json:"event,omitempty"`
+	// Refund id of refund caused transition
+	Refund string `json:"refund,omitempty"`
+}
+
+// Session payment of product by provider
+type Session struct {
+	ID        string `json:"id"`
+	Tenant    string `json:"tenant"`
+	ProductID string `json:"product_id"`
+	// Amount in currency minor units, e.g. cents
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Provider string `json:"provider"`
+	Status   Status `json:"status"`
+	// PayURL provider pay url client is redirected to
+	PayURL    string       `json:"pay_url,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	History   []Transition `json:"history"`
+	Refunds   []*Refund    `json:"refunds,omitempty"`
+}
+
+// NewID generate random session id
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return "pay_" + hex.EncodeToString(b), nil
+}
+
+// Transition move session to status at now remembering transition in history
+func (s *Session) Transition(to Status, now time.Time, reason string) error {
+	if !s.Status.CanTransition(to) {
+		return errors.Wrapf(ErrInvalidTransition, "%s to %s", s.Status, to)
+	}
+
+	s.History = append(s.History, Transition{From: s.Status, To: to, At: now, Reason: reason})
+	s.Status = to
+	s.UpdatedAt = now
+	return nil
+}
+
+// Expired check that session isn't completed in time
+func (s *Session) Expired(now time.Time) bool {
+	return (s.Status == StatusCreated || s.Status == StatusPending) && !now.Before(s.ExpiresAt)
+}
+
+// Clone return deep copy of session
+func (s *Session) Clone() *Session {
+	c := *s
+	c.History = append([]Transition(nil), s.History...)
+	if s.Refunds != nil {
+		c.Refunds = make([]*Refund, len(s.Refunds))
+		for i, r := range s.Refunds {
+			rc := *r
+			c.Refunds[i] = &rc
+		}
+	}
+	return &c
+}
@@ -0,0 +1,72 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession_Transition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		from Status
+		to   Status
+		err  error
+	}{
+		{name: "created to pending", from: StatusCreated, to: StatusPending},
+		{name: "pending to authorized", from: StatusPending, to: StatusAuthorized},
+		{name: "authorized to captured", from: StatusAuthorized, to: StatusCaptured},
+		{name: "pending to expired", from: StatusPending, to: StatusExpired},
+		{name: "created to captured", from: StatusCreated, to: StatusCaptured, err: ErrInvalidTransition},
+		{name: "authorized to pending", from: StatusAuthorized, to: StatusPending, err: ErrInvalidTransition},
+		{name: "captured to partially refunded", from: StatusCaptured, to: StatusPartiallyRefunded},
+		{name: "partially refunded again", from: StatusPartiallyRefunded, to: StatusPartiallyRefunded},
+		{name: "partially refunded to refunded", from: StatusPartiallyRefunded, to: StatusRefunded},
+		{name: "captured can't fail", from: StatusCaptured, to: StatusFailed, err: ErrInvalidTransition},
+		{name: "pending to refunded", from: StatusPending, to: StatusRefunded, err: ErrInvalidTransition},
+		{name: "refunded is final", from: StatusRefunded, to: StatusPartiallyRefunded, err: ErrInvalidTransition},
+		{name: "expired is final", from: StatusExpired, to: StatusPending, err: ErrInvalidTransition},
+		{name: "same status", from: StatusPending, to: StatusPending, err: ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		s := &Session{Status: tt.from}
+
+		err := s.Transition(tt.to, now, "reason")
+		require.Equal(t, tt.err, errors.Cause(err), tt.name)
+		if tt.err != nil {
+			require.Equal(t, tt.from, s.Status, tt.name)
+			require.Empty(t, s.History, tt.name)
+			continue
+		}
+		require.Equal(t, tt.to, s.Status, tt.name)
+		require.Equal(t, now, s.UpdatedAt, tt.name)
+		require.Equal(t, []Transition{{From: tt.from, To: tt.to, At: now, Reason: "reason"}}, s.History, tt.name)
+	}
+}
+
+func TestSession_Expired(t *testing.T) {
+	t.Parallel()
+
+	exp := time.Date(2020, 1, 1, 0, 15, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status Status
+		now    time.Time
+		want   bool
+	}{
+		{name: "pending in time", status: StatusPending, now: exp.Add(-time.Second)},
+		{name: "pending late", status: StatusPending, now: exp, want: true},
+		{name: "authorized late", status: StatusAuthorized, now: exp.Add(time.Hour)},
+		{name: "captured late", status: StatusCaptured, now: exp.Add(time.Hour)},
+		{name: "partially refunded late", status: StatusPartiallyRefunded, now: exp.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		s := &Session{Status: tt.status, ExpiresAt: exp}
+		require.Equal(t, tt.want, s.Expired(tt.now), tt.name)
+	}
+}
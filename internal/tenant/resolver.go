@@ -0,0 +1,138 @@
+package tenant
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/notify"
+)
+
+// ErrUnknownTenant returned when request doesn't match any tenant and there is no default one
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// hmacKey tenant HMAC key
+type hmacKey struct {
+	tenant *Tenant
+	secret string
+}
+
+// Resolver select request tenant by credentials or host
+type Resolver struct {
+	tenants []*Tenant
+	ids     map[string]*Tenant
+	keys    map[string]*Tenant
+	hmac    map[string]hmacKey
+	hosts   map[string]*Tenant
+	def     *Tenant
+}
+
+// NewResolver construct resolver of tenants. Requests matching no tenant are served by tenant with def id.
+// Such requests are rejected if def is empty
+func NewResolver(tenants []*Tenant, def string) (*Resolver, error) {
+	r := &Resolver{
+		tenants: tenants,
+		ids:     make(map[string]*Tenant, len(tenants)),
+		keys:    make(map[string]*Tenant),
+		hmac:    make(map[string]hmacKey),
+		hosts:   make(map[string]*Tenant),
+	}
+
+	for _, t := range tenants {
+		if err := t.Validate(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if _, ok := r.ids[t.ID]; ok {
+			return nil, errors.Errorf("tenant %s is duplicated", t.ID)
+		}
+		r.ids[t.ID] = t
+
+		for _, k := range t.APIKeys {
+			if _, ok := r.keys[k]; ok {
+				return nil, errors.Errorf("tenant %s api key is used by another tenant", t.ID)
+			}
+			r.keys[k] = t
+		}
+
+		for id, secret := range t.HMACKeys {
+			if _, ok := r.hmac[id]; ok {
+				return nil, errors.Errorf("tenant %s hmac key %s is used by another tenant", t.ID, id)
+			}
+			r.hmac[id] = hmacKey{tenant: t, secret: secret}
+		}
+
+		for _, h := range t.Hosts {
+			h = strings.ToLower(h)
+			if _, ok := r.hosts[h]; ok {
+				return nil, errors.Errorf("tenant %s host %s is used by another tenant", t.ID, h)
+			}
+			r.hosts[h] = t
+		}
+	}
+
+	if def != "" {
+		t, ok := r.ids[def]
+		if !ok {
+			return nil, errors.Errorf("default tenant %s isn't configured", def)
+		}
+		r.def = t
+	}
+
+	return r, nil
+}
+
+// Tenants return configured tenants
+func (r *Resolver) Tenants() []*Tenant {
+	return r.tenants
+}
+
+// Get return tenant by id
+func (r *Resolver) Get(id string) (*Tenant, bool) {
+	t, ok := r.ids[id]
+	return t, ok
+}
+
+// APIKey return tenant of api key
+func (r *Resolver) APIKey(key string) (*Tenant, bool) {
+	t, ok := r.keys[HashAPIKey(key)]
+	return t, ok
+}
+
+// HMACKey return tenant and secret of HMAC key
+func (r *Resolver) HMACKey(id string) (*Tenant, string, bool) {
+	k, ok := r.hmac[id]
+	return k.tenant, k.secret, ok
+}
+
+// Subscriptions return webhooks subscriptions of tenant by id
+func (r *Resolver) Subscriptions(id string) []*notify.Subscription {
+	t, ok := r.ids[id]
+	if !ok {
+		return nil
+	}
+	return t.Webhooks
+}
+
+// Resolve return tenant of request host or default tenant.
+// Authenticated requests tenant is selected by credentials instead
+func (r *Resolver) Resolve(req *http.Request) (*Tenant, error) {
+	if t, ok := r.hosts[requestHost(req)]; ok {
+		return t, nil
+	}
+
+	if r.def == nil {
+		return nil, errors.Wrapf(ErrUnknownTenant, "host %s", requestHost(req))
+	}
+	return r.def, nil
+}
+
+// requestHost return lower cased request host without port
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,92 @@
+package tenant
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fedoseev-vitaliy/payments/internal/ratelimit"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	t.Parallel()
+
+	shop := &Tenant{ID: "shop", Hosts: []string{"Shop.example.com"}}
+	games := &Tenant{ID: "games", Hosts: []string{"games.example.com"}}
+
+	tests := []struct {
+		name string
+		def  string
+		host string
+		want *Tenant
+		err  error
+	}{
+		{name: "host", host: "games.example.com", want: games},
+		{name: "host with port", host: "shop.example.com:8080", want: shop},
+		{name: "default", def: "games", host: "localhost", want: games},
+		{name: "unknown host", host: "localhost", err: ErrUnknownTenant},
+	}
+	for _, tt := range tests {
+		r, err := NewResolver([]*Tenant{shop, games}, tt.def)
+		require.NoError(t, err, tt.name)
+
+		req := httptest.NewRequest("GET", "/api/v1/payments/urls", nil)
+		req.Host = tt.host
+
+		got, err := r.Resolve(req)
+		require.Equal(t, tt.err, errors.Cause(err), tt.name)
+		require.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestResolver_Credentials(t *testing.T) {
+	t.Parallel()
+
+	secret := "0123456789abcdef0123456789abcdef"
+	shop := &Tenant{ID: "shop", APIKeys: []string{HashAPIKey("shop-key")}, HMACKeys: map[string]string{"shop-1": secret}}
+	r, err := NewResolver([]*Tenant{shop}, "")
+	require.NoError(t, err)
+
+	got, ok := r.APIKey("shop-key")
+	require.True(t, ok)
+	require.Equal(t, shop, got)
+	_, ok = r.APIKey(HashAPIKey("shop-key"))
+	require.False(t, ok, "hash isn't a key")
+
+	got, s, ok := r.HMACKey("shop-1")
+	require.True(t, ok)
+	require.Equal(t, shop, got)
+	require.Equal(t, secret, s)
+	_, _, ok = r.HMACKey("games-1")
+	require.False(t, ok)
+}
+
+func TestNewResolver(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		tenants []*Tenant
+		def     string
+	}{
+		{name: "duplicated id", tenants: []*Tenant{{ID: "shop"}, {ID: "shop"}}},
+		{name: "shared host", tenants: []*Tenant{{ID: "shop", Hosts: []string{"example.com"}}, {ID: "games", Hosts: []string{"EXAMPLE.com"}}}},
+		{name: "shared api key", tenants: []*Tenant{{ID: "shop", APIKeys: []string{HashAPIKey("key")}}, {ID: "games", APIKeys: []string{HashAPIKey("key")}}}},
+		{name: "plain api key", tenants: []*Tenant{{ID: "shop", APIKeys: []string{"key"}}}},
+		{name: "short hmac secret", tenants: []*Tenant{{ID: "shop", HMACKeys: map[string]string{"shop-1": "secret"}}}},
+		{name: "shared hmac key", tenants: []*Tenant{
+			{ID: "shop", HMACKeys: map[string]string{"key-1": "0123456789abcdef0123456789abcdef"}},
+			{ID: "games", HMACKeys: map[string]string{"key-1": "fedcba9876543210fedcba9876543210"}},
+		}},
+		{name: "invalid id", tenants: []*Tenant{{ID: "Shop!"}}},
+		{name: "unknown feature", tenants: []*Tenant{{ID: "shop", Features: map[string]bool{"refunds": true}}}},
+		{name: "negative rate limit", tenants: []*Tenant{{ID: "shop", RateLimit: ratelimit.Config{RPS: -1}}}},
+		{name: "unknown default", tenants: []*Tenant{{ID: "shop"}}, def: "games"},
+	}
+	for _, tt := range tests {
+		_, err := NewResolver(tt.tenants, tt.def)
+		require.Error(t, err, tt.name)
+	}
+}
@@ -0,0 +1,142 @@
+package tenant
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/fedoseev-vitaliy/payments/internal/fallback"
+	"github.com/fedoseev-vitaliy/payments/internal/notify"
+	"github.com/fedoseev-vitaliy/payments/internal/providers"
+	"github.com/fedoseev-vitaliy/payments/internal/ratelimit"
+)
+
+// DefaultID id of tenant serving every request when tenants aren't configured
+const DefaultID = "default"
+
+// features tenant could enable
+const (
+	// FeaturePartialResponses return urls of succeeded providers even if other providers failed
+	FeaturePartialResponses = "partial_responses"
+)
+
+// knownFeatures features accepted in tenant config
+var knownFeatures = map[string]bool{
+	FeaturePartialResponses: true,
+}
+
+// idRe tenant id is used in logs and metrics labels
+var idRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// apiKeyHashRe hex encoded sha256 of api key
+var apiKeyHashRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// minHMACSecretLen min length of HMAC secret
+const minHMACSecretLen = 32
+
+// Tenant merchant served by the service with its own providers and settings
+type Tenant struct {
+	ID string `json:"id"`
+	// Hosts request hosts selecting tenant
+	Hosts []string `json:"hosts,omitempty"`
+	// APIKeys hex encoded sha256 of api keys selecting tenant. Keys themselves are never stored
+	APIKeys []string `json:"api_keys,omitempty"`
+	// HMACKeys secrets of HMAC signed requests selecting tenant by key id
+	HMACKeys  map[string]string `json:"hmac_keys,omitempty"`
+	StoreURLs *fallback.Config  `json:"store_urls,omitempty"`
+	// RateLimit tenant requests rate limit. Unlimited if empty
+	RateLimit ratelimit.Config `json:"rate_limit"`
+	// Features enabled features by name
+	Features map[string]bool `json:"features,omitempty"`
+	// Webhooks merchant endpoints notified of payment sessions status changes
+	Webhooks []*notify.Subscription `json:"webhooks,omitempty"`
+
+	// Providers tenant payment providers. Built on start from tenant providers config
+	Providers *providers.Registry `json:"-"`
+}
+
+// HashAPIKey return hex encoded sha256 of api key as it's stored in tenant config
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Enabled check that tenant enabled feature
+func (t *Tenant) Enabled(feature string) bool {
+	return t.Features[feature]
+}
+
+// Validate check tenant config values
+func (t *Tenant) Validate() error {
+	if !idRe.MatchString(t.ID) {
+		return errors.Errorf("tenant id %q should be lower case alphanumeric", t.ID)
+	}
+
+	for _, h := range t.Hosts {
+		if h == "" {
+			return errors.Errorf("tenant %s host shouldn't be empty", t.ID)
+		}
+	}
+
+	for _, k := range t.APIKeys {
+		if !apiKeyHashRe.MatchString(k) {
+			return errors.Errorf("tenant %s api key should be hex encoded sha256 of key", t.ID)
+		}
+	}
+
+	for id, secret := range t.HMACKeys {
+		if id == "" {
+			return errors.Errorf("tenant %s hmac key id shouldn't be empty", t.ID)
+		}
+		if len(secret) < minHMACSecretLen {
+			return errors.Errorf("tenant %s hmac key %s secret should be at least %d characters", t.ID, id, minHMACSecretLen)
+		}
+	}
+
+	if t.StoreURLs != nil {
+		if err := t.StoreURLs.Validate(); err != nil {
+			return errors.Wrapf(err, "tenant %s store urls", t.ID)
+		}
+	}
+
+	if err := t.RateLimit.Validate(); err != nil {
+		return errors.Wrapf(err, "tenant %s", t.ID)
+	}
+
+	for name := range t.Features {
+		if !knownFeatures[name] {
+			return errors.Errorf("tenant %s unknown feature %q", t.ID, name)
+		}
+	}
+
+	subs := make(map[string]bool, len(t.Webhooks))
+	for _, s := range t.Webhooks {
+		if err := s.Validate(); err != nil {
+			return errors.Wrapf(err, "tenant %s", t.ID)
+		}
+		if subs[s.ID] {
+			return errors.Errorf("tenant %s duplicate webhook subscription %s", t.ID, s.ID)
+		}
+		subs[s.ID] = true
+	}
+
+	return nil
+}
+
+type contextKey int
+
+const tenantKey contextKey = iota
+
+// WithTenant return context with request tenant
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey, t)
+}
+
+// FromContext return request tenant from context if any
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(tenantKey).(*Tenant)
+	return t, ok && t != nil
+}
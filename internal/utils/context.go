@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader header to pass request id between services
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loggerKey
+)
+
+// WithRequestID return context with request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID return request id from context if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithLogger return context with request scoped logger
+func WithLogger(ctx context.Context, l *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// Logger return request scoped logger from context or standard logger if there is no one
+func Logger(ctx context.Context) *logrus.Entry {
+	if l, ok := ctx.Value(loggerKey).(*logrus.Entry); ok {
+		return l
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
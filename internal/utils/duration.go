@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Duration time.Duration which could be unmarshalled from json string like "5s"
+type Duration time.Duration
+
+// UnmarshalJSON parse duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.WithStack(err)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	*d = Duration(v)
+	return nil
+}
@@ -1,10 +1,11 @@
 package utils
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -13,55 +14,59 @@ import (
 	"github.com/pkg/errors"
 )
 
-// testCert self generated public cert for testing
-const testCert = `
------BEGIN CERTIFICATE-----
-MIIC5TCCAc2gAwIBAgIJAN47QcKwvWpPMA0GCSqGSIb3DQEBCwUAMBQxEjAQBgNV
-BAMMCWxvY2FsaG9zdDAeFw0yMDA5MTkxODExMzVaFw0yMDEwMTkxODExMzVaMBQx
-EjAQBgNVBAMMCWxvY2FsaG9zdDCCASIwDQYJKoZIhvcNAQEBBQADggEPADCCAQoC
-ggEBAJS/32WujYi0ZV8p+7uF2aXWbc5Kxb/qnr1AqEFgVpgS2TaVyxsiajA6vSbR
-6a5/OCeKuneUrd+M92jWxyfR3/vDy0y7G8mSeUhM+Ln4aXIV63F0pUApo14jCQHt
-/SXJbhsbuFUz0sXDqviOTGtjJg4ymaTp9gAoF4UCTy069haH9aR4p9rFwMUr0unF
-Pzzehr5p3bl934JIOcimUwzpvYLavgxzN0O3y+yULa4v6lSZzsdz0wCkaXFud1Ky
-JfFDonKqdvP3ui1pPfPrLT2E4tD1KeLKdi8a0MlAGPLgdjgonboNtg6BQApF6uTf
-vTB1hTv+bcpWtAlZJXI15VtN01ECAwEAAaM6MDgwFAYDVR0RBA0wC4IJbG9jYWxo
-b3N0MAsGA1UdDwQEAwIHgDATBgNVHSUEDDAKBggrBgEFBQcDATANBgkqhkiG9w0B
-AQsFAAOCAQEAOp+71j4HWI+zBbDmINlJ3dpI+ZVWAPvpjTM54IRW1yXlAbYfHQPb
-p3VCXVc3fuVwxlWUfyMpeokSyibkNfZHENHSd+TnTAzb5B9UkQ2BlGks19kn3IIh
-PdJVJ2lRX1qgjxBrNCzJg6thyBH0mOCv1y+fizbl+F7N/6Eosw/X0HfQx+spaSZY
-W0MtXxfaELY0IkI3W2tRmr+etxREW9u2qZPhn9YyZJLP09h6W0m4ksje9E4oDTSk
-vQgEfl+93ZLZQs6FcJswGmmtjrRhmEvagUxr8ftpwnir7z/I3MmonmPbymjC5DSZ
-3YUp3pVRkTL5S7P7l6oVaAGP4Ld1AYC12Q==
------END CERTIFICATE-----
-`
-
 // Client http client to make requests
 type Client struct {
 	client *http.Client
+	retry  RetryPolicy
 }
 
-// NewClient construct http client
-func NewClient(timeout time.Duration) *Client {
-	return &Client{client: &http.Client{
-		Transport: transport(),
-		Timeout:   timeout,
-	}}
+// ClientOption http client option
+type ClientOption func(c *clientOptions)
+
+type clientOptions struct {
+	tlsConfig *tls.Config
+	retry     RetryPolicy
+	wrap      func(http.RoundTripper) http.RoundTripper
 }
 
-// tlsConfig read public cert and return tls.Config
-//nolint:gosec
-func tlsConfig() *tls.Config {
-	rootCAs := x509.NewCertPool()
-	rootCAs.AppendCertsFromPEM([]byte(testCert))
+// WithTLSConfig set client tls configuration.
+// Server certificate is verified against system roots by default
+func WithTLSConfig(tc *tls.Config) ClientOption {
+	return func(c *clientOptions) {
+		c.tlsConfig = tc
+	}
+}
 
-	return &tls.Config{
-		RootCAs:            rootCAs,
-		InsecureSkipVerify: true,
+// WithRoundTripper wrap client transport, e.g. to inject faults into provider requests
+func WithRoundTripper(wrap func(http.RoundTripper) http.RoundTripper) ClientOption {
+	return func(c *clientOptions) {
+		c.wrap = wrap
+	}
+}
+
+// NewClient construct http client
+func NewClient(timeout time.Duration, opts ...ClientOption) *Client {
+	co := &clientOptions{tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12}}
+	for _, opt := range opts {
+		opt(co)
+	}
+
+	var rt http.RoundTripper = transport(co.tlsConfig)
+	if co.wrap != nil {
+		rt = co.wrap(rt)
+	}
+
+	return &Client{
+		client: &http.Client{
+			Transport: rt,
+			Timeout:   timeout,
+		},
+		retry: co.retry,
 	}
 }
 
 // transport configuration for tls
-func transport() *http.Transport {
+func transport(tc *tls.Config) *http.Transport {
 	return &http.Transport{
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
@@ -69,17 +74,15 @@ func transport() *http.Transport {
 		ExpectContinueTimeout: 1 * time.Second,
 		ResponseHeaderTimeout: 10 * time.Second,
 		DisableKeepAlives:     true,
-		TLSClientConfig:       tlsConfig(),
+		TLSClientConfig:       tc,
 		DisableCompression:    true,
 	}
 }
 
-// NewTestTLSServer start test server over TLS
+// NewTestTLSServer start test server over TLS.
+// Server certificate isn't signed by trusted CA, clients should trust srv.Certificate() explicitly
 func NewTestTLSServer(h http.Handler) *httptest.Server {
-	srv := httptest.NewUnstartedServer(h)
-	srv.TLS = tlsConfig()
-	srv.StartTLS()
-	return srv
+	return httptest.NewTLSServer(h)
 }
 
 // Get simple get request
@@ -87,24 +90,75 @@ func (c *Client) Get(ctx context.Context, u *url.URL, successResponse, errorResp
 	return c.GetWithHeaders(ctx, u, successResponse, errorResponse, nil)
 }
 
-// GetWithHeaders simple get request with headers
+// GetWithHeaders simple get request with headers.
+// Request is retried according to client retry policy. Request id from context is sent in X-Request-ID header
 //nolint:interfacer
 func (c *Client) GetWithHeaders(ctx context.Context, u *url.URL, successResponse, errorResponse interface{}, headers map[string][]string) (int, error) {
-	if u == nil {
-		return -1, errors.New("url shouldn't be nil")
+	return c.do(ctx, http.MethodGet, u, nil, successResponse, errorResponse, headers)
+}
+
+// Post simple post request of json body
+func (c *Client) Post(ctx context.Context, u *url.URL, body []byte, successResponse, errorResponse interface{}) (int, error) {
+	return c.PostWithHeaders(ctx, u, body, successResponse, errorResponse, nil)
+}
+
+// PostWithHeaders simple post request of json body with headers.
+// Request is retried according to client retry policy, so retry only idempotent requests
+func (c *Client) PostWithHeaders(ctx context.Context, u *url.URL, body []byte, successResponse, errorResponse interface{}, headers map[string][]string) (int, error) {
+	h := http.Header(headers).Clone()
+	if h == nil {
+		h = make(http.Header)
 	}
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "application/json")
+	}
+	return c.do(ctx, http.MethodPost, u, body, successResponse, errorResponse, h)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
-	if err != nil {
-		return -1, errors.WithStack(err)
+// do make request and decode json response.
+// Request is retried according to client retry policy. Request id from context is sent in X-Request-ID header
+//nolint:interfacer
+func (c *Client) do(ctx context.Context, method string, u *url.URL, body []byte, successResponse, errorResponse interface{}, headers map[string][]string) (int, error) {
+	if u == nil {
+		return -1, errors.New("url shouldn't be nil")
 	}
 
-	// set headers if any
-	if headers != nil {
-		req.Header = headers
+	var (
+		resp *http.Response
+		err  error
+	)
+	for attempt := 1; ; attempt++ {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), bodyReader(body))
+		if err != nil {
+			return -1, errors.WithStack(err)
+		}
+
+		// set headers if any
+		if headers != nil {
+			req.Header = http.Header(headers).Clone()
+		}
+
+		// propagate request id to providers
+		if id := RequestID(ctx); id != "" && req.Header.Get(RequestIDHeader) == "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+
+		resp, err = c.client.Do(req)
+		wait, retry := c.retry.next(ctx, attempt, resp, err)
+		if !retry {
+			break
+		}
+
+		if resp != nil {
+			drain(resp)
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return -1, errors.WithStack(err)
+		}
 	}
 
-	resp, err := c.client.Do(req)
 	if err != nil {
 		return -1, errors.WithStack(err)
 	}
@@ -122,3 +176,11 @@ func (c *Client) GetWithHeaders(ctx context.Context, u *url.URL, successResponse
 
 	return resp.StatusCode, nil
 }
+
+// bodyReader return reader of request body, nil if there is no body
+func bodyReader(body []byte) io.Reader {
+	if body == nil {
+		return nil
+	}
+	return bytes.NewReader(body)
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -242,3 +246,297 @@ func TestClient_Get(t *testing.T) {
 		require.Equal(t, -1, sc)
 	})
 }
+
+func TestClient_GetRetry(t *testing.T) {
+	type message struct {
+		Message string `json:"message"`
+	}
+
+	policy := RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: Duration(time.Millisecond),
+		MaxBackoff:  Duration(5 * time.Millisecond),
+		Jitter:      0.5,
+	}
+
+	// failN handler fail first n requests with status code and succeed after
+	failN := func(n int32, sc int, calls *int32) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(calls, 1) <= n {
+				w.WriteHeader(sc)
+				_ = json.NewEncoder(w).Encode(message{Message: "ERROR"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(message{Message: "OK"})
+		}
+	}
+
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		handler   func(calls *int32) http.HandlerFunc
+		ctxTimout time.Duration
+		wantCode  int
+		wantCalls int32
+	}{
+		{
+			name:   "retries disabled by default",
+			policy: RetryPolicy{},
+			handler: func(calls *int32) http.HandlerFunc {
+				return failN(1, http.StatusServiceUnavailable, calls)
+			},
+			wantCode:  http.StatusServiceUnavailable,
+			wantCalls: 1,
+		},
+		{
+			name:   "succeed after retries",
+			policy: policy,
+			handler: func(calls *int32) http.HandlerFunc {
+				return failN(2, http.StatusBadGateway, calls)
+			},
+			wantCode:  http.StatusOK,
+			wantCalls: 3,
+		},
+		{
+			name:   "max attempts exceeded",
+			policy: policy,
+			handler: func(calls *int32) http.HandlerFunc {
+				return failN(5, http.StatusGatewayTimeout, calls)
+			},
+			wantCode:  http.StatusGatewayTimeout,
+			wantCalls: 3,
+		},
+		{
+			name:   "not retryable status code",
+			policy: policy,
+			handler: func(calls *int32) http.HandlerFunc {
+				return failN(1, http.StatusInternalServerError, calls)
+			},
+			wantCode:  http.StatusInternalServerError,
+			wantCalls: 1,
+		},
+		{
+			name: "custom retryable status codes",
+			policy: RetryPolicy{
+				MaxAttempts:          2,
+				BaseBackoff:          Duration(time.Millisecond),
+				RetryableStatusCodes: []int{http.StatusTooManyRequests},
+			},
+			handler: func(calls *int32) http.HandlerFunc {
+				return failN(1, http.StatusTooManyRequests, calls)
+			},
+			wantCode:  http.StatusOK,
+			wantCalls: 2,
+		},
+		{
+			name:   "connection reset",
+			policy: policy,
+			handler: func(calls *int32) http.HandlerFunc {
+				ok := failN(0, 0, calls)
+				return func(w http.ResponseWriter, r *http.Request) {
+					if atomic.LoadInt32(calls) == 0 {
+						atomic.AddInt32(calls, 1)
+						conn, _, err := w.(http.Hijacker).Hijack()
+						if err == nil {
+							conn.Close()
+						}
+						return
+					}
+					ok(w, r)
+				}
+			},
+			wantCode:  http.StatusOK,
+			wantCalls: 2,
+		},
+		{
+			name:   "retry after exceeds context deadline",
+			policy: policy,
+			handler: func(calls *int32) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(calls, 1)
+					w.Header().Set("Retry-After", "10")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					_ = json.NewEncoder(w).Encode(message{Message: "ERROR"})
+				}
+			},
+			ctxTimout: 500 * time.Millisecond,
+			wantCode:  http.StatusServiceUnavailable,
+			wantCalls: 1,
+		},
+		{
+			name:   "retry after exceeds max backoff",
+			policy: policy,
+			handler: func(calls *int32) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(calls, 1)
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					_ = json.NewEncoder(w).Encode(message{Message: "ERROR"})
+				}
+			},
+			wantCode:  http.StatusServiceUnavailable,
+			wantCalls: 1,
+		},
+		{
+			name: "backoff exceeds context deadline",
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseBackoff: Duration(time.Minute),
+			},
+			handler: func(calls *int32) http.HandlerFunc {
+				return failN(5, http.StatusServiceUnavailable, calls)
+			},
+			ctxTimout: 500 * time.Millisecond,
+			wantCode:  http.StatusServiceUnavailable,
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			ts := httptest.NewServer(tt.handler(&calls))
+			defer ts.Close()
+
+			u, err := url.Parse(ts.URL)
+			require.NoError(t, err)
+
+			ctx := context.Background()
+			if tt.ctxTimout != 0 {
+				c, cancel := context.WithTimeout(ctx, tt.ctxTimout)
+				ctx = c
+				defer cancel()
+			}
+
+			client := NewClient(time.Second, WithRetryPolicy(tt.policy))
+			sc, err := client.Get(ctx, u, &message{}, &message{})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCode, sc)
+			require.Equal(t, tt.wantCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestClient_GetRetryUntrustedCertificate(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	client := NewClient(time.Second, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseBackoff: Duration(time.Millisecond)}))
+	_, err = client.Get(context.Background(), u, nil, nil)
+	require.Error(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&conns))
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{
+		BaseBackoff: Duration(100 * time.Millisecond),
+		MaxBackoff:  Duration(time.Second),
+	}
+	require.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	require.Equal(t, 200*time.Millisecond, p.Backoff(2))
+	require.Equal(t, 800*time.Millisecond, p.Backoff(4))
+	require.Equal(t, time.Second, p.Backoff(5))
+	require.Equal(t, time.Second, p.Backoff(100))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(2)
+		require.True(t, d > 100*time.Millisecond && d <= 200*time.Millisecond, d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	d, ok := parseRetryAfter("3", now)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, d)
+
+	d, ok = parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.Equal(t, time.Minute, d)
+
+	_, ok = parseRetryAfter("", now)
+	require.False(t, ok)
+
+	_, ok = parseRetryAfter("soon", now)
+	require.False(t, ok)
+}
+
+func TestClient_GetRequestID(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(RequestIDHeader))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	client := NewClient(time.Second)
+	headers := map[string][]string{"X-Test": {"1"}}
+
+	_, err = client.GetWithHeaders(WithRequestID(context.Background(), "req-1"), u, nil, nil, headers)
+	require.NoError(t, err)
+	_, err = client.Get(context.Background(), u, nil, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"req-1", ""}, got)
+	// caller headers aren't modified
+	require.Equal(t, map[string][]string{"X-Test": {"1"}}, headers)
+}
+
+func TestClient_Post(t *testing.T) {
+	type message struct {
+		Message string `json:"message"`
+	}
+
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := &message{}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Test") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(m); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// body is sent again on retry
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(m)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	client := NewClient(time.Second, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseBackoff: Duration(time.Millisecond)}))
+	headers := map[string][]string{"X-Test": {"1"}}
+	got := &message{}
+	sc, err := client.PostWithHeaders(context.Background(), u, []byte(`{"message":"OK"}`), got, nil, headers)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, sc)
+	require.Equal(t, &message{Message: "OK"}, got)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	// caller headers aren't modified
+	require.Equal(t, map[string][]string{"X-Test": {"1"}}, headers)
+
+	sc, err = client.Post(context.Background(), u, []byte(`{"message":"OK"}`), nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, sc)
+}
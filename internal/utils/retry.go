@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRetryableStatusCodes status codes retried if policy doesn't define its own
+var DefaultRetryableStatusCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy retry policy for idempotent requests.
+// Request is retried on transport errors and retryable status codes with exponential backoff
+type RetryPolicy struct {
+	// MaxAttempts max number of attempts including the first one. Retries are disabled if less than 2
+	MaxAttempts int `json:"max_attempts"`
+	// BaseBackoff wait before the first retry, doubled for every next retry
+	BaseBackoff Duration `json:"base_backoff"`
+	// MaxBackoff max wait between retries
+	MaxBackoff Duration `json:"max_backoff"`
+	// Jitter fraction of backoff randomized to spread retries, from 0 to 1
+	Jitter float64 `json:"jitter"`
+	// RetryableStatusCodes response status codes to retry. DefaultRetryableStatusCodes if empty
+	RetryableStatusCodes []int `json:"retryable_status_codes"`
+}
+
+// WithRetryPolicy set client retry policy. Requests aren't retried by default
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(c *clientOptions) {
+		c.retry = p
+	}
+}
+
+// retryableStatus check if response status code should be retried
+func (p *RetryPolicy) retryableStatus(sc int) bool {
+	codes := p.RetryableStatusCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryableStatusCodes
+	}
+
+	for _, c := range codes {
+		if c == sc {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff return wait before retry. attempt is the number of failed attempt starting from 1
+//nolint:gosec
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	maxBackoff := time.Duration(p.MaxBackoff)
+	if maxBackoff <= 0 {
+		maxBackoff = time.Duration(math.MaxInt64 / 2)
+	}
+
+	d := time.Duration(p.BaseBackoff)
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+
+	if p.Jitter > 0 && d > 0 {
+		j := p.Jitter
+		if j > 1 {
+			j = 1
+		}
+		d -= time.Duration(rand.Float64() * j * float64(d))
+	}
+
+	return d
+}
+
+// next decide if failed attempt should be retried and how long to wait before it.
+// Retry is skipped if Retry-After exceeds max backoff or wait exceeds context deadline
+func (p *RetryPolicy) next(ctx context.Context, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+
+	wait := p.Backoff(attempt)
+	if err != nil && permanent(err) {
+		return 0, false
+	}
+
+	if err == nil {
+		if !p.retryableStatus(resp.StatusCode) {
+			return 0, false
+		}
+
+		if ra, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if p.MaxBackoff > 0 && ra > time.Duration(p.MaxBackoff) {
+				return 0, false
+			}
+			wait = ra
+		}
+	}
+
+	if dl, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(dl) {
+		return 0, false
+	}
+
+	return wait, true
+}
+
+// permanent check if transport error repeats on retry, e.g. server certificate isn't trusted
+func permanent(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalid          x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		recordHeader     tls.RecordHeaderError
+	)
+	return errors.As(err, &unknownAuthority) || errors.As(err, &invalid) || errors.As(err, &hostname) ||
+		errors.As(err, &recordHeader)
+}
+
+// parseRetryAfter parse Retry-After header value in seconds or http date format
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if s, err := strconv.Atoi(v); err == nil {
+		if s < 0 {
+			return 0, false
+		}
+		return time.Duration(s) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// drain read and close response body so connection could be reused
+func drain(resp *http.Response) {
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// sleep wait for duration or context done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
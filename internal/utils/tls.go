@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// tlsVersions supported minimal tls versions
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig client tls configuration
+type TLSConfig struct {
+	// CAFile PEM encoded CA bundle to verify server certificate. System roots are used if empty
+	CAFile string `json:"ca_file"`
+	// SystemRoots trust system roots in addition to CAFile
+	SystemRoots bool `json:"system_roots"`
+	// CertFile and KeyFile PEM encoded client certificate and key for mutual tls
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// MinVersion minimal tls version: 1.0, 1.1, 1.2 or 1.3. 1.2 by default
+	MinVersion string `json:"min_version"`
+	// ServerName expected server certificate name. Host from url is used if empty
+	ServerName string `json:"server_name"`
+	// InsecureSkipVerify disable server certificate verification. Never use it in production
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+}
+
+// Build construct tls.Config
+//nolint:gosec
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.MinVersion != "" {
+		v, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, errors.Errorf("unsupported tls version %s", c.MinVersion)
+		}
+		tc.MinVersion = v
+	}
+
+	if c.CAFile != "" {
+		pool := x509.NewCertPool()
+		if c.SystemRoots {
+			sp, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to load system roots")
+			}
+			pool = sp
+		}
+
+		b, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.Errorf("no certificates found in %s", c.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("both client certificate and key files should be set")
+		}
+
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client certificate")
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	return tc, nil
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertPEM write certificate to PEM file and return file path
+func writeCertPEM(t *testing.T, dir, name string, der []byte) string {
+	p := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return p
+}
+
+// newClientCert generate self signed client certificate and key PEM files
+func newClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "merchant.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	kb, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	kp := filepath.Join(dir, "client.key")
+	require.NoError(t, ioutil.WriteFile(kp, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600))
+
+	return cert, writeCertPEM(t, dir, "client.pem", der), kp
+}
+
+func TestTLSConfig_Build(t *testing.T) {
+	ts := NewTestTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	caFile := writeCertPEM(t, dir, "ca.pem", ts.Certificate().Raw)
+
+	u, err := url.Parse(ts.URL)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		tc       TLSConfig
+		wantErr  bool
+		buildErr bool
+	}{
+		{
+			name:    "system roots don't trust test server",
+			tc:      TLSConfig{},
+			wantErr: true,
+		},
+		{
+			name: "ca file",
+			tc:   TLSConfig{CAFile: caFile},
+		},
+		{
+			name: "ca file with system roots",
+			tc:   TLSConfig{CAFile: caFile, SystemRoots: true},
+		},
+		{
+			name: "server name pinned to certificate name",
+			tc:   TLSConfig{CAFile: caFile, ServerName: "example.com"},
+		},
+		{
+			name:    "server name mismatch",
+			tc:      TLSConfig{CAFile: caFile, ServerName: "apple.com"},
+			wantErr: true,
+		},
+		{
+			name: "verification disabled explicitly",
+			tc:   TLSConfig{InsecureSkipVerify: true},
+		},
+		{
+			name: "tls 1.3",
+			tc:   TLSConfig{CAFile: caFile, MinVersion: "1.3"},
+		},
+		{
+			name:     "unsupported tls version",
+			tc:       TLSConfig{MinVersion: "2.0"},
+			buildErr: true,
+		},
+		{
+			name:     "missing ca file",
+			tc:       TLSConfig{CAFile: filepath.Join(dir, "missing.pem")},
+			buildErr: true,
+		},
+		{
+			name:     "client cert without key",
+			tc:       TLSConfig{CertFile: caFile},
+			buildErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tc, err := tt.tc.Build()
+			if tt.buildErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = NewClient(time.Second, WithTLSConfig(tc)).Get(context.Background(), u, nil, nil)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("mutual tls", func(t *testing.T) {
+		cert, certFile, keyFile := newClientCert(t, dir)
+
+		mts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		mts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+		mts.TLS.ClientCAs.AddCert(cert)
+		mts.StartTLS()
+		defer mts.Close()
+
+		mu, err := url.Parse(mts.URL)
+		require.NoError(t, err)
+		mcaFile := writeCertPEM(t, dir, "mca.pem", mts.Certificate().Raw)
+
+		tc, err := (&TLSConfig{CAFile: mcaFile}).Build()
+		require.NoError(t, err)
+		_, err = NewClient(time.Second, WithTLSConfig(tc)).Get(context.Background(), mu, nil, nil)
+		require.Error(t, err)
+
+		tc, err = (&TLSConfig{CAFile: mcaFile, CertFile: certFile, KeyFile: keyFile}).Build()
+		require.NoError(t, err)
+		_, err = NewClient(time.Second, WithTLSConfig(tc)).Get(context.Background(), mu, nil, nil)
+		require.NoError(t, err)
+	})
+}